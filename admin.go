@@ -0,0 +1,253 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 根据环境变量创建管理员账号：ADMIN_USERNAME为用户名，ADMIN_PASSWORD_HASH为bcrypt密码哈希
+// （也可以用ADMIN_PASSWORD直接指定密码），ADMIN_EMAIL为邮箱，可以不设置
+func loadAdminFromEnv() {
+	username := os.Getenv("ADMIN_USERNAME")
+	if username == "" {
+		log.Println("未设置ADMIN_USERNAME，不会创建管理员")
+		return
+	}
+
+	passwordHash := os.Getenv("ADMIN_PASSWORD_HASH")
+	if passwordHash == "" {
+		password := os.Getenv("ADMIN_PASSWORD")
+		if password == "" {
+			log.Println("未设置ADMIN_PASSWORD_HASH或ADMIN_PASSWORD，不会创建管理员")
+			return
+		}
+		hash, err := db.HashPassword(password)
+		if err != nil {
+			log.Fatal("生成管理员密码哈希失败:", err)
+		}
+		passwordHash = hash
+	}
+
+	if _, err := db.BootstrapAdmin(username, os.Getenv("ADMIN_EMAIL"), passwordHash); err != nil {
+		log.Fatal("创建管理员失败:", err)
+	}
+	log.Printf("已创建管理员 %s", username)
+}
+
+// 获取用户列表，支持通过q参数按用户名或邮箱搜索
+func handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	users := db.ListUsers(r.URL.Query().Get("q"))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"users":   users,
+	})
+}
+
+// 禁用用户账号
+func handleAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// 启用用户账号
+func handleAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+// 禁用或启用用户账号的公共处理逻辑
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	adminID, _ := r.Context().Value("user_id").(string)
+
+	var requestData struct {
+		UserID string `json:"user_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&requestData)
+	if err != nil || requestData.UserID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	// 防止管理员禁用自己导致无人可以管理
+	if disabled && requestData.UserID == adminID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "不能禁用自己的账号"})
+		return
+	}
+
+	err = db.SetUserDisabled(requestData.UserID, disabled)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员 %s 修改用户 %s 禁用状态: %v", adminID, requestData.UserID, disabled)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// 修改用户角色
+func handleAdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	adminID, _ := r.Context().Value("user_id").(string)
+
+	var roleData struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&roleData)
+	if err != nil || roleData.UserID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	// 防止管理员取消自己的管理员权限
+	if roleData.UserID == adminID && roleData.Role != db.RoleAdmin {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "不能取消自己的管理员权限"})
+		return
+	}
+
+	err = db.SetUserRole(roleData.UserID, roleData.Role)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员 %s 修改用户 %s 角色为 %s", adminID, roleData.UserID, roleData.Role)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// 强制用户设备下线，未指定device_id时注销该用户的所有设备
+func handleAdminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	adminID, _ := r.Context().Value("user_id").(string)
+
+	var logoutData struct {
+		UserID   string `json:"user_id"`
+		DeviceID string `json:"device_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&logoutData)
+	if err != nil || logoutData.UserID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	removed := 0
+	if logoutData.DeviceID != "" {
+		err = db.DeleteDevice(logoutData.UserID, logoutData.DeviceID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		removed = 1
+	} else {
+		removed = db.RemoveUserDevices(logoutData.UserID)
+	}
+
+	log.Printf("管理员 %s 强制用户 %s 下线 %d 台设备", adminID, logoutData.UserID, removed)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"removed": removed,
+	})
+}
+
+// 获取服务器统计信息
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	stats, err := db.GetServerStats()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取统计信息失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"stats":   stats,
+	})
+}
+
+// 导出数据库数据到data目录下的JSON备份文件
+func handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	adminID, _ := r.Context().Value("user_id").(string)
+
+	filePath := filepath.Join("./data", fmt.Sprintf("export-%s.json", time.Now().Format("20060102150405")))
+	err := db.ExportDataToJSON(filePath)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "导出数据失败: " + err.Error()})
+		log.Printf("导出数据失败: %v", err)
+		return
+	}
+
+	log.Printf("管理员 %s 导出数据到 %s", adminID, filePath)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"file":    filePath,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// 分配任务负责人
+func handleAssignTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var assignData struct {
+		ID         string `json:"id"`
+		AssigneeID string `json:"assignee_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&assignData)
+	if err != nil || assignData.ID == "" || assignData.AssigneeID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.AssignTodo(userID, assignData.ID, assignData.AssigneeID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 将任务 %s 分配给 %s", userID, assignData.ID, assignData.AssigneeID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 取消任务负责人
+func handleUnassignTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var unassignData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&unassignData)
+	if err != nil || unassignData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.UnassignTodo(userID, unassignData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 取消任务 %s 的负责人", userID, unassignData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 获取任务的变更历史
+func handleGetTodoHistory(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	todoID := r.URL.Query().Get("id")
+
+	todo, err := db.GetTodoFromDB(todoID)
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	history, err := db.GetTodoHistoryFromDB(todoID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取任务历史失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"history": history,
+	})
+}
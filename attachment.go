@@ -0,0 +1,194 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// 上传附件，multipart/form-data格式：todo_id字段和file文件
+func handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	// 限制请求体大小，预留表单其他字段的空间
+	r.Body = http.MaxBytesReader(w, r.Body, db.MaxAttachmentSize+1<<20)
+	err := r.ParseMultipartForm(1 << 20)
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("无效的上传数据或文件超过%dMB", db.MaxAttachmentSize>>20)})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil || r.FormValue("todo_id") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "需要上传文件并指定任务"})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := db.CreateAttachment(userID, r.FormValue("todo_id"), header.Filename, file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 为任务 %s 上传附件: %s (%d字节)", userID, attachment.TodoID, attachment.Name, attachment.Size)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"attachment": attachment,
+	})
+}
+
+// 下载附件
+func handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var todo *db.Todo
+	attachment, err := db.GetAttachmentFromDB(r.URL.Query().Get("id"))
+	if err == nil {
+		todo, err = db.GetTodoFromDB(attachment.TodoID)
+	}
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "附件不存在或无权查看"})
+		return
+	}
+
+	content, err := db.OpenAttachment(attachment)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "读取附件失败: " + err.Error()})
+		return
+	}
+	defer content.Close()
+
+	// 使用上传时识别的类型，禁止浏览器再次猜测类型
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("发送附件 %s 失败: %v", attachment.ID, err)
+	}
+}
+
+// 获取任务的附件
+func handleGetAttachments(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	todoID := r.URL.Query().Get("id")
+
+	todo, err := db.GetTodoFromDB(todoID)
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	attachments, err := db.GetTodoAttachmentsFromDB(todoID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取附件失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"attachments": attachments,
+	})
+}
+
+// 删除附件
+func handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var attachmentData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&attachmentData)
+	if err != nil || attachmentData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteAttachment(userID, attachmentData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除附件 %s", userID, attachmentData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// 获取用户的附件存储用量和配额
+func handleGetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	used, err := db.GetUserStorageUsage(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取存储用量失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"used":     used,
+		"quota":    db.AttachmentQuota,
+		"max_size": db.MaxAttachmentSize,
+	})
+}
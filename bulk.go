@@ -0,0 +1,129 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 批量操作任务，任务可以通过ID列表或查询表达式指定，返回每个任务的执行结果
+func handleBulkTodos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var bulkData struct {
+		IDs        []string           `json:"ids"`
+		Query      string             `json:"query"`     // 没有传ids时按查询表达式选择任务
+		TimeZone   string             `json:"time_zone"` // 查询表达式中日期使用的时区
+		Archived   string             `json:"archived"`  // 查询时是否包含已归档的任务
+		Operations []db.BulkOperation `json:"operations"`
+		Mode       string             `json:"mode"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&bulkData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	ids := bulkData.IDs
+	if len(ids) == 0 {
+		if bulkData.Query == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "需要指定ids或query"})
+			return
+		}
+
+		loc := time.Local
+		if bulkData.TimeZone != "" {
+			loc, err = time.LoadLocation(bulkData.TimeZone)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "无效的时区: " + bulkData.TimeZone})
+				return
+			}
+		}
+		expr, err := db.ParseQueryExpr(bulkData.Query, userID, loc, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		page, err := db.QueryTodosFromDB(userID, db.TodoQuery{
+			TodoFilter: db.TodoFilter{Expr: expr, Archived: bulkData.Archived},
+			Limit:      db.MaxBulkTodos,
+		})
+		if err != nil {
+			if db.IsInvalidQuery(err) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			log.Printf("查询用户 %s 批量操作的任务失败: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "查询任务失败"})
+			return
+		}
+		if page.NextCursor != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("符合条件的任务太多，每次最多操作%d个任务", db.MaxBulkTodos)})
+			return
+		}
+		for _, todo := range page.Todos {
+			ids = append(ids, todo.ID)
+		}
+		if len(ids) == 0 {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":   true,
+				"total":     0,
+				"succeeded": 0,
+				"failed":    0,
+				"results":   []db.BulkResult{},
+			})
+			return
+		}
+	}
+
+	results, err := db.BulkUpdateTodos(userID, ids, bulkData.Operations, bulkData.Mode)
+	if err != nil {
+		if db.IsInvalidBulkRequest(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		log.Printf("用户 %s 批量操作任务失败: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "批量操作失败"})
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	log.Printf("用户 %s 批量操作了%d个任务，成功%d个", userID, len(results), succeeded)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   succeeded == len(results),
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// 获取任务的评论
+func handleGetComments(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	todoID := r.URL.Query().Get("id")
+
+	todo, err := db.GetTodoFromDB(todoID)
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	comments, err := db.GetTodoCommentsFromDB(todoID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取评论失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"comments": comments,
+	})
+}
+
+// 发表评论
+func handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var commentData struct {
+		TodoID string `json:"todo_id"`
+		Body   string `json:"body"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&commentData)
+	if err != nil || commentData.TodoID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	comment, err := db.CreateComment(userID, commentData.TodoID, commentData.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 评论任务 %s", userID, commentData.TodoID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"comment": comment,
+	})
+}
+
+// 修改评论
+func handleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var commentData struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&commentData)
+	if err != nil || commentData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	comment, err := db.UpdateComment(userID, commentData.ID, commentData.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 修改评论 %s", userID, commentData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"comment": comment,
+	})
+}
+
+// 删除评论
+func handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var commentData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&commentData)
+	if err != nil || commentData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteComment(userID, commentData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除评论 %s", userID, commentData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// 获取任务的活动记录，评论和系统事件按时间合并
+func handleGetTodoActivity(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	todo, err := db.GetTodoFromDB(r.URL.Query().Get("id"))
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	activity, err := db.GetTodoActivity(todo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取活动记录失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"activity": activity,
+	})
+}
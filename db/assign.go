@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// 将任务分配给指定用户，只有任务创建者或清单编辑者可以修改负责人
+// 负责人虽然可以修改任务，但不能把任务转给其他人，否则个人任务会被泄露给任意用户
+// 共享清单中的任务只能分配给清单成员，个人任务可以分配给任意有效用户
+func AssignTodo(actorID, todoID, assigneeID string) (*Todo, error) {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanDeleteTodo(actorID, todo) {
+		return nil, errors.New("任务不存在或无权修改负责人")
+	}
+
+	if !IsUserActive(assigneeID) {
+		return nil, errors.New("负责人不存在或已被禁用")
+	}
+	if todo.ListID != "" && !HasListRole(todo.ListID, assigneeID, ListRoleViewer) {
+		return nil, errors.New("负责人不是该清单的成员")
+	}
+	if todo.AssigneeID == assigneeID {
+		return todo, nil
+	}
+
+	oldAssignee := todo.AssigneeID
+	todo.AssigneeID = assigneeID
+	todo.UpdateAt = time.Now()
+	err = SaveTodoToDB(todo)
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录分配历史，同步时负责人的设备据此获取任务
+	if oldAssignee != "" {
+		err = AddTodoHistory(todoID, actorID, HistoryUnassigned, oldAssignee, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = AddTodoHistory(todoID, actorID, HistoryAssigned, oldAssignee, assigneeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// 取消任务的负责人，权限与分配任务相同
+func UnassignTodo(actorID, todoID string) (*Todo, error) {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanDeleteTodo(actorID, todo) {
+		return nil, errors.New("任务不存在或无权修改负责人")
+	}
+	if todo.AssigneeID == "" {
+		return todo, nil
+	}
+
+	oldAssignee := todo.AssigneeID
+	todo.AssigneeID = ""
+	todo.UpdateAt = time.Now()
+	err = SaveTodoToDB(todo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = AddTodoHistory(todoID, actorID, HistoryUnassigned, oldAssignee, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 在内存中添加测试用户
+func addTestUsers(t *testing.T, ids ...string) {
+	t.Helper()
+
+	users := Users
+	Users = append([]User{}, Users...)
+	for _, id := range ids {
+		Users = append(Users, User{ID: id, Username: id, Email: id + "@example.com", Role: RoleUser})
+	}
+	t.Cleanup(func() { Users = users })
+}
+
+func TestAssignTodoPermissions(t *testing.T) {
+	setupTestDB(t)
+	addTestUsers(t, "owner", "assignee", "stranger", "editor", "viewer")
+
+	personal := createTestTodo(t, "owner", "", "个人任务")
+	if _, err := AssignTodo("owner", personal.ID, "assignee"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 负责人可以修改任务，但不能转给其他人或取消分配
+	if _, err := AssignTodo("assignee", personal.ID, "stranger"); err == nil {
+		t.Error("负责人不应该可以把个人任务转给其他用户")
+	}
+	if _, err := UnassignTodo("assignee", personal.ID); err == nil {
+		t.Error("负责人不应该可以取消分配")
+	}
+	todo, err := GetTodoFromDB(personal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.AssigneeID != "assignee" || CanViewTodo("stranger", todo) {
+		t.Errorf("任务不应该被转给其他用户，负责人为 %s", todo.AssigneeID)
+	}
+	if !CanEditTodo("assignee", todo) {
+		t.Error("负责人应该可以修改任务")
+	}
+	if _, err := AssignTodo("stranger", personal.ID, "stranger"); err == nil {
+		t.Error("无关用户不应该可以分配任务")
+	}
+
+	// 创建者可以重新分配和取消分配
+	if _, err := AssignTodo("owner", personal.ID, "stranger"); err != nil {
+		t.Errorf("创建者应该可以重新分配: %v", err)
+	}
+	if _, err := UnassignTodo("owner", personal.ID); err != nil {
+		t.Errorf("创建者应该可以取消分配: %v", err)
+	}
+
+	// 共享清单中编辑者可以分配，查看者不可以，负责人必须是清单成员
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "editor", ListRoleEditor)
+	addTestListMember(t, list.ID, "viewer", ListRoleViewer)
+	shared := createTestTodo(t, "owner", list.ID, "共享任务")
+	if _, err := AssignTodo("viewer", shared.ID, "viewer"); err == nil {
+		t.Error("清单查看者不应该可以分配任务")
+	}
+	if _, err := AssignTodo("editor", shared.ID, "stranger"); err == nil {
+		t.Error("不应该可以分配给清单外的用户")
+	}
+	if _, err := AssignTodo("editor", shared.ID, "viewer"); err != nil {
+		t.Errorf("清单编辑者应该可以分配任务: %v", err)
+	}
+	if _, err := AssignTodo("viewer", shared.ID, "editor"); err == nil {
+		t.Error("作为负责人的查看者不应该可以转给其他人")
+	}
+
+	// 分配和取消分配都记录历史，负责人据此同步任务
+	history, err := GetTodoHistoryFromDB(personal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, record := range history {
+		actions = append(actions, record.Action)
+	}
+	if len(actions) != 4 || actions[0] != HistoryAssigned || actions[3] != HistoryUnassigned {
+		t.Errorf("分配历史记录不正确: %v", actions)
+	}
+	if assigned, err := GetRevokedTodoIDsAfterFromDB("assignee", time.Now().Add(-time.Minute)); err != nil || !containsString(assigned, personal.ID) {
+		t.Errorf("原负责人应该收到任务的删除通知，实际为 %v %v", assigned, err)
+	}
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 附件大小和每个用户的存储配额，单位为字节
+var (
+	MaxAttachmentSize int64 = 10 << 20
+	AttachmentQuota   int64 = 100 << 20
+)
+
+// 附件文件名的最大长度（字符数）
+const maxAttachmentName = 255
+
+// 允许上传的文件类型，根据文件内容识别，不信任客户端提供的类型
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// 保存内容和删除没有引用的内容需要互斥，避免删除刚被新附件引用的内容
+var blobMu sync.Mutex
+
+// 附件表的列，与scanAttachment的顺序保持一致
+const attachmentColumns = `id, todo_id, user_id, blob_hash, name, mime_type, size, created_at`
+
+// 扫描一行附件
+func scanAttachment(scanner rowScanner) (Attachment, error) {
+	var attachment Attachment
+	var createdAtStr string
+
+	err := scanner.Scan(
+		&attachment.ID, &attachment.TodoID, &attachment.UserID, &attachment.BlobHash,
+		&attachment.Name, &attachment.MimeType, &attachment.Size, &createdAtStr,
+	)
+	if err != nil {
+		return attachment, err
+	}
+
+	attachment.CreatedAt, err = stringToTime(createdAtStr)
+	return attachment, err
+}
+
+// 根据ID获取附件
+func GetAttachmentFromDB(attachmentID string) (*Attachment, error) {
+	attachment, err := scanAttachment(db.QueryRow(`SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`, attachmentID))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("附件不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetTodoAttachmentsFromDB 获取任务的附件，按上传时间正序
+func GetTodoAttachmentsFromDB(todoID string) ([]Attachment, error) {
+	rows, err := db.Query(`SELECT `+attachmentColumns+` FROM attachments WHERE todo_id = ? ORDER BY created_at ASC, id ASC`, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetUserStorageUsage 用户上传的附件占用的空间，相同内容的附件分别计算
+func GetUserStorageUsage(userID string) (int64, error) {
+	var used int64
+	err := db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = ?`, userID).Scan(&used)
+	return used, err
+}
+
+// 规范化文件名：去掉路径，为空时使用默认名称
+func cleanAttachmentName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentName {
+		name = string(runes[:maxAttachmentName])
+	}
+	return name
+}
+
+// CreateAttachment 为任务上传附件，需要任务的编辑权限
+// 文件类型根据内容识别，超过大小限制或用户配额时返回错误
+func CreateAttachment(userID, todoID, name string, content io.Reader) (*Attachment, error) {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanEditTodo(userID, todo) {
+		return nil, errors.New("任务不存在或无权修改")
+	}
+
+	// 根据前512个字节识别文件类型
+	reader := bufio.NewReaderSize(content, 512)
+	head, err := reader.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if len(head) == 0 {
+		return nil, errors.New("文件不能为空")
+	}
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedAttachmentTypes[mimeType] {
+		return nil, fmt.Errorf("不支持的文件类型: %s", mimeType)
+	}
+
+	// 新增附件只在持有blobMu时进行，在锁内计算已使用的空间，避免同时上传时超过配额
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	// 多读一个字节用于判断是否超过大小限制
+	hash, size, err := blobStore.Put(io.LimitReader(reader, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+	used, err := GetUserStorageUsage(userID)
+	if err != nil {
+		removeUnreferencedBlobs([]string{hash})
+		return nil, err
+	}
+	switch {
+	case size > MaxAttachmentSize:
+		err = fmt.Errorf("文件不能超过%dMB", MaxAttachmentSize>>20)
+	case used+size > AttachmentQuota:
+		err = fmt.Errorf("存储空间不足，已使用%.1fMB，配额为%dMB", float64(used)/(1<<20), AttachmentQuota>>20)
+	}
+	if err != nil {
+		removeUnreferencedBlobs([]string{hash})
+		return nil, err
+	}
+
+	attachment := &Attachment{
+		ID:        generateUUID(),
+		TodoID:    todoID,
+		UserID:    userID,
+		BlobHash:  hash,
+		Name:      cleanAttachmentName(name),
+		MimeType:  mimeType,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	_, err = db.Exec(`INSERT INTO attachments (`+attachmentColumns+`) VALUES (`+placeholders(8)+`)`,
+		attachment.ID, attachment.TodoID, attachment.UserID, attachment.BlobHash,
+		attachment.Name, attachment.MimeType, attachment.Size, timeToString(attachment.CreatedAt))
+	if err != nil {
+		removeUnreferencedBlobs([]string{hash})
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// OpenAttachment 读取附件内容
+func OpenAttachment(attachment *Attachment) (io.ReadCloser, error) {
+	return blobStore.Open(attachment.BlobHash)
+}
+
+// DeleteAttachment 删除附件：上传者可以删除自己的附件，可以删除任务的用户可以删除任务的任何附件
+// 没有其他附件引用的内容同时删除
+func DeleteAttachment(userID, attachmentID string) error {
+	attachment, err := GetAttachmentFromDB(attachmentID)
+	if err != nil {
+		return err
+	}
+	if attachment.UserID != userID {
+		todo, err := GetTodoFromDB(attachment.TodoID)
+		if err != nil || !CanDeleteTodo(userID, todo) {
+			return errors.New("无权删除该附件")
+		}
+	}
+
+	_, err = db.Exec(`DELETE FROM attachments WHERE id = ?`, attachmentID)
+	if err != nil {
+		return err
+	}
+
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	removeUnreferencedBlobs([]string{attachment.BlobHash})
+	return nil
+}
+
+// 删除没有附件引用的内容（调用方需要持有blobMu），删除失败只记录日志，启动时会再次清理
+func removeUnreferencedBlobs(hashes []string) {
+	for _, hash := range hashes {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM attachments WHERE blob_hash = ?`, hash).Scan(&count)
+		if err != nil {
+			log.Printf("检查附件内容 %s 的引用失败: %v", hash, err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		if err := blobStore.Delete(hash); err != nil {
+			log.Printf("删除附件内容 %s 失败: %v", hash, err)
+		}
+	}
+}
+
+// CleanupOrphanedBlobs 删除存储中没有附件引用的内容，返回删除的数量
+func CleanupOrphanedBlobs() (int, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	var orphans []string
+	err := blobStore.Walk(func(hash string) error {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM attachments WHERE blob_hash = ?`, hash).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			orphans = append(orphans, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, hash := range orphans {
+		if err := blobStore.Delete(hash); err != nil {
+			return 0, err
+		}
+	}
+	return len(orphans), nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// 同时上传多个附件时不会超过用户的存储配额
+func TestCreateAttachmentQuotaUnderConcurrency(t *testing.T) {
+	setupTestDB(t)
+	todo := createTestTodo(t, "user", "", "任务")
+
+	quota := AttachmentQuota
+	AttachmentQuota = 3 * 1024
+	t.Cleanup(func() { AttachmentQuota = quota })
+
+	const uploads = 10
+	var wg sync.WaitGroup
+	errs := make([]error, uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 每个文件内容不同，各占1KB
+			content := bytes.Repeat([]byte(fmt.Sprintf("file %02d\n", i)), 128)
+			_, errs[i] = CreateAttachment("user", todo.ID, fmt.Sprintf("%d.txt", i), bytes.NewReader(content))
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	used, err := GetUserStorageUsage("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeeded != 3 || used != AttachmentQuota {
+		t.Errorf("配额内应该只能上传3个附件，实际上传 %d 个，占用 %d 字节", succeeded, used)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,6 +14,12 @@ import (
 // JWT密钥
 var jwtSecret []byte
 
+// 用户角色常量
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // 初始化JWT密钥
 func init() {
 	// 生成随机密钥（实际应用中应该从环境变量或配置文件中读取）
@@ -66,12 +73,13 @@ func RegisterUser(username, password, email string) (*User, error) {
 		return nil, err
 	}
 
-	// 创建新用户
+	// 注册的用户都是普通用户，管理员只能通过BootstrapAdmin创建
 	newUser := &User{
 		ID:        generateUUID(),
 		Username:  username,
 		Password:  hashedPassword,
 		Email:     email,
+		Role:      RoleUser,
 		CreatedAt: time.Now(),
 	}
 
@@ -81,6 +89,50 @@ func RegisterUser(username, password, email string) (*User, error) {
 	return newUser, nil
 }
 
+// BootstrapAdmin 启动时根据配置的用户名和bcrypt密码哈希创建管理员账号，用户名已存在时改为管理员并重置密码
+// 用户只保存在内存中，每次启动都需要重新创建；管理员身份由密码决定，先注册同名用户不能获得管理员权限
+func BootstrapAdmin(username, email, passwordHash string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("管理员用户名不能为空")
+	}
+	if _, err := bcrypt.Cost([]byte(passwordHash)); err != nil {
+		return nil, errors.New("无效的管理员密码哈希")
+	}
+
+	for i := range Users {
+		if Users[i].Username == username {
+			Users[i].Role = RoleAdmin
+			Users[i].Password = passwordHash
+			Users[i].Disabled = false
+			admin := Users[i]
+			admin.Password = ""
+			return &admin, nil
+		}
+	}
+
+	if email == "" {
+		email = username + "@localhost"
+	}
+	for _, user := range Users {
+		if strings.EqualFold(user.Email, email) {
+			return nil, errors.New("邮箱已被注册")
+		}
+	}
+
+	admin := User{
+		ID:        generateUUID(),
+		Username:  username,
+		Password:  passwordHash,
+		Email:     email,
+		Role:      RoleAdmin,
+		CreatedAt: time.Now(),
+	}
+	Users = append(Users, admin)
+	admin.Password = ""
+	return &admin, nil
+}
+
 // 用户登录
 func LoginUser(username, password, deviceName, deviceID string) (*User, *Device, string, error) {
 	// 查找用户
@@ -101,6 +153,11 @@ func LoginUser(username, password, deviceName, deviceID string) (*User, *Device,
 		return nil, nil, "", errors.New("用户名或密码错误")
 	}
 
+	// 被禁用的账号不允许登录
+	if user.Disabled {
+		return nil, nil, "", errors.New("账号已被禁用")
+	}
+
 	// 查找或创建设备
 	var device *Device
 	found := false
@@ -206,6 +263,19 @@ func GetUserByID(userID string) (*User, error) {
 	return nil, errors.New("用户不存在")
 }
 
+// 根据用户名或邮箱查找用户（不包含密码）
+func FindUserByUsernameOrEmail(identifier string) (*User, error) {
+	identifier = strings.TrimSpace(identifier)
+	for _, user := range Users {
+		if user.Username == identifier || strings.EqualFold(user.Email, identifier) {
+			userCopy := user
+			userCopy.Password = ""
+			return &userCopy, nil
+		}
+	}
+	return nil, errors.New("用户不存在")
+}
+
 // 获取用户的所有设备
 func GetUserDevices(userID string) []Device {
 	var devices []Device
@@ -216,3 +286,69 @@ func GetUserDevices(userID string) []Device {
 	}
 	return devices
 }
+
+// 列出用户（不包含密码），query不为空时按用户名或邮箱模糊匹配
+func ListUsers(query string) []User {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	users := make([]User, 0, len(Users))
+	for _, user := range Users {
+		if query != "" &&
+			!strings.Contains(strings.ToLower(user.Username), query) &&
+			!strings.Contains(strings.ToLower(user.Email), query) {
+			continue
+		}
+		userCopy := user
+		userCopy.Password = ""
+		users = append(users, userCopy)
+	}
+	return users
+}
+
+// 判断用户是否拥有指定角色
+func HasRole(userID, role string) bool {
+	for _, user := range Users {
+		if user.ID == userID {
+			return user.Role == role
+		}
+	}
+	return false
+}
+
+// 检查用户是否存在且未被禁用
+func IsUserActive(userID string) bool {
+	for _, user := range Users {
+		if user.ID == userID {
+			return !user.Disabled
+		}
+	}
+	return false
+}
+
+// 禁用或启用用户账号，禁用时同时注销该用户的所有设备
+func SetUserDisabled(userID string, disabled bool) error {
+	for i := range Users {
+		if Users[i].ID == userID {
+			Users[i].Disabled = disabled
+			if disabled {
+				RemoveUserDevices(userID)
+			}
+			return nil
+		}
+	}
+	return errors.New("用户不存在")
+}
+
+// 修改用户角色
+func SetUserRole(userID, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return errors.New("无效的角色")
+	}
+	for i := range Users {
+		if Users[i].ID == userID {
+			Users[i].Role = role
+			return nil
+		}
+	}
+	return errors.New("用户不存在")
+}
@@ -0,0 +1,63 @@
+package db
+
+import "testing"
+
+// 替换内存中的用户和设备，测试结束后恢复
+func resetTestUsers(t *testing.T) {
+	t.Helper()
+
+	users, devices := Users, Devices
+	Users, Devices = nil, nil
+	t.Cleanup(func() { Users, Devices = users, devices })
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	resetTestUsers(t)
+
+	// 注册的用户不会自动成为管理员
+	user, err := RegisterUser("root", "password", "root@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != RoleUser {
+		t.Errorf("注册的用户应该是普通用户，实际为 %s", user.Role)
+	}
+
+	if _, err := BootstrapAdmin("admin", "", "not-a-hash"); err == nil {
+		t.Error("无效的密码哈希应该返回错误")
+	}
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := BootstrapAdmin("admin", "", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Role != RoleAdmin || admin.Password != "" || !HasRole(admin.ID, RoleAdmin) {
+		t.Errorf("应该创建管理员账号，实际为 %+v", admin)
+	}
+
+	// 管理员用户名已被占用，不能再注册
+	if _, err := RegisterUser("admin", "guess", "attacker@example.com"); err == nil {
+		t.Error("不应该可以注册管理员的用户名")
+	}
+	if _, _, _, err := LoginUser("admin", "guess", "", "device"); err == nil {
+		t.Error("错误的密码不应该可以登录管理员账号")
+	}
+	if _, _, _, err := LoginUser("admin", "secret", "", "device"); err != nil {
+		t.Errorf("管理员应该可以用配置的密码登录: %v", err)
+	}
+
+	// 已存在的同名用户改为管理员，密码重置为配置的密码
+	if _, err := BootstrapAdmin("root", "", hash); err != nil {
+		t.Fatal(err)
+	}
+	if !HasRole(user.ID, RoleAdmin) {
+		t.Error("已存在的用户应该改为管理员")
+	}
+	if _, _, _, err := LoginUser("root", "password", "", "device"); err == nil {
+		t.Error("原来的密码不应该再可以登录")
+	}
+}
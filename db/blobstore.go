@@ -0,0 +1,124 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore 附件内容的存储，按内容的SHA-256寻址，相同内容只保存一份
+type BlobStore interface {
+	// Put 保存内容，返回内容的SHA-256和字节数，内容已存在时不重复保存
+	Put(r io.Reader) (hash string, size int64, err error)
+	// Open 读取内容
+	Open(hash string) (io.ReadCloser, error)
+	// Delete 删除内容，内容不存在时不返回错误
+	Delete(hash string) error
+	// Walk 遍历所有内容的哈希，用于清理没有引用的内容
+	Walk(fn func(hash string) error) error
+}
+
+// 附件内容的存储，InitDatabase时初始化为本地文件系统
+var blobStore BlobStore
+
+// SetBlobStore 替换附件内容的存储
+func SetBlobStore(store BlobStore) {
+	blobStore = store
+}
+
+var errInvalidBlobHash = errors.New("无效的内容哈希")
+
+// LocalBlobStore 保存在本地目录中的内容，文件路径为哈希的前两位/完整哈希
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore 创建本地内容存储，目录不存在时自动创建
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("创建附件目录失败: %v", err)
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+// 校验哈希格式，避免拼接出存储目录之外的路径
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil && strings.ToLower(hash) == hash
+}
+
+func (s *LocalBlobStore) path(hash string) string {
+	return filepath.Join(s.root, hash[:2], hash)
+}
+
+// Put 先写入临时文件并计算哈希，再移动到以哈希命名的位置
+func (s *LocalBlobStore) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(s.root, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	target := s.path(hash)
+	if _, err := os.Stat(target); err == nil {
+		return hash, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+// Open 读取内容
+func (s *LocalBlobStore) Open(hash string) (io.ReadCloser, error) {
+	if !validBlobHash(hash) {
+		return nil, errInvalidBlobHash
+	}
+	return os.Open(s.path(hash))
+}
+
+// Delete 删除内容
+func (s *LocalBlobStore) Delete(hash string) error {
+	if !validBlobHash(hash) {
+		return errInvalidBlobHash
+	}
+	err := os.Remove(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Walk 遍历所有内容，跳过临时文件
+func (s *LocalBlobStore) Walk(fn func(hash string) error) error {
+	return filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !validBlobHash(info.Name()) {
+			return nil
+		}
+		return fn(info.Name())
+	})
+}
@@ -0,0 +1,366 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 批量操作的类型
+const (
+	BulkOpComplete    = "complete"     // 设置完成状态，completed不传表示完成
+	BulkOpMoveProject = "move_project" // 移动到项目，project_id为空表示移出项目
+	BulkOpAddTag      = "add_tag"      // 添加标签
+	BulkOpRemoveTag   = "remove_tag"   // 移除标签
+	BulkOpSetPriority = "set_priority" // 设置优先级
+	BulkOpDelete      = "delete"       // 移入回收站，必须是最后一个操作
+)
+
+// 批量操作的执行方式
+const (
+	BulkModeAtomic     = "atomic"      // 任意一个任务失败时不修改任何任务
+	BulkModeBestEffort = "best_effort" // 每个任务单独执行，失败的任务不影响其他任务
+)
+
+// 批量操作的数量限制
+const (
+	MaxBulkTodos      = 500
+	maxBulkOperations = 20
+)
+
+// 原子执行时因其他任务失败而没有执行的任务的错误
+var errBulkAborted = errors.New("其他任务操作失败，没有修改任何任务")
+
+// 任务在准备之后、写入之前被其他请求修改或删除
+type bulkConflictError struct {
+	id string
+}
+
+func (e *bulkConflictError) Error() string {
+	return "任务在操作期间被其他请求修改，请重试"
+}
+
+// 批量请求本身无效的错误，用于和数据库错误区分
+type invalidBulkRequestError struct {
+	err error
+}
+
+func (e *invalidBulkRequestError) Error() string {
+	return e.err.Error()
+}
+
+// IsInvalidBulkRequest 判断错误是否由无效的批量请求引起，其他错误为数据库错误
+func IsInvalidBulkRequest(err error) bool {
+	var invalid *invalidBulkRequestError
+	return errors.As(err, &invalid)
+}
+
+// BulkOperation 对每个任务依次执行的一个操作
+type BulkOperation struct {
+	Op        string `json:"op"`
+	Completed *bool  `json:"completed,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+	TagID     string `json:"tag_id,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+	Cascade   bool   `json:"cascade,omitempty"` // 删除时是否同时删除所有层级的子任务
+}
+
+// BulkResult 单个任务的执行结果，成功时返回修改后的任务
+type BulkResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Todo    *Todo  `json:"todo,omitempty"`
+}
+
+// 准备好写入数据库的任务
+type bulkItem struct {
+	previous Todo
+	todo     *Todo
+	modified bool // 是否需要保存任务本身的修改
+	trash    bool
+	cascade  bool
+}
+
+// 校验批量操作，同时规范化优先级
+func validateBulkOperations(ops []BulkOperation) error {
+	if len(ops) == 0 {
+		return errors.New("没有指定操作")
+	}
+	if len(ops) > maxBulkOperations {
+		return fmt.Errorf("每次最多执行%d个操作", maxBulkOperations)
+	}
+
+	for i := range ops {
+		op := &ops[i]
+		switch op.Op {
+		case BulkOpComplete, BulkOpMoveProject:
+		case BulkOpAddTag, BulkOpRemoveTag:
+			if op.TagID == "" {
+				return fmt.Errorf("操作%s需要指定tag_id", op.Op)
+			}
+		case BulkOpSetPriority:
+			p, err := ParsePriority(op.Priority)
+			if err != nil {
+				return err
+			}
+			op.Priority = string(p)
+		case BulkOpDelete:
+			if i != len(ops)-1 {
+				return errors.New("删除必须是最后一个操作")
+			}
+		default:
+			return fmt.Errorf("无效的操作: %s", op.Op)
+		}
+	}
+	return nil
+}
+
+// 在内存中对任务执行批量操作并校验结果，positions记录本批次中各排序范围最后分配的位置
+func prepareBulkTodo(userID, todoID string, ops []BulkOperation, positions map[string]string, now time.Time) (*bulkItem, error) {
+	todo, err := getTodoWithPermission(userID, todoID, CanEditTodo, "任务不存在或无权修改")
+	if err != nil {
+		return nil, err
+	}
+	if todo.DeletedAt != nil {
+		return nil, errTodoInTrash
+	}
+
+	item := &bulkItem{previous: *todo, todo: todo}
+	item.previous.TagIDs = append([]string(nil), todo.TagIDs...)
+
+	for _, op := range ops {
+		switch op.Op {
+		case BulkOpComplete:
+			todo.Completed = op.Completed == nil || *op.Completed
+		case BulkOpMoveProject:
+			todo.ProjectID = op.ProjectID
+			todo.Category = ""
+		case BulkOpAddTag:
+			todo.TagIDs = append(append([]string{}, todo.TagIDs...), op.TagID)
+		case BulkOpRemoveTag:
+			tagIDs := []string{}
+			for _, tagID := range todo.TagIDs {
+				if tagID != op.TagID {
+					tagIDs = append(tagIDs, tagID)
+				}
+			}
+			todo.TagIDs = tagIDs
+		case BulkOpSetPriority:
+			todo.Priority = Priority(op.Priority)
+		case BulkOpDelete:
+			if !CanDeleteTodo(userID, todo) {
+				return nil, errors.New("无权删除该任务")
+			}
+			item.trash = true
+			item.cascade = op.Cascade
+			continue
+		}
+		item.modified = true
+	}
+	if !item.modified {
+		return item, nil
+	}
+
+	// 与修改单个任务时使用同样的校验
+	todo.UpdateAt = now
+	err = ApplyTodoProject(userID, todo)
+	if err == nil {
+		err = ApplyTodoTags(userID, todo)
+	}
+	if err == nil {
+		err = ApplyTodoParent(userID, todo)
+	}
+	if err == nil {
+		err = ApplyTodoPriority(todo)
+	}
+	if err == nil {
+		err = ApplyTodoCustomFields(todo)
+	}
+	if err == nil {
+		err = ApplyTodoStatus(&item.previous, todo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 移动到其他项目时排到最后，同一批次中移动到同一范围的任务按顺序排列
+	if !SamePositionScope(&item.previous, todo) {
+		key := fmt.Sprint(positionScopeArgs(todo)...)
+		last, ok := positions[key]
+		if !ok {
+			if last, err = lastPosition(todo); err != nil {
+				return nil, err
+			}
+		}
+		if todo.Position, err = PositionBetween(last, ""); err != nil {
+			return nil, err
+		}
+		positions[key] = todo.Position
+	}
+	return item, nil
+}
+
+// 在事务中保存任务的修改
+func saveBulkTodo(tx *sql.Tx, item *bulkItem) error {
+	values := todoValues(item.todo)
+	_, err := tx.Exec(`INSERT OR REPLACE INTO todos (`+todoColumns+`) VALUES (`+placeholders(len(values))+`)`, values...)
+	if err != nil {
+		return err
+	}
+	return replaceTodoTags(tx, item.todo.ID, item.todo.TagIDs)
+}
+
+// 在事务中确认任务在准备之后没有被修改或删除，避免覆盖其他请求的修改
+func checkBulkTodoUnchanged(tx *sql.Tx, item *bulkItem) error {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM todos WHERE id = ? AND updated_at = ? AND deleted_at = ''`,
+		item.previous.ID, timeToString(item.previous.UpdateAt)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return &bulkConflictError{id: item.previous.ID}
+	}
+	return nil
+}
+
+// 在一个事务中写入一组任务：先确认所有任务在准备之后没有被修改，再保存所有修改，最后移入回收站，
+// 避免移入回收站时修改的子任务被误判为冲突，以及保存子任务时覆盖父任务级联设置的删除时间
+func writeBulkTodos(items []*bulkItem, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		if err := checkBulkTodoUnchanged(tx, item); err != nil {
+			return err
+		}
+	}
+	for _, item := range items {
+		if item.modified {
+			if err := saveBulkTodo(tx, item); err != nil {
+				return err
+			}
+		}
+	}
+	for _, item := range items {
+		if item.trash {
+			if err := trashTodo(tx, item.todo, item.cascade, now); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// 提交后的处理：重新计算提醒、记录历史和生成下一次重复任务，此时已无法回滚，失败只记录日志
+func finishBulkTodo(userID string, item *bulkItem) {
+	if item.modified {
+		if err := refreshTodoReminders(item.todo); err != nil {
+			log.Printf("更新任务 %s 的提醒失败: %v", item.todo.ID, err)
+		}
+		if err := onTodoSaved(userID, &item.previous, item.todo); err != nil {
+			log.Printf("记录任务 %s 的变更失败: %v", item.todo.ID, err)
+		}
+	}
+	if item.trash {
+		if err := AddTodoHistory(item.todo.ID, userID, HistoryTrashed, "", ""); err != nil {
+			log.Printf("记录任务 %s 的变更失败: %v", item.todo.ID, err)
+		}
+	}
+}
+
+// BulkUpdateTodos 对一组任务依次执行相同的操作，返回每个任务的结果
+// atomic模式下只要有一个任务失败就不修改任何任务，best_effort模式下每个任务单独提交
+func BulkUpdateTodos(userID string, todoIDs []string, ops []BulkOperation, mode string) ([]BulkResult, error) {
+	if mode == "" {
+		mode = BulkModeAtomic
+	}
+	if mode != BulkModeAtomic && mode != BulkModeBestEffort {
+		return nil, &invalidBulkRequestError{fmt.Errorf("无效的执行方式: %s", mode)}
+	}
+	if err := validateBulkOperations(ops); err != nil {
+		return nil, &invalidBulkRequestError{err}
+	}
+
+	// 去除重复的任务，保持传入的顺序
+	seen := make(map[string]bool, len(todoIDs))
+	ids := make([]string, 0, len(todoIDs))
+	for _, id := range todoIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, &invalidBulkRequestError{errors.New("没有指定任务")}
+	}
+	if len(ids) > MaxBulkTodos {
+		return nil, &invalidBulkRequestError{fmt.Errorf("每次最多操作%d个任务", MaxBulkTodos)}
+	}
+
+	now := time.Now()
+	positions := make(map[string]string)
+	results := make([]BulkResult, len(ids))
+	items := make([]*bulkItem, len(ids))
+	failed := false
+	for i, id := range ids {
+		results[i].ID = id
+		item, err := prepareBulkTodo(userID, id, ops, positions, now)
+		if err == nil && mode == BulkModeBestEffort {
+			var conflict *bulkConflictError
+			if err = writeBulkTodos([]*bulkItem{item}, now); err != nil && !errors.As(err, &conflict) {
+				err = fmt.Errorf("保存任务失败: %v", err)
+			}
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			failed = true
+			continue
+		}
+		items[i] = item
+	}
+
+	if mode == BulkModeAtomic {
+		if failed {
+			for i := range results {
+				if results[i].Error == "" {
+					results[i].Error = errBulkAborted.Error()
+				}
+			}
+			return results, nil
+		}
+		// 准备期间有任务被修改时不写入任何任务，由客户端重试
+		if err := writeBulkTodos(items, now); err != nil {
+			var conflict *bulkConflictError
+			if !errors.As(err, &conflict) {
+				return nil, err
+			}
+			for i := range results {
+				if results[i].ID == conflict.id {
+					results[i].Error = conflict.Error()
+				} else {
+					results[i].Error = errBulkAborted.Error()
+				}
+			}
+			return results, nil
+		}
+	}
+
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		finishBulkTodo(userID, item)
+		results[i].Success = true
+		if todo, err := GetTodoFromDB(item.todo.ID); err == nil {
+			results[i].Todo = todo
+		}
+	}
+	return results, nil
+}
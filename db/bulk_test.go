@@ -0,0 +1,165 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func bulkOps(ops ...BulkOperation) []BulkOperation {
+	return ops
+}
+
+func TestBulkUpdateTodosAtomic(t *testing.T) {
+	setupTestDB(t)
+	a := createTestTodo(t, "user", "", "a")
+	b := createTestTodo(t, "user", "", "b")
+	other := createTestTodo(t, "other", "", "其他用户的任务")
+
+	ops := bulkOps(BulkOperation{Op: BulkOpComplete}, BulkOperation{Op: BulkOpSetPriority, Priority: "high"})
+	results, err := BulkUpdateTodos("user", []string{a.ID, other.ID, b.ID}, ops, BulkModeAtomic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1].Success || results[1].Error != "任务不存在或无权修改" {
+		t.Errorf("无权修改的任务应该失败，实际为 %+v", results[1])
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Success || results[i].Error != errBulkAborted.Error() {
+			t.Errorf("原子执行时其他任务应该因为失败而取消，实际为 %+v", results[i])
+		}
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		todo, err := GetTodoFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Completed || todo.Priority == PriorityHigh {
+			t.Errorf("原子执行失败时不应该修改任何任务，实际任务 %s 已被修改", todo.Name)
+		}
+	}
+
+	results, err = BulkUpdateTodos("user", []string{a.ID, b.ID, a.ID}, ops, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("重复的任务只执行一次，实际结果为 %d 个", len(results))
+	}
+	for _, result := range results {
+		if !result.Success || !result.Todo.Completed || result.Todo.Priority != PriorityHigh || result.Todo.Status != StatusDone {
+			t.Errorf("任务应该完成并设置为高优先级，实际为 %+v", result)
+		}
+	}
+}
+
+func TestBulkUpdateTodosBestEffort(t *testing.T) {
+	setupTestDB(t)
+	a := createTestTodo(t, "user", "", "a")
+	b := createTestTodo(t, "user", "", "b")
+	tag := &Tag{Name: "客户"}
+	if err := CreateTag("user", tag); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := bulkOps(BulkOperation{Op: BulkOpAddTag, TagID: tag.ID}, BulkOperation{Op: BulkOpDelete})
+	results, err := BulkUpdateTodos("user", []string{a.ID, "missing", b.ID}, ops, BulkModeBestEffort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Success || results[1].Success || !results[2].Success {
+		t.Fatalf("只有不存在的任务应该失败，实际为 %+v", results)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		todo, err := GetTodoFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.DeletedAt == nil || !containsString(todo.TagIDs, tag.ID) {
+			t.Errorf("任务 %s 应该添加标签并移入回收站", todo.Name)
+		}
+	}
+}
+
+// 准备之后任务被其他请求修改时不覆盖其他请求的修改
+func TestBulkUpdateTodosDetectsConcurrentEdits(t *testing.T) {
+	setupTestDB(t)
+	a := createTestTodo(t, "user", "", "a")
+	b := createTestTodo(t, "user", "", "b")
+	now := time.Now()
+
+	ops := bulkOps(BulkOperation{Op: BulkOpSetPriority, Priority: "low"})
+	positions := make(map[string]string)
+	var items []*bulkItem
+	for _, id := range []string{a.ID, b.ID} {
+		item, err := prepareBulkTodo("user", id, ops, positions, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+
+	// 另一个请求在写入之前修改了任务b
+	edited := *b
+	edited.Name = "b（已修改）"
+	edited.UpdateAt = b.UpdateAt.Add(2 * time.Second)
+	if err := SaveTodoToDB(&edited); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writeBulkTodos(items, now)
+	var conflict *bulkConflictError
+	if !errors.As(err, &conflict) || conflict.id != b.ID {
+		t.Fatalf("应该检测到任务b的并发修改，实际为 %v", err)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		todo, err := GetTodoFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Priority == PriorityLow {
+			t.Errorf("冲突时不应该写入任何任务，实际任务 %s 已被修改", todo.Name)
+		}
+	}
+	if todo, _ := GetTodoFromDB(b.ID); todo.Name != edited.Name {
+		t.Errorf("其他请求的修改不应该被覆盖，实际名称为 %s", todo.Name)
+	}
+}
+
+func TestBulkUpdateTodosInvalidRequest(t *testing.T) {
+	setupTestDB(t)
+	todo := createTestTodo(t, "user", "", "a")
+	complete := bulkOps(BulkOperation{Op: BulkOpComplete})
+	var tooMany []string
+	for i := 0; i <= MaxBulkTodos; i++ {
+		tooMany = append(tooMany, generateUUID())
+	}
+
+	tests := map[string]struct {
+		ids  []string
+		ops  []BulkOperation
+		mode string
+	}{
+		"无效的执行方式":  {[]string{todo.ID}, complete, "sometimes"},
+		"没有指定操作":   {[]string{todo.ID}, nil, ""},
+		"无效的操作":    {[]string{todo.ID}, bulkOps(BulkOperation{Op: "archive"}), ""},
+		"添加标签缺少标签": {[]string{todo.ID}, bulkOps(BulkOperation{Op: BulkOpAddTag}), ""},
+		"无效的优先级":   {[]string{todo.ID}, bulkOps(BulkOperation{Op: BulkOpSetPriority, Priority: "someday"}), ""},
+		"删除不是最后操作": {[]string{todo.ID}, bulkOps(BulkOperation{Op: BulkOpDelete}, BulkOperation{Op: BulkOpComplete}), ""},
+		"没有指定任务":   {nil, complete, ""},
+		"任务太多":     {tooMany, complete, ""},
+	}
+	for name, tt := range tests {
+		if _, err := BulkUpdateTodos("user", tt.ids, tt.ops, tt.mode); !IsInvalidBulkRequest(err) {
+			t.Errorf("%s应该返回请求无效的错误，实际为 %v", name, err)
+		}
+	}
+
+	// 写入时的数据库错误不是请求无效
+	if _, err := db.Exec(`CREATE TRIGGER fail_insert BEFORE INSERT ON todos BEGIN SELECT RAISE(FAIL, '写入失败'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BulkUpdateTodos("user", []string{todo.ID}, complete, BulkModeAtomic); err == nil || IsInvalidBulkRequest(err) {
+		t.Errorf("数据库错误不应该被当作请求无效，实际为 %v", err)
+	}
+}
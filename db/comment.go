@@ -0,0 +1,319 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 评论正文的最大长度（字符数）
+const maxCommentBody = 10000
+
+// 评论表的列，与scanComment的顺序保持一致
+const commentColumns = `id, todo_id, user_id, body, mentions, edited, deleted, created_at, updated_at`
+
+// @用户名，@前面不能是字母、数字或下划线，避免匹配邮箱地址
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// 扫描一行评论
+func scanComment(scanner rowScanner) (Comment, error) {
+	var comment Comment
+	var mentionsStr, createdAtStr, updatedAtStr string
+	var editedInt, deletedInt int
+
+	err := scanner.Scan(
+		&comment.ID, &comment.TodoID, &comment.UserID, &comment.Body, &mentionsStr,
+		&editedInt, &deletedInt, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return comment, err
+	}
+
+	comment.Edited = intToBool(editedInt)
+	comment.Deleted = intToBool(deletedInt)
+	if err := json.Unmarshal([]byte(mentionsStr), &comment.Mentions); err != nil || comment.Mentions == nil {
+		comment.Mentions = []string{}
+	}
+	if user, err := GetUserByID(comment.UserID); err == nil {
+		comment.Username = user.Username
+	}
+	comment.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return comment, err
+	}
+	comment.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return comment, err
+	}
+
+	return comment, nil
+}
+
+// 保存评论
+func saveComment(comment *Comment) error {
+	mentions, err := json.Marshal(comment.Mentions)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO comments (` + commentColumns + `) VALUES (` + placeholders(9) + `)`
+	_, err = db.Exec(query,
+		comment.ID, comment.TodoID, comment.UserID, comment.Body, string(mentions),
+		boolToInt(comment.Edited), boolToInt(comment.Deleted), timeToString(comment.CreatedAt), timeToString(comment.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID获取评论
+func GetCommentFromDB(commentID string) (*Comment, error) {
+	comment, err := scanComment(db.QueryRow(`SELECT `+commentColumns+` FROM comments WHERE id = ?`, commentID))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("评论不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetTodoCommentsFromDB 获取任务的评论（包括已删除的评论），按时间正序
+func GetTodoCommentsFromDB(todoID string) ([]Comment, error) {
+	rows, err := db.Query(`SELECT `+commentColumns+` FROM comments WHERE todo_id = ? ORDER BY created_at ASC, id ASC`, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// 解析正文中@提到的用户，只保留可以查看任务的用户，不包括作者本人
+func resolveMentions(authorID, body string, todo *Todo) []string {
+	mentions := []string{}
+	seen := map[string]bool{authorID: true}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// 用户名后面的句号通常是句子的结尾
+		username := strings.TrimRight(match[1], ".")
+		user, err := FindUserByUsernameOrEmail(username)
+		if err != nil || user.Username != username || seen[user.ID] || !CanViewTodo(user.ID, todo) {
+			continue
+		}
+		seen[user.ID] = true
+		mentions = append(mentions, user.ID)
+	}
+	return mentions
+}
+
+// 通知评论中新提到的用户，通知失败只记录日志
+func notifyMentions(comment *Comment, todo *Todo, previous []string) {
+	notified := make(map[string]bool, len(previous))
+	for _, userID := range previous {
+		notified[userID] = true
+	}
+
+	author := comment.Username
+	if author == "" {
+		author = comment.UserID
+	}
+	for _, userID := range comment.Mentions {
+		if notified[userID] {
+			continue
+		}
+		err := SaveNotificationToDB(&Notification{
+			UserID: userID,
+			TodoID: todo.ID,
+			Title:  fmt.Sprintf("%s 在任务「%s」中提到了你", author, todo.Name),
+			Body:   comment.Body,
+		})
+		if err != nil {
+			log.Printf("发送评论提醒失败: %v", err)
+		}
+	}
+}
+
+// 校验评论正文
+func checkCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("评论内容不能为空")
+	}
+	if len([]rune(body)) > maxCommentBody {
+		return "", fmt.Errorf("评论不能超过%d个字符", maxCommentBody)
+	}
+	return body, nil
+}
+
+// CreateComment 在任务下发表评论，可以查看任务的用户都可以评论，被@提到的用户会收到通知
+func CreateComment(userID, todoID, body string) (*Comment, error) {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanViewTodo(userID, todo) {
+		return nil, errors.New("任务不存在或无权查看")
+	}
+	body, err = checkCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	comment := &Comment{
+		ID:        generateUUID(),
+		TodoID:    todoID,
+		UserID:    userID,
+		Body:      body,
+		Mentions:  resolveMentions(userID, body, todo),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if user, err := GetUserByID(userID); err == nil {
+		comment.Username = user.Username
+	}
+	if err := saveComment(comment); err != nil {
+		return nil, err
+	}
+
+	notifyMentions(comment, todo, nil)
+	return comment, nil
+}
+
+// UpdateComment 修改自己的评论，只通知修改后新提到的用户
+func UpdateComment(userID, commentID, body string) (*Comment, error) {
+	comment, err := GetCommentFromDB(commentID)
+	if err != nil || comment.Deleted || comment.UserID != userID {
+		return nil, errors.New("评论不存在或无权修改")
+	}
+	todo, err := GetTodoFromDB(comment.TodoID)
+	if err != nil || !CanViewTodo(userID, todo) {
+		return nil, errors.New("任务不存在或无权查看")
+	}
+	body, err = checkCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if body == comment.Body {
+		return comment, nil
+	}
+
+	previous := comment.Mentions
+	comment.Body = body
+	comment.Mentions = resolveMentions(userID, body, todo)
+	comment.Edited = true
+	comment.UpdatedAt = time.Now()
+	if err := saveComment(comment); err != nil {
+		return nil, err
+	}
+
+	notifyMentions(comment, todo, previous)
+	return comment, nil
+}
+
+// DeleteComment 删除评论：作者可以删除自己的评论，可以删除任务的用户可以删除任务下的任何评论
+// 删除后保留记录以便活动记录中显示“评论已删除”
+func DeleteComment(userID, commentID string) error {
+	comment, err := GetCommentFromDB(commentID)
+	if err != nil || comment.Deleted {
+		return errors.New("评论不存在")
+	}
+	if comment.UserID != userID {
+		todo, err := GetTodoFromDB(comment.TodoID)
+		if err != nil || !CanDeleteTodo(userID, todo) {
+			return errors.New("无权删除该评论")
+		}
+	}
+
+	_, err = db.Exec(`UPDATE comments SET body = '', mentions = '[]', deleted = 1, updated_at = ? WHERE id = ?`,
+		timeToString(time.Now()), commentID)
+	return err
+}
+
+// 活动记录的类型
+const (
+	ActivityComment = "comment"
+	ActivityEvent   = "event"
+)
+
+// 任务创建事件，不保存在历史记录中，根据任务的创建时间生成
+const activityCreated = "created"
+
+// ActivityItem 任务活动记录中的一条：评论或系统事件（创建、完成、重命名、分配、状态变更等）
+type ActivityItem struct {
+	Type      string    `json:"type"`
+	Action    string    `json:"action,omitempty"` // 系统事件的操作类型，与任务历史一致
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+	Comment   *Comment  `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetTodoActivity 获取任务的活动记录：评论和变更历史按时间正序合并
+func GetTodoActivity(todo *Todo) ([]ActivityItem, error) {
+	history, err := GetTodoHistoryFromDB(todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := GetTodoCommentsFromDB(todo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make(map[string]string)
+	username := func(userID string) string {
+		name, ok := usernames[userID]
+		if !ok {
+			if user, err := GetUserByID(userID); err == nil {
+				name = user.Username
+			}
+			usernames[userID] = name
+		}
+		return name
+	}
+
+	items := []ActivityItem{{
+		Type:      ActivityEvent,
+		Action:    activityCreated,
+		UserID:    todo.UserID,
+		Username:  username(todo.UserID),
+		CreatedAt: todo.CreateAt,
+	}}
+	for _, record := range history {
+		items = append(items, ActivityItem{
+			Type:      ActivityEvent,
+			Action:    record.Action,
+			UserID:    record.UserID,
+			Username:  username(record.UserID),
+			OldValue:  record.OldValue,
+			NewValue:  record.NewValue,
+			CreatedAt: record.CreatedAt,
+		})
+	}
+	for i := range comments {
+		items = append(items, ActivityItem{
+			Type:      ActivityComment,
+			UserID:    comments[i].UserID,
+			Username:  comments[i].Username,
+			Comment:   &comments[i],
+			CreatedAt: comments[i].CreatedAt,
+		})
+	}
+
+	// 时间相同时保持创建事件、历史记录、评论的顺序
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items, nil
+}
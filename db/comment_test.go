@@ -0,0 +1,60 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 获取用户收到的通知数量
+func countTestNotifications(t *testing.T, userID string) int {
+	t.Helper()
+
+	notifications, err := GetUserNotificationsFromDB(userID, false, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(notifications)
+}
+
+func TestCommentMentionsOnlyUsersWhoCanView(t *testing.T) {
+	setupTestDB(t)
+	addTestUsers(t, "alice", "bob", "carol", "dave")
+
+	list, err := CreateList("alice", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "bob", ListRoleViewer)
+	addTestListMember(t, list.ID, "dave", ListRoleEditor)
+	todo := createTestTodo(t, "alice", list.ID, "共享任务")
+
+	// carol不是清单成员，作者本人和重复提到的用户只保留一次
+	comment, err := CreateComment("alice", todo.ID, "@bob @carol @alice 请看一下，@bob.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(comment.Mentions, []string{"bob"}) {
+		t.Errorf("只应该提到可以查看任务的用户，实际为 %v", comment.Mentions)
+	}
+	if countTestNotifications(t, "bob") != 1 || countTestNotifications(t, "carol") != 0 {
+		t.Error("只有可以查看任务的用户应该收到通知")
+	}
+
+	// 邮箱地址中的@不是提到用户
+	if comment, err = UpdateComment("alice", comment.ID, "@bob @dave 发到 carol@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(comment.Mentions, []string{"bob", "dave"}) {
+		t.Errorf("修改后提到的用户不正确: %v", comment.Mentions)
+	}
+	if countTestNotifications(t, "bob") != 1 || countTestNotifications(t, "dave") != 1 || countTestNotifications(t, "carol") != 0 {
+		t.Error("修改评论时只应该通知新提到的用户")
+	}
+
+	if _, err := CreateComment("carol", todo.ID, "@alice"); err == nil {
+		t.Error("无权查看任务的用户不应该可以评论")
+	}
+	if _, err := UpdateComment("bob", comment.ID, "改掉"); err == nil {
+		t.Error("不应该可以修改其他用户的评论")
+	}
+}
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CustomFieldType 自定义字段的类型
+type CustomFieldType string
+
+// 自定义字段类型取值
+const (
+	FieldText        CustomFieldType = "text"
+	FieldNumber      CustomFieldType = "number"
+	FieldDate        CustomFieldType = "date"
+	FieldSelect      CustomFieldType = "select"
+	FieldMultiSelect CustomFieldType = "multi_select"
+	FieldCheckbox    CustomFieldType = "checkbox"
+)
+
+// 自定义字段的数量和长度限制
+const (
+	maxCustomFields       = 30
+	maxCustomFieldName    = 50
+	maxCustomFieldOptions = 100
+	maxCustomFieldOption  = 100
+	maxCustomFieldText    = 1000
+)
+
+// 字段标识：小写字母开头，只包含小写字母、数字和下划线，用于保存值和查询
+var customFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CustomField 项目中定义的自定义字段，单选和多选字段需要提供选项
+type CustomField struct {
+	Key     string          `json:"key"` // 字段标识，不传时自动生成
+	Name    string          `json:"name"`
+	Type    CustomFieldType `json:"type"`
+	Options []string        `json:"options,omitempty"`
+}
+
+// 是否为字段的选项
+func (f *CustomField) hasOption(option string) bool {
+	for _, o := range f.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验并规范化项目的自定义字段定义，传入空列表表示删除所有字段
+func applyProjectCustomFields(project *Project) error {
+	if project.CustomFields == nil {
+		return nil
+	}
+	if len(project.CustomFields) > maxCustomFields {
+		return fmt.Errorf("项目最多包含%d个自定义字段", maxCustomFields)
+	}
+
+	keys := make(map[string]bool)
+	for i := range project.CustomFields {
+		if key := project.CustomFields[i].Key; key != "" {
+			if !customFieldKeyPattern.MatchString(key) {
+				return fmt.Errorf("无效的字段标识%s，只能包含小写字母、数字和下划线且以字母开头", key)
+			}
+			if keys[key] {
+				return fmt.Errorf("重复的字段标识: %s", key)
+			}
+			keys[key] = true
+		}
+	}
+
+	for i := range project.CustomFields {
+		field := &project.CustomFields[i]
+		if field.Key == "" {
+			for n := i + 1; field.Key == "" || keys[field.Key]; n++ {
+				field.Key = fmt.Sprintf("field_%d", n)
+			}
+			keys[field.Key] = true
+		}
+
+		field.Name = strings.TrimSpace(field.Name)
+		if field.Name == "" {
+			return fmt.Errorf("字段%s的名称不能为空", field.Key)
+		}
+		if len([]rune(field.Name)) > maxCustomFieldName {
+			return fmt.Errorf("字段名称不能超过%d个字符", maxCustomFieldName)
+		}
+
+		switch field.Type {
+		case FieldText, FieldNumber, FieldDate, FieldCheckbox:
+			if len(field.Options) > 0 {
+				return fmt.Errorf("只有单选和多选字段可以设置选项: %s", field.Name)
+			}
+		case FieldSelect, FieldMultiSelect:
+			if err := normalizeFieldOptions(field); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("无效的字段类型: %s，可选值为text、number、date、select、multi_select、checkbox", field.Type)
+		}
+	}
+	return nil
+}
+
+// 规范化选项：去掉首尾空白，不能为空或重复
+func normalizeFieldOptions(field *CustomField) error {
+	if len(field.Options) == 0 {
+		return fmt.Errorf("字段%s需要至少一个选项", field.Name)
+	}
+	if len(field.Options) > maxCustomFieldOptions {
+		return fmt.Errorf("字段%s最多包含%d个选项", field.Name, maxCustomFieldOptions)
+	}
+	seen := make(map[string]bool)
+	for i, option := range field.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return fmt.Errorf("字段%s的选项不能为空", field.Name)
+		}
+		if len([]rune(option)) > maxCustomFieldOption {
+			return fmt.Errorf("选项不能超过%d个字符", maxCustomFieldOption)
+		}
+		if seen[option] {
+			return fmt.Errorf("字段%s的选项重复: %s", field.Name, option)
+		}
+		seen[option] = true
+		field.Options[i] = option
+	}
+	return nil
+}
+
+// 自定义字段定义保存到数据库的内容，没有字段时保存为空字符串
+func customFieldsToString(fields []CustomField) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(fields)
+	return string(data), err
+}
+
+// 从数据库读取自定义字段定义
+func stringToCustomFields(s string) ([]CustomField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var fields []CustomField
+	err := json.Unmarshal([]byte(s), &fields)
+	return fields, err
+}
+
+// 任务的自定义字段值保存到数据库的内容
+func customValuesToString(values map[string]interface{}) string {
+	if len(values) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// 从数据库读取任务的自定义字段值
+func stringToCustomValues(s string) map[string]interface{} {
+	values := make(map[string]interface{})
+	if s != "" {
+		json.Unmarshal([]byte(s), &values)
+	}
+	return values
+}
+
+// 校验并规范化一个字段的值，返回nil表示清除该字段的值
+func normalizeFieldValue(field *CustomField, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("字段%s的值无效，需要%s", field.Name, fieldTypeDescription(field.Type))
+
+	switch field.Type {
+	case FieldText:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		if len([]rune(s)) > maxCustomFieldText {
+			return nil, fmt.Errorf("字段%s不能超过%d个字符", field.Name, maxCustomFieldText)
+		}
+		return s, nil
+
+	case FieldNumber:
+		n, ok := value.(float64)
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, invalid
+		}
+		return n, nil
+
+	case FieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if s == "" {
+			return nil, nil
+		}
+		if _, err := time.Parse(deadlineDateLayout, s); err != nil {
+			return nil, invalid
+		}
+		return s, nil
+
+	case FieldSelect:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if s == "" {
+			return nil, nil
+		}
+		if !field.hasOption(s) {
+			return nil, fmt.Errorf("字段%s没有选项%s", field.Name, s)
+		}
+		return s, nil
+
+	case FieldMultiSelect:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, invalid
+		}
+		selected := []interface{}{}
+		seen := make(map[string]bool)
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, invalid
+			}
+			if !field.hasOption(s) {
+				return nil, fmt.Errorf("字段%s没有选项%s", field.Name, s)
+			}
+			if !seen[s] {
+				seen[s] = true
+				selected = append(selected, s)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, nil
+		}
+		return selected, nil
+
+	case FieldCheckbox:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		return b, nil
+	}
+	return nil, invalid
+}
+
+func fieldTypeDescription(t CustomFieldType) string {
+	switch t {
+	case FieldText:
+		return "文字"
+	case FieldNumber:
+		return "数字"
+	case FieldDate:
+		return "2006-01-02格式的日期"
+	case FieldSelect:
+		return "一个选项"
+	case FieldMultiSelect:
+		return "选项列表"
+	case FieldCheckbox:
+		return "true或false"
+	}
+	return string(t)
+}
+
+// 任务所属项目的自定义字段定义
+func customFieldsForTodo(todo *Todo) ([]CustomField, error) {
+	if todo.ProjectID == "" {
+		return nil, nil
+	}
+	project, err := GetProjectFromDB(todo.ProjectID)
+	if err == errProjectNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return project.CustomFields, nil
+}
+
+// ApplyTodoCustomFields 按所属项目的字段定义校验任务的自定义字段值
+// 项目中没有定义的字段（例如移动到其他项目后）直接忽略，值为null表示清除
+func ApplyTodoCustomFields(todo *Todo) error {
+	fields, err := customFieldsForTodo(todo)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	for i := range fields {
+		value, err := normalizeFieldValue(&fields[i], todo.CustomFields[fields[i].Key])
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			values[fields[i].Key] = value
+		}
+	}
+	todo.CustomFields = values
+	return nil
+}
+
+// MergeCustomFieldValues 将修改合并到原有的字段值中，值为null表示清除该字段，不修改原有的map
+func MergeCustomFieldValues(values, changes map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(values)+len(changes))
+	for key, value := range values {
+		merged[key] = value
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// 字段定义变更后，清除项目任务中已删除字段的值和不再符合定义的值
+func pruneProjectCustomValues(project *Project) error {
+	rows, err := db.Query(`SELECT id, custom_fields FROM todos WHERE project_id = ? AND custom_fields != '{}'`, project.ID)
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]string)
+	for rows.Next() {
+		var todoID, valuesStr string
+		if err := rows.Scan(&todoID, &valuesStr); err != nil {
+			rows.Close()
+			return err
+		}
+
+		values := stringToCustomValues(valuesStr)
+		pruned := make(map[string]interface{})
+		for i := range project.CustomFields {
+			field := &project.CustomFields[i]
+			value := values[field.Key]
+			// 多选字段只去掉已删除的选项
+			if items, ok := value.([]interface{}); ok && field.Type == FieldMultiSelect {
+				var kept []interface{}
+				for _, item := range items {
+					if s, ok := item.(string); ok && field.hasOption(s) {
+						kept = append(kept, item)
+					}
+				}
+				value = kept
+			}
+			if value, err := normalizeFieldValue(field, value); err == nil && value != nil {
+				pruned[field.Key] = value
+			}
+		}
+		if s := customValuesToString(pruned); s != customValuesToString(values) {
+			changed[todoID] = s
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	now := timeToString(project.UpdatedAt)
+	for todoID, valuesStr := range changed {
+		_, err := db.Exec(`UPDATE todos SET custom_fields = ?, updated_at = ? WHERE id = ?`, valuesStr, now, todoID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 查询和排序中的自定义字段名前缀，例如cf.severity
+const customFieldPrefix = "cf."
+
+// 解析查询或排序中的自定义字段名，返回字段标识
+func parseCustomFieldName(name string) (string, bool) {
+	if !strings.HasPrefix(name, customFieldPrefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(name, customFieldPrefix)
+	return key, customFieldKeyPattern.MatchString(key)
+}
+
+// 自定义字段的排序值：数字、文字和日期按值排序，多选按JSON文本排序，复选框按0和1排序
+func customFieldSortValue(todo *Todo, key string) interface{} {
+	switch value := todo.CustomFields[key].(type) {
+	case nil:
+		return ""
+	case bool:
+		return boolToInt(value)
+	case []interface{}:
+		data, _ := json.Marshal(value)
+		return string(data)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyProjectCustomFields(t *testing.T) {
+	setupTestDB(t)
+
+	for name, fields := range map[string][]CustomField{
+		"无效的字段标识": {{Key: "Severity", Name: "严重程度", Type: FieldText}},
+		"重复的字段标识": {{Key: "a", Name: "A", Type: FieldText}, {Key: "a", Name: "B", Type: FieldText}},
+		"名称为空":    {{Name: " ", Type: FieldText}},
+		"无效的类型":   {{Name: "A", Type: "color"}},
+		"单选没有选项":  {{Name: "A", Type: FieldSelect}},
+		"选项重复":    {{Name: "A", Type: FieldSelect, Options: []string{"x", " x "}}},
+		"文字字段有选项": {{Name: "A", Type: FieldText, Options: []string{"x"}}},
+	} {
+		if err := CreateProject("alice", &Project{Name: name, CustomFields: fields}); err == nil {
+			t.Errorf("%s应该报错", name)
+		}
+	}
+
+	// 没有标识的字段自动生成不重复的标识
+	project := &Project{Name: "项目", CustomFields: []CustomField{
+		{Name: "A", Type: FieldText},
+		{Key: "field_2", Name: "B", Type: FieldNumber},
+		{Name: "C", Type: FieldSelect, Options: []string{" 低 ", "高"}},
+	}}
+	if err := CreateProject("alice", project); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, field := range project.CustomFields {
+		keys = append(keys, field.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"field_1", "field_2", "field_3"}) {
+		t.Errorf("自动生成的字段标识不正确: %v", keys)
+	}
+	if project.CustomFields[2].Options[0] != "低" {
+		t.Errorf("选项应该去掉首尾空白: %q", project.CustomFields[2].Options[0])
+	}
+}
+
+// 创建带自定义字段的项目
+func createTestCustomFieldProject(t *testing.T) *Project {
+	t.Helper()
+
+	project := &Project{Name: "缺陷", CustomFields: []CustomField{
+		{Key: "severity", Name: "严重程度", Type: FieldSelect, Options: []string{"low", "high"}},
+		{Key: "platforms", Name: "平台", Type: FieldMultiSelect, Options: []string{"ios", "android", "web"}},
+		{Key: "note", Name: "备注", Type: FieldText},
+		{Key: "points", Name: "点数", Type: FieldNumber},
+		{Key: "due", Name: "日期", Type: FieldDate},
+		{Key: "verified", Name: "已验证", Type: FieldCheckbox},
+	}}
+	if err := CreateProject("alice", project); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+func TestApplyTodoCustomFields(t *testing.T) {
+	setupTestDB(t)
+	project := createTestCustomFieldProject(t)
+
+	todo := &Todo{ProjectID: project.ID, CustomFields: map[string]interface{}{
+		"severity":  "high",
+		"platforms": []interface{}{"ios", "web", "ios"},
+		"note":      "  ",
+		"points":    3.0,
+		"due":       "2026-10-18",
+		"verified":  false,
+		"unknown":   "忽略",
+	}}
+	if err := ApplyTodoCustomFields(todo); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"severity":  "high",
+		"platforms": []interface{}{"ios", "web"},
+		"points":    3.0,
+		"due":       "2026-10-18",
+		"verified":  false,
+	}
+	if !reflect.DeepEqual(todo.CustomFields, want) {
+		t.Errorf("规范化后的字段值不正确: %v", todo.CustomFields)
+	}
+
+	for name, values := range map[string]map[string]interface{}{
+		"不存在的选项":  {"severity": "medium"},
+		"多选不是列表":  {"platforms": "ios"},
+		"数字不是数字":  {"points": "3"},
+		"无效的日期":   {"due": "18/10/2026"},
+		"复选框不是布尔": {"verified": "yes"},
+	} {
+		todo := &Todo{ProjectID: project.ID, CustomFields: values}
+		if err := ApplyTodoCustomFields(todo); err == nil {
+			t.Errorf("%s应该报错", name)
+		}
+	}
+
+	merged := MergeCustomFieldValues(want, map[string]interface{}{"severity": nil, "note": "新的"})
+	if _, ok := merged["severity"]; ok || merged["note"] != "新的" || want["severity"] != "high" {
+		t.Errorf("合并字段值不正确: %v，原有的值 %v", merged, want)
+	}
+}
+
+func TestPruneProjectCustomValues(t *testing.T) {
+	setupTestDB(t)
+	project := createTestCustomFieldProject(t)
+
+	todo := createTestTodo(t, "alice", "", "缺陷")
+	todo.ProjectID = project.ID
+	todo.CustomFields = map[string]interface{}{
+		"severity":  "high",
+		"platforms": []interface{}{"ios", "web"},
+		"note":      "备注",
+		"points":    2.0,
+	}
+	if err := ApplyTodoCustomFields(todo); err != nil {
+		t.Fatal(err)
+	}
+	todo.UpdateAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除high和web选项，备注改为数字，删除点数字段
+	project.CustomFields = []CustomField{
+		{Key: "severity", Name: "严重程度", Type: FieldSelect, Options: []string{"low"}},
+		{Key: "platforms", Name: "平台", Type: FieldMultiSelect, Options: []string{"ios", "android"}},
+		{Key: "note", Name: "备注", Type: FieldNumber},
+	}
+	if err := UpdateProject("alice", project); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := GetTodoFromDB(todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"platforms": []interface{}{"ios"}}
+	if !reflect.DeepEqual(saved.CustomFields, want) {
+		t.Errorf("字段定义变更后应该清除无效的值，实际为 %v", saved.CustomFields)
+	}
+	if !saved.UpdateAt.After(todo.UpdateAt) {
+		t.Error("清除字段值后应该更新任务的修改时间，以便客户端同步")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -45,83 +46,759 @@ func InitDatabase() error {
 		return fmt.Errorf("创建表失败: %v", err)
 	}
 
+	// 将旧版本的分类字符串迁移为项目
+	err = MigrateCategoriesToProjects()
+	if err != nil {
+		return fmt.Errorf("迁移分类失败: %v", err)
+	}
+
+	// 将旧版本自由格式的截止时间转换为统一格式
+	err = MigrateDeadlines()
+	if err != nil {
+		return fmt.Errorf("迁移截止时间失败: %v", err)
+	}
+
+	// 将旧版本自由填写的优先级转换为固定的取值
+	err = MigratePriorities()
+	if err != nil {
+		return fmt.Errorf("迁移优先级失败: %v", err)
+	}
+
+	// 为旧版本的任务生成手动排序位置
+	err = MigratePositions()
+	if err != nil {
+		return fmt.Errorf("迁移排序位置失败: %v", err)
+	}
+
+	// 根据完成标记设置旧版本任务的状态
+	err = MigrateStatuses()
+	if err != nil {
+		return fmt.Errorf("迁移任务状态失败: %v", err)
+	}
+
+	// 为旧版本的彻底删除记录补充需要通知的用户
+	err = MigratePurgedTodoUsers()
+	if err != nil {
+		return fmt.Errorf("迁移彻底删除记录失败: %v", err)
+	}
+
+	// 创建任务的全文索引
+	err = initSearchIndex()
+	if err != nil {
+		return fmt.Errorf("创建全文索引失败: %v", err)
+	}
+
+	// 附件内容保存在数据目录中，清理上次运行时没有删除的内容
+	store, err := NewLocalBlobStore("./data/blobs")
+	if err != nil {
+		return err
+	}
+	SetBlobStore(store)
+	removed, err := CleanupOrphanedBlobs()
+	if err != nil {
+		return fmt.Errorf("清理附件内容失败: %v", err)
+	}
+	if removed > 0 {
+		log.Printf("清理了 %d 个没有引用的附件内容", removed)
+	}
+
 	log.Println("数据库初始化成功")
 	return nil
 }
 
-// createTables 创建数据库表
-func createTables() error {
-	// 创建用户表
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		username TEXT UNIQUE NOT NULL,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		created_at TEXT NOT NULL
-	);
-	`
+// createTables 创建数据库表
+func createTables() error {
+	// 创建用户表
+	userTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT UNIQUE NOT NULL,
+		password TEXT NOT NULL,
+		email TEXT UNIQUE NOT NULL,
+		role TEXT NOT NULL DEFAULT 'user',
+		disabled INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	`
+
+	// 创建设备表
+	deviceTable := `
+	CREATE TABLE IF NOT EXISTS devices (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		device_id TEXT NOT NULL,
+		last_seen TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		UNIQUE(user_id, device_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`
+
+	// 创建任务表
+	todoTable := `
+	CREATE TABLE IF NOT EXISTS todos (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		device_id TEXT,
+		name TEXT NOT NULL,
+		description TEXT,
+		completed INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		deadline TEXT,
+		category TEXT,
+		priority TEXT,
+		list_id TEXT NOT NULL DEFAULT '',
+		assignee_id TEXT NOT NULL DEFAULT '',
+		project_id TEXT NOT NULL DEFAULT '',
+		parent_id TEXT NOT NULL DEFAULT '',
+		recurrence TEXT NOT NULL DEFAULT '',
+		time_zone TEXT NOT NULL DEFAULT '',
+		series_id TEXT NOT NULL DEFAULT '',
+		occurrence_index INTEGER DEFAULT 0,
+		due_at TEXT NOT NULL DEFAULT '',
+		priority_rank INTEGER DEFAULT 0,
+		position TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		estimate REAL DEFAULT 0,
+		estimate_unit TEXT NOT NULL DEFAULT '',
+		custom_fields TEXT NOT NULL DEFAULT '{}',
+		archived_at TEXT NOT NULL DEFAULT '',
+		deleted_at TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`
+
+	// 创建共享清单表
+	listTable := `
+	CREATE TABLE IF NOT EXISTS lists (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		owner_id TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+
+	// 创建清单成员表
+	listMemberTable := `
+	CREATE TABLE IF NOT EXISTS list_members (
+		list_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		joined_at TEXT NOT NULL,
+		PRIMARY KEY (list_id, user_id),
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE
+	);
+	`
+
+	// 创建清单邀请表
+	listInvitationTable := `
+	CREATE TABLE IF NOT EXISTS list_invitations (
+		id TEXT PRIMARY KEY,
+		list_id TEXT NOT NULL,
+		inviter_id TEXT NOT NULL,
+		invitee_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE
+	);
+	`
+
+	// 执行建表语句
+	_, err := db.Exec(userTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(deviceTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(todoTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(listTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(listMemberTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(listInvitationTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务历史表
+	todoHistoryTable := `
+	CREATE TABLE IF NOT EXISTS todo_history (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		old_value TEXT NOT NULL DEFAULT '',
+		new_value TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(todoHistoryTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建项目表
+	projectTable := `
+	CREATE TABLE IF NOT EXISTS projects (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		list_id TEXT NOT NULL DEFAULT '',
+		parent_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		color TEXT NOT NULL DEFAULT '',
+		icon TEXT NOT NULL DEFAULT '',
+		archived INTEGER DEFAULT 0,
+		sort_order INTEGER DEFAULT 0,
+		workflow TEXT NOT NULL DEFAULT '',
+		custom_fields TEXT NOT NULL DEFAULT '',
+		deleted INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(projectTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建标签表
+	tagTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		list_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		color TEXT NOT NULL DEFAULT '',
+		deleted INTEGER DEFAULT 0,
+		merged_into TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(tagTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务标签关联表
+	todoTagTable := `
+	CREATE TABLE IF NOT EXISTS todo_tags (
+		todo_id TEXT NOT NULL,
+		tag_id TEXT NOT NULL,
+		PRIMARY KEY (todo_id, tag_id)
+	);
+	`
+	_, err = db.Exec(todoTagTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务依赖表：todo_id被blocker_id阻塞
+	todoDependencyTable := `
+	CREATE TABLE IF NOT EXISTS todo_dependencies (
+		todo_id TEXT NOT NULL,
+		blocker_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (todo_id, blocker_id)
+	);
+	`
+	_, err = db.Exec(todoDependencyTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建提醒表
+	reminderTable := `
+	CREATE TABLE IF NOT EXISTS reminders (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		relative INTEGER DEFAULT 0,
+		offset_minutes INTEGER DEFAULT 0,
+		remind_at TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		fired_at TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(reminderTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建应用内通知表
+	notificationTable := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		todo_id TEXT NOT NULL DEFAULT '',
+		reminder_id TEXT NOT NULL DEFAULT '',
+		title TEXT NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		read INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(notificationTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建保存的过滤条件表
+	savedFilterTable := `
+	CREATE TABLE IF NOT EXISTS saved_filters (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		icon TEXT NOT NULL DEFAULT '',
+		query TEXT NOT NULL DEFAULT '{}',
+		sort_order INTEGER DEFAULT 0,
+		deleted INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(savedFilterTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务评论表，mentions为被提到的用户ID的JSON数组
+	commentTable := `
+	CREATE TABLE IF NOT EXISTS comments (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		mentions TEXT NOT NULL DEFAULT '[]',
+		edited INTEGER DEFAULT 0,
+		deleted INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(commentTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建附件表，blob_hash为内容的SHA-256，多个附件可以引用相同的内容
+	attachmentTable := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		blob_hash TEXT NOT NULL,
+		name TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(attachmentTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建计时记录表，stopped_at为空表示计时器正在运行
+	timeEntryTable := `
+	CREATE TABLE IF NOT EXISTS time_entries (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		todo_id TEXT NOT NULL,
+		device_id TEXT NOT NULL DEFAULT '',
+		started_at TEXT NOT NULL,
+		stopped_at TEXT NOT NULL DEFAULT '',
+		duration INTEGER DEFAULT 0,
+		note TEXT NOT NULL DEFAULT '',
+		deleted INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(timeEntryTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务模板表，items为模板中任务的JSON
+	templateTable := `
+	CREATE TABLE IF NOT EXISTS templates (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		list_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		items TEXT NOT NULL DEFAULT '[]',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(templateTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建彻底删除的任务记录表，同步时通知客户端删除本地副本
+	purgedTodoTable := `
+	CREATE TABLE IF NOT EXISTS purged_todos (
+		todo_id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		list_id TEXT NOT NULL DEFAULT '',
+		assignee_id TEXT NOT NULL DEFAULT '',
+		purged_at TEXT NOT NULL
+	);
+	`
+	_, err = db.Exec(purgedTodoTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建彻底删除的任务需要通知的用户表，记录删除时可以访问任务的用户
+	purgedTodoUserTable := `
+	CREATE TABLE IF NOT EXISTS purged_todo_users (
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		PRIMARY KEY (todo_id, user_id)
+	);
+	`
+	_, err = db.Exec(purgedTodoUserTable)
+	if err != nil {
+		return err
+	}
+
+	// 创建任务访问撤销记录表：用户被移出共享清单或清单被删除时记录，同步时通知该用户的设备删除本地副本
+	todoRevocationTable := `
+	CREATE TABLE IF NOT EXISTS todo_revocations (
+		todo_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		revoked_at TEXT NOT NULL,
+		PRIMARY KEY (todo_id, user_id)
+	);
+	`
+	_, err = db.Exec(todoRevocationTable)
+	if err != nil {
+		return err
+	}
+
+	// 为旧版本数据库补充新增的列
+	err = migrateTables()
+	if err != nil {
+		return err
+	}
+
+	// 创建索引以提高查询性能
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_user_id ON todos(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_updated_at ON todos(updated_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_list_id ON todos(list_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_assignee_id ON todos(assignee_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_project_id ON todos(project_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_priority_rank ON todos(priority_rank)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_due_at ON todos(due_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_series_id ON todos(series_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_position ON todos(list_id, project_id, parent_id, position)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(project_id, status)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos(deleted_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_purged_todos_purged_at ON purged_todos(purged_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_purged_todo_users_user_id ON purged_todo_users(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todo_revocations_user_id ON todo_revocations(user_id, revoked_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_projects_user_id ON projects(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_projects_list_id ON projects(list_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todo_tags_tag_id ON todo_tags(tag_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todo_dependencies_blocker_id ON todo_dependencies(blocker_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_tags_user_id ON tags(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_reminders_status_remind_at ON reminders(status, remind_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_reminders_todo_id ON reminders(todo_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_saved_filters_user_id ON saved_filters(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_comments_todo_id ON comments(todo_id, created_at)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_attachments_todo_id ON attachments(todo_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_attachments_blob_hash ON attachments(blob_hash)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_time_entries_todo_id ON time_entries(todo_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_time_entries_user_id ON time_entries(user_id, updated_at)")
+	if err != nil {
+		return err
+	}
+
+	// 每个用户最多只有一个正在运行的计时器
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entries_running ON time_entries(user_id) WHERE stopped_at = '' AND deleted = 0")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todo_history_todo_id ON todo_history(todo_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_list_members_user_id ON list_members(user_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_list_invitations_invitee_id ON list_invitations(invitee_id)")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrateTables 为已存在的旧表补充后续版本新增的列
+func migrateTables() error {
+	err := addColumnIfNotExists("users", "role", "TEXT NOT NULL DEFAULT 'user'")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("users", "disabled", "INTEGER DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "list_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "assignee_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "project_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "parent_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "recurrence", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "time_zone", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "series_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "occurrence_index", "INTEGER DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "due_at", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "priority_rank", "INTEGER DEFAULT 0")
+	if err != nil {
+		return err
+	}
 
-	// 创建设备表
-	deviceTable := `
-	CREATE TABLE IF NOT EXISTS devices (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		name TEXT NOT NULL,
-		device_id TEXT NOT NULL,
-		last_seen TEXT NOT NULL,
-		created_at TEXT NOT NULL,
-		UNIQUE(user_id, device_id),
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
+	err = addColumnIfNotExists("todos", "position", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
 
-	// 创建任务表
-	todoTable := `
-	CREATE TABLE IF NOT EXISTS todos (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		device_id TEXT,
-		name TEXT NOT NULL,
-		description TEXT,
-		completed INTEGER DEFAULT 0,
-		created_at TEXT NOT NULL,
-		updated_at TEXT NOT NULL,
-		deadline TEXT,
-		category TEXT,
-		priority TEXT,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
+	err = addColumnIfNotExists("todos", "status", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
 
-	// 执行建表语句
-	_, err := db.Exec(userTable)
+	err = addColumnIfNotExists("todos", "estimate", "REAL DEFAULT 0")
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(deviceTable)
+	err = addColumnIfNotExists("todos", "estimate_unit", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(todoTable)
+	err = addColumnIfNotExists("projects", "workflow", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
 
-	// 创建索引以提高查询性能
-	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_user_id ON todos(user_id)")
+	err = addColumnIfNotExists("todos", "custom_fields", "TEXT NOT NULL DEFAULT '{}'")
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_todos_updated_at ON todos(updated_at)")
+	err = addColumnIfNotExists("projects", "custom_fields", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id)")
+	err = addColumnIfNotExists("todos", "archived_at", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfNotExists("todos", "deleted_at", "TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return err
 	}
@@ -129,6 +806,34 @@ func createTables() error {
 	return nil
 }
 
+// addColumnIfNotExists 当表中不存在指定列时添加该列
+func addColumnIfNotExists(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 // CloseDatabase 关闭数据库连接
 func CloseDatabase() error {
 	if db != nil {
@@ -142,6 +847,26 @@ func timeToString(t time.Time) string {
 	return t.Format(time.RFC3339)
 }
 
+// 时间指针转换为字符串，nil保存为空字符串
+func timePtrToString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return timeToString(*t)
+}
+
+// 空字符串转换为nil
+func stringToTimePtr(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := stringToTime(s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // 将字符串转换为time.Time
 func stringToTime(s string) (time.Time, error) {
 	return time.Parse(time.RFC3339, s)
@@ -150,32 +875,39 @@ func stringToTime(s string) (time.Time, error) {
 // 保存用户到数据库
 func SaveUserToDB(user *User) error {
 	query := `
-	INSERT OR REPLACE INTO users (id, username, password, email, created_at)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT OR REPLACE INTO users (id, username, password, email, role, disabled, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.Exec(query, user.ID, user.Username, user.Password, user.Email, timeToString(user.CreatedAt))
+	_, err := db.Exec(query,
+		user.ID, user.Username, user.Password, user.Email,
+		user.Role, boolToInt(user.Disabled), timeToString(user.CreatedAt),
+	)
 	return err
 }
 
 // 从数据库获取用户
 func GetUserFromDB(userID string) (*User, error) {
 	query := `
-	SELECT id, username, password, email, created_at
+	SELECT id, username, password, email, role, disabled, created_at
 	FROM users
 	WHERE id = ?
 	`
 
 	var user User
+	var disabledInt int
 	var createdAtStr string
 
 	err := db.QueryRow(query, userID).Scan(
-		&user.ID, &user.Username, &user.Password, &user.Email, &createdAtStr,
+		&user.ID, &user.Username, &user.Password, &user.Email,
+		&user.Role, &disabledInt, &createdAtStr,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	user.Disabled = intToBool(disabledInt)
+
 	user.CreatedAt, err = stringToTime(createdAtStr)
 	if err != nil {
 		return nil, err
@@ -187,22 +919,26 @@ func GetUserFromDB(userID string) (*User, error) {
 // 根据用户名获取用户
 func GetUserByUsernameFromDB(username string) (*User, error) {
 	query := `
-	SELECT id, username, password, email, created_at
+	SELECT id, username, password, email, role, disabled, created_at
 	FROM users
 	WHERE username = ?
 	`
 
 	var user User
+	var disabledInt int
 	var createdAtStr string
 
 	err := db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.Password, &user.Email, &createdAtStr,
+		&user.ID, &user.Username, &user.Password, &user.Email,
+		&user.Role, &disabledInt, &createdAtStr,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	user.Disabled = intToBool(disabledInt)
+
 	user.CreatedAt, err = stringToTime(createdAtStr)
 	if err != nil {
 		return nil, err
@@ -301,33 +1037,62 @@ func GetUserDevicesFromDB(userID string) ([]Device, error) {
 	return devices, nil
 }
 
-// 保存任务到数据库
-func SaveTodoToDB(todo *Todo) error {
-	query := `
-	INSERT OR REPLACE INTO todos (
-		id, user_id, device_id, name, description, completed,
-		created_at, updated_at, deadline, category, priority
-	)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	_, err := db.Exec(query,
-		todo.ID, todo.UserID, todo.DeviceID, todo.Name, todo.Description, boolToInt(todo.Completed),
-		timeToString(todo.CreateAt), timeToString(todo.UpdateAt), todo.DeadLine, todo.Category, todo.Priority,
-	)
-	return err
+// 任务表的列，与scanTodo和todoValues的顺序保持一致
+const todoColumns = `id, user_id, device_id, list_id, assignee_id, project_id, parent_id, name, description, completed,
+	       created_at, updated_at, deadline, due_at, category, priority, priority_rank, recurrence, time_zone, series_id, occurrence_index, position, status,
+	       estimate, estimate_unit, custom_fields, archived_at, deleted_at`
+
+// 用户可访问的任务：自己的个人任务、用户所在共享清单中的任务或分配给用户的任务
+// 使用时需要传入三次用户ID
+const accessibleTodoCondition = `((list_id = '' AND user_id = ?) OR list_id IN (SELECT list_id FROM list_members WHERE user_id = ?) OR assignee_id = ?)`
+
+// rowScanner 统一*sql.Row和*sql.Rows的扫描接口
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// 从数据库获取用户的所有任务
-func GetUserTodosFromDB(userID string) ([]Todo, error) {
-	query := `
-	SELECT id, user_id, device_id, name, description, completed,
-	       created_at, updated_at, deadline, category, priority
-	FROM todos
-	WHERE user_id = ?
-	ORDER BY updated_at DESC
-	`
+// 扫描一行任务数据
+func scanTodo(scanner rowScanner) (Todo, error) {
+	var todo Todo
+	var completedInt int
+	var createdAtStr, updatedAtStr, deadlineStr, dueAtStr, customFieldsStr, archivedAtStr, deletedAtStr string
+	var priorityRank int
+
+	err := scanner.Scan(
+		&todo.ID, &todo.UserID, &todo.DeviceID, &todo.ListID, &todo.AssigneeID, &todo.ProjectID, &todo.ParentID,
+		&todo.Name, &todo.Description, &completedInt,
+		&createdAtStr, &updatedAtStr, &deadlineStr, &dueAtStr, &todo.Category, &todo.Priority, &priorityRank,
+		&todo.Recurrence, &todo.TimeZone, &todo.SeriesID, &todo.OccurrenceIndex, &todo.Position, &todo.Status,
+		&todo.Estimate, &todo.EstimateUnit, &customFieldsStr, &archivedAtStr, &deletedAtStr,
+	)
+	if err != nil {
+		return todo, err
+	}
 
-	rows, err := db.Query(query, userID)
+	todo.Completed = intToBool(completedInt)
+	todo.DeadLine = loadDeadline(deadlineStr, todo.TimeZone)
+	todo.CustomFields = stringToCustomValues(customFieldsStr)
+	todo.CreateAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return todo, err
+	}
+
+	todo.UpdateAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return todo, err
+	}
+
+	todo.ArchivedAt, err = stringToTimePtr(archivedAtStr)
+	if err != nil {
+		return todo, err
+	}
+	todo.DeletedAt, err = stringToTimePtr(deletedAtStr)
+	return todo, err
+}
+
+// 执行任务查询并扫描所有结果
+func queryTodos(query string, args ...interface{}) ([]Todo, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -335,90 +1100,130 @@ func GetUserTodosFromDB(userID string) ([]Todo, error) {
 
 	var todos []Todo
 	for rows.Next() {
-		var todo Todo
-		var completedInt int
-		var createdAtStr, updatedAtStr string
-
-		err := rows.Scan(
-			&todo.ID, &todo.UserID, &todo.DeviceID, &todo.Name, &todo.Description, &completedInt,
-			&createdAtStr, &updatedAtStr, &todo.DeadLine, &todo.Category, &todo.Priority,
-		)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		todo.Completed = intToBool(completedInt)
-		todo.CreateAt, err = stringToTime(createdAtStr)
-		if err != nil {
-			return nil, err
-		}
+	// 加载任务的标签、子任务完成情况和依赖
+	err = loadTodoTags(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadSubtaskProgress(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadTodoDependencies(todos)
+	if err != nil {
+		return nil, err
+	}
 
-		todo.UpdateAt, err = stringToTime(updatedAtStr)
+	return todos, nil
+}
+
+// 任务各列的值，顺序与todoColumns一致
+func todoValues(todo *Todo) []interface{} {
+	deadline, dueAt := deadlineValues(todo.DeadLine)
+	return []interface{}{
+		todo.ID, todo.UserID, todo.DeviceID, todo.ListID, todo.AssigneeID, todo.ProjectID, todo.ParentID,
+		todo.Name, todo.Description, boolToInt(todo.Completed),
+		timeToString(todo.CreateAt), timeToString(todo.UpdateAt), deadline, dueAt, todo.Category, todo.Priority, todo.Priority.Rank(),
+		todo.Recurrence, todo.TimeZone, todo.SeriesID, todo.OccurrenceIndex, todo.Position, todo.Status,
+		todo.Estimate, todo.EstimateUnit, customValuesToString(todo.CustomFields),
+		timePtrToString(todo.ArchivedAt), timePtrToString(todo.DeletedAt),
+	}
+}
+
+// 生成n个SQL占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// 保存任务到数据库
+func SaveTodoToDB(todo *Todo) error {
+	values := todoValues(todo)
+	query := `INSERT OR REPLACE INTO todos (` + todoColumns + `) VALUES (` + placeholders(len(values)) + `)`
+	_, err := db.Exec(query, values...)
+	if err != nil {
+		return err
+	}
+
+	// TagIDs为nil表示不修改任务标签
+	if todo.TagIDs != nil {
+		err = saveTodoTags(todo.ID, todo.TagIDs)
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
 
-		todos = append(todos, todo)
+	// 截止时间可能变化，重新计算相对提醒
+	return refreshTodoReminders(todo)
+}
+
+// 根据ID从数据库获取任务（不做权限检查）
+func GetTodoFromDB(todoID string) (*Todo, error) {
+	query := `SELECT ` + todoColumns + ` FROM todos WHERE id = ?`
+
+	todo, err := scanTodo(db.QueryRow(query, todoID))
+	if err != nil {
+		return nil, err
 	}
 
-	return todos, nil
+	todos := []Todo{todo}
+	err = loadTodoTags(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadSubtaskProgress(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadTodoDependencies(todos)
+	if err != nil {
+		return nil, err
+	}
+	return &todos[0], nil
 }
 
-// 删除任务
-func DeleteTodoFromDB(todoID, userID string) error {
+// 从数据库获取用户可访问的所有任务（包括共享清单中的任务）
+func GetUserTodosFromDB(userID string) ([]Todo, error) {
 	query := `
-	DELETE FROM todos
-	WHERE id = ? AND user_id = ?
+	SELECT ` + todoColumns + `
+	FROM todos
+	WHERE ` + accessibleTodoCondition + `
+	ORDER BY updated_at DESC
 	`
-	_, err := db.Exec(query, todoID, userID)
-	return err
+	return queryTodos(query, userID, userID, userID)
 }
 
 // 获取某个时间点之后更新的任务
+// 用户在该时间点之后新加入的共享清单中的任务、新分配给用户的任务会全部返回
 func GetTodosUpdatedAfterFromDB(userID string, timestamp time.Time) ([]Todo, error) {
 	query := `
-	SELECT id, user_id, device_id, name, description, completed,
-	       created_at, updated_at, deadline, category, priority
+	SELECT ` + todoColumns + `
 	FROM todos
-	WHERE user_id = ? AND updated_at > ?
+	WHERE ` + accessibleTodoCondition + `
+	  AND (updated_at > ?
+	       OR list_id IN (SELECT list_id FROM list_members WHERE user_id = ? AND joined_at > ?)
+	       OR id IN (SELECT todo_id FROM todo_history WHERE action = ? AND new_value = ? AND created_at > ?))
 	ORDER BY updated_at ASC
 	`
+	ts := timeToString(timestamp)
+	return queryTodos(query, userID, userID, userID, ts, userID, ts, HistoryAssigned, userID, ts)
+}
 
-	rows, err := db.Query(query, userID, timeToString(timestamp))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var todos []Todo
-	for rows.Next() {
-		var todo Todo
-		var completedInt int
-		var createdAtStr, updatedAtStr string
-
-		err := rows.Scan(
-			&todo.ID, &todo.UserID, &todo.DeviceID, &todo.Name, &todo.Description, &completedInt,
-			&createdAtStr, &updatedAtStr, &todo.DeadLine, &todo.Category, &todo.Priority,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		todo.Completed = intToBool(completedInt)
-		todo.CreateAt, err = stringToTime(createdAtStr)
-		if err != nil {
-			return nil, err
-		}
-
-		todo.UpdateAt, err = stringToTime(updatedAtStr)
-		if err != nil {
-			return nil, err
-		}
-
-		todos = append(todos, todo)
-	}
-
-	return todos, nil
+// 统计任务总数和已完成任务数
+func CountTodosFromDB() (total int, completed int, err error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(completed), 0) FROM todos`
+	err = db.QueryRow(query).Scan(&total, &completed)
+	return total, completed, err
 }
 
 // 辅助函数：bool转int
@@ -436,30 +1241,36 @@ func intToBool(i int) bool {
 
 // 导出数据到JSON文件（用于备份）
 func ExportDataToJSON(filePath string) error {
-	// 获取所有用户
-	users, err := getAllUsersFromDB()
+	// 用户和设备保存在内存中，导出的用户不包含密码哈希
+	users := ListUsers("")
+	devices := append([]Device{}, Devices...)
+
+	// 获取所有任务
+	todos, err := getAllTodosFromDB()
 	if err != nil {
 		return err
 	}
 
-	// 获取所有设备
-	devices, err := getAllDevicesFromDB()
+	// 获取所有项目
+	projects, err := queryProjects(`SELECT ` + projectColumns + ` FROM projects`)
 	if err != nil {
 		return err
 	}
 
-	// 获取所有任务
-	todos, err := getAllTodosFromDB()
+	// 获取所有标签
+	tags, err := queryTags(`SELECT ` + tagColumns + ` FROM tags`)
 	if err != nil {
 		return err
 	}
 
 	// 创建导出数据结构
 	exportData := struct {
-		Users   []User   `json:"users"`
-		Devices []Device `json:"devices"`
-		Todos   []Todo   `json:"todos"`
-	}{users, devices, todos}
+		Users    []User    `json:"users"`
+		Devices  []Device  `json:"devices"`
+		Todos    []Todo    `json:"todos"`
+		Projects []Project `json:"projects"`
+		Tags     []Tag     `json:"tags"`
+	}{users, devices, todos, projects, tags}
 
 	// 转换为JSON
 	data, err := json.MarshalIndent(exportData, "", "  ")
@@ -471,78 +1282,7 @@ func ExportDataToJSON(filePath string) error {
 	return os.WriteFile(filePath, data, 0644)
 }
 
-// 辅助函数：获取所有用户（仅用于导出）
-func getAllUsersFromDB() ([]User, error) {
-	query := `SELECT id, username, password, email, created_at FROM users`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var user User
-		var createdAtStr string
-		err := rows.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &createdAtStr)
-		if err != nil {
-			return nil, err
-		}
-		user.CreatedAt, _ = stringToTime(createdAtStr)
-		users = append(users, user)
-	}
-	return users, nil
-}
-
-// 辅助函数：获取所有设备（仅用于导出）
-func getAllDevicesFromDB() ([]Device, error) {
-	query := `SELECT id, user_id, name, device_id, last_seen, created_at FROM devices`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var devices []Device
-	for rows.Next() {
-		var device Device
-		var lastSeenStr, createdAtStr string
-		err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.DeviceID, &lastSeenStr, &createdAtStr)
-		if err != nil {
-			return nil, err
-		}
-		device.LastSeen, _ = stringToTime(lastSeenStr)
-		device.CreatedAt, _ = stringToTime(createdAtStr)
-		devices = append(devices, device)
-	}
-	return devices, nil
-}
-
 // 辅助函数：获取所有任务（仅用于导出）
 func getAllTodosFromDB() ([]Todo, error) {
-	query := `SELECT id, user_id, device_id, name, description, completed, created_at, updated_at, deadline, category, priority FROM todos`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var todos []Todo
-	for rows.Next() {
-		var todo Todo
-		var completedInt int
-		var createdAtStr, updatedAtStr string
-		err := rows.Scan(
-			&todo.ID, &todo.UserID, &todo.DeviceID, &todo.Name, &todo.Description, &completedInt,
-			&createdAtStr, &updatedAtStr, &todo.DeadLine, &todo.Category, &todo.Priority,
-		)
-		if err != nil {
-			return nil, err
-		}
-		todo.Completed = intToBool(completedInt)
-		todo.CreateAt, _ = stringToTime(createdAtStr)
-		todo.UpdateAt, _ = stringToTime(updatedAtStr)
-		todos = append(todos, todo)
-	}
-	return todos, nil
+	return queryTodos(`SELECT ` + todoColumns + ` FROM todos`)
 }
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// 在临时目录中初始化一个新的数据库，测试结束后关闭并恢复工作目录
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDatabase(); err != nil {
+		os.Chdir(wd)
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		CloseDatabase()
+		os.Chdir(wd)
+	})
+}
+
+// 保存一个测试任务
+func createTestTodo(t *testing.T, userID, listID, name string) *Todo {
+	t.Helper()
+
+	now := time.Now()
+	todo := &Todo{
+		ID:       generateUUID(),
+		UserID:   userID,
+		ListID:   listID,
+		Name:     name,
+		CreateAt: now,
+		UpdateAt: now,
+	}
+	if err := ApplyTodoStatus(nil, todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyTodoPosition(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+// 将用户直接加入清单
+func addTestListMember(t *testing.T, listID, userID, role string) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO list_members (list_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+		listID, userID, role, timeToString(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 判断字符串是否在列表中
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 只有日期的截止时间格式
+const deadlineDateLayout = "2006-01-02"
+
+// 带时间的截止时间在数据库中的格式（任务时区的当地时间）
+const deadlineDateTimeLayout = "2006-01-02T15:04:05"
+
+// 接口和同步接受的截止时间格式，不带时区偏移的时间按任务的时区解释
+var deadlineLayouts = []string{
+	time.RFC3339,
+	deadlineDateTimeLayout,
+	"2006-01-02T15:04",
+	deadlineDateLayout,
+}
+
+// 迁移旧数据时额外尝试的格式
+var legacyDeadlineLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"2006/1/2",
+	"2006-1-2",
+	"2006.01.02",
+	"2006年1月2日 15:04",
+	"2006年1月2日",
+	"01/02/2006",
+}
+
+// 截止时间查询范围
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "week"
+)
+
+// Deadline 任务截止时间，可以只有日期，也可以是日期时间，时区由任务的TimeZone决定
+// JSON中为字符串：只有日期时为2006-01-02，带时间时为带时区偏移的RFC3339格式
+type Deadline struct {
+	Time     time.Time // 任务时区中的截止时间，只有日期时为当天零点
+	DateOnly bool      // 是否只有日期
+
+	raw string // 客户端提交的原始字符串，由ApplyTodoDeadline解析
+}
+
+// IsZero 是否没有设置截止时间
+func (d Deadline) IsZero() bool {
+	return d.Time.IsZero() && d.raw == ""
+}
+
+// String 返回数据库中保存的格式
+func (d Deadline) String() string {
+	if d.Time.IsZero() {
+		return d.raw
+	}
+	if d.DateOnly {
+		return d.Time.Format(deadlineDateLayout)
+	}
+	return d.Time.Format(deadlineDateTimeLayout)
+}
+
+// DueAt 任务开始逾期的时间点，只有日期时为第二天零点
+func (d Deadline) DueAt() time.Time {
+	if d.DateOnly {
+		return addDays(d.Time, 1)
+	}
+	return d.Time
+}
+
+// MarshalJSON 实现json.Marshaler接口
+func (d Deadline) MarshalJSON() ([]byte, error) {
+	switch {
+	case d.Time.IsZero():
+		return json.Marshal(d.raw)
+	case d.DateOnly:
+		return json.Marshal(d.Time.Format(deadlineDateLayout))
+	default:
+		return json.Marshal(d.Time.Format(time.RFC3339))
+	}
+}
+
+// UnmarshalJSON 实现json.Unmarshaler接口，格式校验在ApplyTodoDeadline中进行
+func (d *Deadline) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("截止时间必须是字符串")
+	}
+	*d = Deadline{}
+	if s != nil {
+		d.raw = strings.TrimSpace(*s)
+	}
+	return nil
+}
+
+// ParseDeadline 按接口接受的格式解析截止时间
+func ParseDeadline(s string, loc *time.Location) (Deadline, error) {
+	return parseDeadline(s, loc, deadlineLayouts)
+}
+
+func parseDeadline(s string, loc *time.Location, layouts []string) (Deadline, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Deadline{}, nil
+	}
+
+	for _, layout := range layouts {
+		if layout == time.RFC3339 {
+			if t, err := time.Parse(layout, s); err == nil {
+				return Deadline{Time: t.In(loc).Truncate(time.Second)}, nil
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return Deadline{Time: t, DateOnly: !strings.Contains(layout, "15:04")}, nil
+		}
+	}
+	return Deadline{}, fmt.Errorf("无效的截止时间: %s，应为2006-01-02或2006-01-02T15:04格式", s)
+}
+
+// 从数据库中的值恢复截止时间
+func loadDeadline(s, timeZone string) Deadline {
+	loc, err := locationOf(timeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	deadline, err := ParseDeadline(s, loc)
+	if err != nil {
+		// 无法解析的值原样保留，由迁移或下一次修改处理
+		return Deadline{raw: s}
+	}
+	return deadline
+}
+
+// 获取IANA时区，为空时使用服务器本地时区
+func locationOf(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", timeZone)
+	}
+	return loc, nil
+}
+
+// 获取任务的时区，未设置时使用服务器本地时区
+func todoLocation(todo *Todo) (*time.Location, error) {
+	return locationOf(todo.TimeZone)
+}
+
+// 校验任务的时区和截止时间，并将截止时间转换到任务的时区
+func ApplyTodoDeadline(todo *Todo) error {
+	loc, err := todoLocation(todo)
+	if err != nil {
+		return err
+	}
+
+	d := todo.DeadLine
+	switch {
+	case d.raw != "":
+		todo.DeadLine, err = ParseDeadline(d.raw, loc)
+		if err != nil {
+			return err
+		}
+	case d.Time.IsZero():
+		todo.DeadLine = Deadline{}
+	case d.DateOnly:
+		// 只有日期时保持日期不变
+		y, m, day := d.Time.Date()
+		todo.DeadLine = Deadline{Time: time.Date(y, m, day, 0, 0, 0, 0, loc), DateOnly: true}
+	default:
+		todo.DeadLine = Deadline{Time: d.Time.In(loc)}
+	}
+	return nil
+}
+
+// 截止时间在数据库中的值：截止时间（任务时区的当地时间）和开始逾期的UTC时间
+func deadlineValues(d Deadline) (string, string) {
+	if d.Time.IsZero() {
+		return d.raw, ""
+	}
+	return d.String(), timeToString(d.DueAt().UTC())
+}
+
+// 截止时间落在[start, end)中的条件，按开始逾期的UTC时间比较，因此与任务自身的时区无关
+// 只有日期的截止时间在当天结束时逾期，所以比较的是(start, end]
+func dueWithinCondition(start, end time.Time) (string, []interface{}) {
+	from, to := timeToString(start.UTC()), timeToString(end.UTC())
+	condition := `((length(deadline) > 10 AND due_at >= ? AND due_at < ?) OR (length(deadline) = 10 AND due_at > ? AND due_at <= ?))`
+	return condition, []interface{}{from, to, from, to}
+}
+
+// 获取用户可访问的未完成任务中逾期、今天到期或本周到期的任务，按截止时间排序
+// 今天和本周按loc时区计算，一周从周一开始
+func GetDueTodosFromDB(userID, due string, loc *time.Location) ([]Todo, error) {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	var condition string
+	var args []interface{}
+	switch due {
+	case DueOverdue:
+		condition = `due_at != '' AND due_at <= ?`
+		args = []interface{}{timeToString(now.UTC())}
+	case DueToday:
+		condition, args = dueWithinCondition(today, addDays(today, 1))
+	case DueThisWeek:
+		monday := addDays(today, -((int(today.Weekday()) + 6) % 7))
+		condition, args = dueWithinCondition(monday, addDays(monday, 7))
+	default:
+		return nil, fmt.Errorf("无效的到期范围: %s", due)
+	}
+
+	query := `
+	SELECT ` + todoColumns + `
+	FROM todos
+	WHERE ` + accessibleTodoCondition + ` AND completed = 0 AND archived_at = '' AND deleted_at = '' AND deadline != '' AND ` + condition + `
+	ORDER BY due_at ASC
+	`
+	return queryTodos(query, append([]interface{}{userID, userID, userID}, args...)...)
+}
+
+// MigrateDeadlines 将旧版本自由格式的截止时间转换为统一格式，并计算逾期时间
+// 无法解析的截止时间会被清空，原始内容追加到任务描述中避免丢失
+func MigrateDeadlines() error {
+	rows, err := db.Query(`SELECT id, deadline, time_zone, COALESCE(description, '') FROM todos WHERE deadline != '' AND due_at = ''`)
+	if err != nil {
+		return err
+	}
+
+	type legacyDeadline struct {
+		id, deadline, timeZone, description string
+	}
+	var pending []legacyDeadline
+	for rows.Next() {
+		var item legacyDeadline
+		if err := rows.Scan(&item.id, &item.deadline, &item.timeZone, &item.description); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	layouts := append(append([]string{}, deadlineLayouts...), legacyDeadlineLayouts...)
+	for _, item := range pending {
+		loc, err := locationOf(item.timeZone)
+		if err != nil {
+			loc = time.Local
+		}
+
+		deadline, err := parseDeadline(item.deadline, loc, layouts)
+		if err != nil {
+			log.Printf("任务 %s 的截止时间 %q 无法解析，已清空", item.id, item.deadline)
+			description := strings.TrimSpace(item.description + "\n（原截止时间：" + item.deadline + "）")
+			_, err = db.Exec(`UPDATE todos SET deadline = '', description = ? WHERE id = ?`, description, item.id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, dueAt := deadlineValues(deadline)
+		_, err = db.Exec(`UPDATE todos SET deadline = ?, due_at = ? WHERE id = ?`, value, dueAt, item.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Printf("已处理 %d 个旧格式的截止时间", len(pending))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 保存带截止时间的测试任务，截止时间转换到任务的时区
+func createTestTodoDue(t *testing.T, name, timeZone string, deadline Deadline) *Todo {
+	t.Helper()
+
+	todo := createTestTodo(t, "user", "", name)
+	todo.TimeZone = timeZone
+	todo.DeadLine = deadline
+	if err := ApplyTodoDeadline(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestGetDueTodosTodayAcrossTimeZones(t *testing.T) {
+	setupTestDB(t)
+	mustLoadLocation(t, "Pacific/Kiritimati")
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	// UTC今天中午在UTC+14的时区中已经是第二天
+	noon := createTestTodoDue(t, "今天中午", "Pacific/Kiritimati", Deadline{Time: today.Add(12 * time.Hour)})
+	dateOnly := createTestTodoDue(t, "今天全天", "UTC", Deadline{Time: today, DateOnly: true})
+	tomorrow := createTestTodoDue(t, "明天", "UTC", Deadline{Time: today.Add(36 * time.Hour)})
+	yesterday := createTestTodoDue(t, "昨天全天", "UTC", Deadline{Time: today.Add(-24 * time.Hour), DateOnly: true})
+
+	todos, err := GetDueTodosFromDB("user", DueToday, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, todo := range todos {
+		got[todo.ID] = true
+	}
+	for _, todo := range []*Todo{noon, dateOnly} {
+		if !got[todo.ID] {
+			t.Errorf("%s 应该在今天到期", todo.Name)
+		}
+	}
+	for _, todo := range []*Todo{tomorrow, yesterday} {
+		if got[todo.ID] {
+			t.Errorf("%s 不应该在今天到期", todo.Name)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// 从某个任务出发，沿前置任务向上查找所有直接和间接的前置任务
+const blockersQuery = `
+WITH RECURSIVE blockers(id) AS (
+	SELECT blocker_id FROM todo_dependencies WHERE todo_id = ?
+	UNION
+	SELECT d.blocker_id FROM todo_dependencies d JOIN blockers ON d.todo_id = blockers.id
+)`
+
+// 被未完成的前置任务阻塞的任务，可以用于过滤条件，回收站中的前置任务不阻塞
+const blockedTodoCondition = `id IN (SELECT d.todo_id FROM todo_dependencies d JOIN todos b ON b.id = d.blocker_id WHERE b.completed = 0 AND b.deleted_at = '')`
+
+// AddTodoDependency 添加依赖：todoID被blockerID阻塞，blockerID完成前todoID处于阻塞状态
+// 需要有任务的编辑权限和前置任务的查看权限，不能形成循环依赖
+func AddTodoDependency(userID, todoID, blockerID string) error {
+	if todoID == blockerID {
+		return errors.New("任务不能依赖自身")
+	}
+
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanEditTodo(userID, todo) {
+		return errors.New("任务不存在或无权修改")
+	}
+	blocker, err := GetTodoFromDB(blockerID)
+	if err != nil || !CanViewTodo(userID, blocker) {
+		return errors.New("前置任务不存在或无权查看")
+	}
+
+	// 使用单独的连接立即获取写锁，保证检查循环和写入之间没有其他请求添加依赖，
+	// 否则同时添加A依赖B和B依赖A时两个请求都能通过检查
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, `ROLLBACK`)
+		}
+	}()
+
+	// 如果todoID已经是blockerID的直接或间接前置任务，添加后会形成循环
+	var count int
+	err = conn.QueryRowContext(ctx, blockersQuery+` SELECT COUNT(*) FROM blockers WHERE id = ?`, blockerID, todoID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("任务「%s」已经直接或间接阻塞「%s」，不能形成循环依赖", todo.Name, blocker.Name)
+	}
+
+	now := timeToString(time.Now())
+	_, err = conn.ExecContext(ctx, `INSERT OR IGNORE INTO todo_dependencies (todo_id, blocker_id, user_id, created_at) VALUES (?, ?, ?, ?)`,
+		todoID, blockerID, userID, now)
+	if err != nil {
+		return err
+	}
+	// 更新任务的更新时间，使其他设备同步到新的依赖
+	_, err = conn.ExecContext(ctx, `UPDATE todos SET updated_at = ? WHERE id = ?`, now, todoID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// RemoveTodoDependency 删除依赖
+func RemoveTodoDependency(userID, todoID, blockerID string) error {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !CanEditTodo(userID, todo) {
+		return errors.New("任务不存在或无权修改")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM todo_dependencies WHERE todo_id = ? AND blocker_id = ?`, todoID, blockerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("依赖不存在")
+	}
+	_, err = tx.Exec(`UPDATE todos SET updated_at = ? WHERE id = ?`, timeToString(time.Now()), todoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTodoDependencies 获取任务的前置任务和被它阻塞的任务，只返回用户可以查看的任务
+func GetTodoDependencies(userID, todoID string) (blockers, dependents []Todo, err error) {
+	blockers, err = queryTodos(`
+	SELECT `+todoColumns+` FROM todos
+	WHERE id IN (SELECT blocker_id FROM todo_dependencies WHERE todo_id = ?) AND `+accessibleTodoCondition+`
+	ORDER BY position ASC, id ASC
+	`, todoID, userID, userID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dependents, err = queryTodos(`
+	SELECT `+todoColumns+` FROM todos
+	WHERE id IN (SELECT todo_id FROM todo_dependencies WHERE blocker_id = ?) AND `+accessibleTodoCondition+`
+	ORDER BY position ASC, id ASC
+	`, todoID, userID, userID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if blockers == nil {
+		blockers = []Todo{}
+	}
+	if dependents == nil {
+		dependents = []Todo{}
+	}
+	return blockers, dependents, nil
+}
+
+// 批量加载任务的前置任务ID，并计算是否被未完成的前置任务阻塞
+func loadTodoDependencies(todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(todos))
+	for i := range todos {
+		todos[i].BlockedBy = []string{}
+		todos[i].Blocked = false
+		index[todos[i].ID] = i
+	}
+
+	for start := 0; start < len(todos); start += tagQueryBatchSize {
+		end := start + tagQueryBatchSize
+		if end > len(todos) {
+			end = len(todos)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, todo := range todos[start:end] {
+			args = append(args, todo.ID)
+		}
+
+		// 回收站中的前置任务按已完成处理
+		rows, err := db.Query(`
+		SELECT d.todo_id, d.blocker_id, b.completed OR b.deleted_at != ''
+		FROM todo_dependencies d JOIN todos b ON b.id = d.blocker_id
+		WHERE d.todo_id IN (`+placeholders(len(args))+`)
+		ORDER BY d.created_at ASC
+		`, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var todoID, blockerID string
+			var completed int
+			if err := rows.Scan(&todoID, &blockerID, &completed); err != nil {
+				rows.Close()
+				return err
+			}
+			todo := &todos[index[todoID]]
+			todo.BlockedBy = append(todo.BlockedBy, blockerID)
+			if !intToBool(completed) {
+				todo.Blocked = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyUnblockedTodos 前置任务从未完成变为完成后，通知因此解除阻塞的任务的创建者和负责人（不通知操作者本人）
+// 通知失败不影响任务的保存，只记录日志
+func NotifyUnblockedTodos(userID string, previous, blocker *Todo) {
+	if !blocker.Completed || (previous != nil && previous.Completed) {
+		return
+	}
+
+	dependents, err := queryTodos(`
+	SELECT `+todoColumns+` FROM todos
+	WHERE completed = 0 AND deleted_at = '' AND id IN (SELECT todo_id FROM todo_dependencies WHERE blocker_id = ?)
+	`, blocker.ID)
+	if err != nil {
+		log.Printf("查询被任务 %s 阻塞的任务失败: %v", blocker.ID, err)
+		return
+	}
+
+	for _, todo := range dependents {
+		if todo.Blocked {
+			continue
+		}
+		recipients := map[string]bool{todo.UserID: true}
+		if todo.AssigneeID != "" {
+			recipients[todo.AssigneeID] = true
+		}
+		delete(recipients, userID)
+
+		for recipient := range recipients {
+			err := SaveNotificationToDB(&Notification{
+				UserID: recipient,
+				TodoID: todo.ID,
+				Title:  "任务已解除阻塞: " + todo.Name,
+				Body:   fmt.Sprintf("前置任务「%s」已完成，可以开始处理了", blocker.Name),
+			})
+			if err != nil {
+				log.Printf("发送解除阻塞通知失败: %v", err)
+			}
+		}
+	}
+}
+
+// DependencyEdge 依赖关系：BlockerID完成前TodoID处于阻塞状态
+type DependencyEdge struct {
+	TodoID    string `json:"todo_id"`
+	BlockerID string `json:"blocker_id"`
+}
+
+// DependencyGraph 项目中任务的依赖图，Order为拓扑顺序（前置任务排在前面）
+type DependencyGraph struct {
+	Todos []Todo           `json:"todos"`
+	Edges []DependencyEdge `json:"edges"`
+	Order []string         `json:"order"`
+}
+
+// GetProjectDependencyGraph 获取项目中任务的依赖图，只包含项目内任务之间的依赖
+// 拓扑排序时没有依赖关系的任务按手动顺序排列
+func GetProjectDependencyGraph(userID, projectID string) (*DependencyGraph, error) {
+	project, err := GetProjectFromDB(projectID)
+	if err != nil || project.Deleted || !CanViewProject(userID, project) {
+		return nil, errors.New("项目不存在或无权访问")
+	}
+
+	todos, err := queryTodos(`
+	SELECT `+todoColumns+` FROM todos
+	WHERE project_id = ? AND deleted_at = '' AND `+accessibleTodoCondition+`
+	ORDER BY position ASC, id ASC
+	`, projectID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &DependencyGraph{Todos: []Todo{}, Edges: []DependencyEdge{}, Order: []string{}}
+	if todos != nil {
+		graph.Todos = todos
+	}
+
+	rank := make(map[string]int, len(todos))
+	for i, todo := range todos {
+		rank[todo.ID] = i
+	}
+
+	indegree := make(map[string]int, len(todos))
+	next := make(map[string][]string)
+	for _, todo := range todos {
+		for _, blockerID := range todo.BlockedBy {
+			if _, ok := rank[blockerID]; !ok {
+				continue
+			}
+			graph.Edges = append(graph.Edges, DependencyEdge{TodoID: todo.ID, BlockerID: blockerID})
+			next[blockerID] = append(next[blockerID], todo.ID)
+			indegree[todo.ID]++
+		}
+	}
+
+	// Kahn算法，每次取手动顺序最靠前的可用任务
+	var ready []string
+	for _, todo := range todos {
+		if indegree[todo.ID] == 0 {
+			ready = append(ready, todo.ID)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return rank[ready[i]] < rank[ready[j]] })
+		id := ready[0]
+		ready = ready[1:]
+		graph.Order = append(graph.Order, id)
+		for _, dependent := range next[id] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(graph.Order) != len(todos) {
+		return nil, errors.New("项目中存在循环依赖")
+	}
+	return graph, nil
+}
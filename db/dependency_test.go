@@ -0,0 +1,79 @@
+package db
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAddTodoDependency(t *testing.T) {
+	setupTestDB(t)
+
+	a := createTestTodo(t, "alice", "", "A")
+	b := createTestTodo(t, "alice", "", "B")
+	c := createTestTodo(t, "alice", "", "C")
+
+	// A被B阻塞，B被C阻塞
+	if err := AddTodoDependency("alice", a.ID, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddTodoDependency("alice", b.ID, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddTodoDependency("alice", c.ID, a.ID); err == nil {
+		t.Error("不应该允许间接的循环依赖")
+	}
+	if err := AddTodoDependency("alice", a.ID, a.ID); err == nil {
+		t.Error("任务不能依赖自身")
+	}
+	other := createTestTodo(t, "bob", "", "其他用户的任务")
+	if err := AddTodoDependency("alice", a.ID, other.ID); err == nil {
+		t.Error("不应该允许依赖无权查看的任务")
+	}
+
+	todo, err := GetTodoFromDB(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !todo.Blocked || len(todo.BlockedBy) != 1 || todo.BlockedBy[0] != b.ID {
+		t.Errorf("任务应该被B阻塞，实际为 %v %v", todo.Blocked, todo.BlockedBy)
+	}
+
+	b.Completed = true
+	if err := SaveTodoToDB(b); err != nil {
+		t.Fatal(err)
+	}
+	if todo, err = GetTodoFromDB(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Blocked {
+		t.Error("前置任务完成后不应该再被阻塞")
+	}
+}
+
+func TestAddTodoDependencyConcurrentCycle(t *testing.T) {
+	setupTestDB(t)
+
+	for i := 0; i < 20; i++ {
+		a := createTestTodo(t, "alice", "", "A")
+		b := createTestTodo(t, "alice", "", "B")
+
+		// 同时添加A依赖B和B依赖A，最多只能成功一个
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, pair := range [][2]string{{a.ID, b.ID}, {b.ID, a.ID}} {
+			wg.Add(1)
+			go func(j int, todoID, blockerID string) {
+				defer wg.Done()
+				errs[j] = AddTodoDependency("alice", todoID, blockerID)
+			}(j, pair[0], pair[1])
+		}
+		wg.Wait()
+
+		if errs[0] == nil && errs[1] == nil {
+			t.Fatal("同时添加的两个依赖形成了循环")
+		}
+		if errs[0] != nil && errs[1] != nil {
+			t.Fatalf("应该有一个依赖添加成功: %v, %v", errs[0], errs[1])
+		}
+	}
+}
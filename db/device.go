@@ -37,11 +37,11 @@ const (
 
 // DeviceInfo 设备详细信息
 type DeviceInfo struct {
-	Type      string `json:"type"`       // 设备类型
-	OS        string `json:"os"`         // 操作系统
-	OSVersion string `json:"os_version"` // 操作系统版本
-	Browser   string `json:"browser"`    // 浏览器
-	Model     string `json:"model"`      // 设备型号
+	Type       string `json:"type"`        // 设备类型
+	OS         string `json:"os"`          // 操作系统
+	OSVersion  string `json:"os_version"`  // 操作系统版本
+	Browser    string `json:"browser"`     // 浏览器
+	Model      string `json:"model"`       // 设备型号
 	AppVersion string `json:"app_version"` // 应用版本（如果是移动应用）
 }
 
@@ -173,6 +173,21 @@ func DeleteDevice(userID, deviceID string) error {
 	return errors.New("设备不存在或无权删除")
 }
 
+// 删除用户的所有设备（强制下线），返回删除的设备数量
+func RemoveUserDevices(userID string) int {
+	remaining := Devices[:0]
+	removed := 0
+	for _, device := range Devices {
+		if device.UserID == userID {
+			removed++
+			continue
+		}
+		remaining = append(remaining, device)
+	}
+	Devices = remaining
+	return removed
+}
+
 // 获取最近活跃的设备（限制数量）
 func GetRecentActiveDevices(userID string, limit int) []Device {
 	var userDevices []Device
@@ -0,0 +1,387 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// EstimateUnit 工作量估算的单位
+type EstimateUnit string
+
+// 估算单位取值，空字符串表示没有估算
+const (
+	EstimateNone    EstimateUnit = ""
+	EstimateMinutes EstimateUnit = "minutes"
+	EstimatePoints  EstimateUnit = "points"
+)
+
+// 单个任务估算的上限：一年的分钟数或1000个故事点
+const (
+	maxEstimateMinutes = 366 * 24 * 60
+	maxEstimatePoints  = 1000
+)
+
+// 校验并规范化任务的工作量估算，估算为0时清空单位
+func ApplyTodoEstimate(todo *Todo) error {
+	if todo.Estimate < 0 || math.IsNaN(todo.Estimate) {
+		return fmt.Errorf("无效的估算: %v", todo.Estimate)
+	}
+	if todo.Estimate == 0 {
+		todo.EstimateUnit = EstimateNone
+		return nil
+	}
+
+	switch todo.EstimateUnit {
+	case EstimateMinutes:
+		if todo.Estimate > maxEstimateMinutes {
+			return fmt.Errorf("估算不能超过%d分钟", maxEstimateMinutes)
+		}
+		// 分钟数只保留整数
+		todo.Estimate = math.Round(todo.Estimate)
+	case EstimatePoints:
+		if todo.Estimate > maxEstimatePoints {
+			return fmt.Errorf("估算不能超过%d个故事点", maxEstimatePoints)
+		}
+	case EstimateNone:
+		return errors.New("估算需要指定单位，可选值为minutes、points")
+	default:
+		return fmt.Errorf("无效的估算单位: %s，可选值为minutes、points", todo.EstimateUnit)
+	}
+	return nil
+}
+
+// 报表的分组方式
+const (
+	ReportByProject = "project"
+	ReportByTag     = "tag"
+	ReportByWeek    = "week"
+)
+
+// 按周分组且没有指定开始时间时统计的周数（包括本周）
+const defaultReportWeeks = 8
+
+// EffortReportOptions 工作量报表的参数
+type EffortReportOptions struct {
+	GroupBy   string
+	ProjectID string         // 只统计指定项目中的任务
+	From      time.Time      // 完成时间范围，指定后只统计范围内完成的任务
+	To        time.Time      // 不包括To
+	Location  *time.Location // 计算周的起止时间使用的时区
+}
+
+// EffortReportRow 一个分组的估算和实际工作量
+// 实际工作量优先使用计时记录，没有计时的已完成任务按从开始到完成的时间计算
+type EffortReportRow struct {
+	Key              string  `json:"key"` // 项目ID、标签ID或周一的日期（2006-01-02），没有项目或标签时为空
+	Name             string  `json:"name"`
+	TodoCount        int     `json:"todo_count"`
+	CompletedCount   int     `json:"completed_count"`
+	EstimatedMinutes int64   `json:"estimated_minutes"`
+	EstimatedPoints  float64 `json:"estimated_points"`
+	CompletedPoints  float64 `json:"completed_points"` // 已完成任务的故事点，即速度
+	TrackedMinutes   int64   `json:"tracked_minutes"`  // 计时记录合计
+	ActualMinutes    int64   `json:"actual_minutes"`   // 已完成任务的实际工作量
+	Accuracy         float64 `json:"accuracy"`         // 已完成且按分钟估算的任务，实际工作量与估算的比值，大于1表示低估
+
+	trackedSeconds   int64
+	actualSeconds    int64
+	accuracyActual   int64 // 参与计算准确度的任务的实际秒数
+	accuracyEstimate int64 // 参与计算准确度的任务的估算秒数
+}
+
+// EffortReport 工作量报表
+type EffortReport struct {
+	GroupBy string            `json:"group_by"`
+	Rows    []EffortReportRow `json:"rows"`
+	Total   EffortReportRow   `json:"total"`
+}
+
+// 累加一个任务的工作量，actual为已完成任务的实际秒数
+func (row *EffortReportRow) add(todo *Todo, tracked, actual int64) {
+	row.TodoCount++
+	row.trackedSeconds += tracked
+	switch todo.EstimateUnit {
+	case EstimateMinutes:
+		row.EstimatedMinutes += int64(todo.Estimate)
+	case EstimatePoints:
+		row.EstimatedPoints += todo.Estimate
+	}
+	if !todo.Completed {
+		return
+	}
+
+	row.CompletedCount++
+	row.actualSeconds += actual
+	switch todo.EstimateUnit {
+	case EstimatePoints:
+		row.CompletedPoints += todo.Estimate
+	case EstimateMinutes:
+		if actual > 0 {
+			row.accuracyActual += actual
+			row.accuracyEstimate += int64(todo.Estimate) * 60
+		}
+	}
+}
+
+// 将秒数换算为分钟并计算准确度
+func (row *EffortReportRow) finish() {
+	row.TrackedMinutes = (row.trackedSeconds + 30) / 60
+	row.ActualMinutes = (row.actualSeconds + 30) / 60
+	if row.accuracyEstimate > 0 {
+		row.Accuracy = math.Round(float64(row.accuracyActual)/float64(row.accuracyEstimate)*100) / 100
+	}
+}
+
+// 任务从开始到完成的时间
+type completionSpan struct {
+	startedAt   time.Time
+	completedAt time.Time
+}
+
+// 批量计算已完成任务的开始和完成时间：完成时间为最后一次状态变更，
+// 开始时间为第一次离开初始状态，直接从初始状态完成的任务从创建时开始计算
+// 没有状态变更记录的旧任务使用创建和更新时间
+func loadCompletionSpans(todos []Todo) (map[string]completionSpan, error) {
+	transitions := make(map[string][]time.Time)
+	err := forEachTodoBatch(todos, func(args []interface{}) error {
+		rows, err := db.Query(`
+		SELECT todo_id, created_at FROM todo_history
+		WHERE action = ? AND todo_id IN (`+placeholders(len(args))+`)
+		ORDER BY created_at ASC
+		`, append([]interface{}{HistoryStatusChanged}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var todoID, createdAtStr string
+			if err := rows.Scan(&todoID, &createdAtStr); err != nil {
+				return err
+			}
+			createdAt, err := stringToTime(createdAtStr)
+			if err != nil {
+				return err
+			}
+			transitions[todoID] = append(transitions[todoID], createdAt)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	spans := make(map[string]completionSpan)
+	for _, todo := range todos {
+		if !todo.Completed {
+			continue
+		}
+		span := completionSpan{startedAt: todo.CreateAt, completedAt: todo.UpdateAt}
+		if times := transitions[todo.ID]; len(times) > 0 {
+			span.completedAt = times[len(times)-1]
+			if len(times) > 1 {
+				span.startedAt = times[0]
+			}
+		}
+		spans[todo.ID] = span
+	}
+	return spans, nil
+}
+
+// 批量计算任务的计时合计（秒），正在运行的计时器计算到now
+func loadTrackedSeconds(todos []Todo, now time.Time) (map[string]int64, error) {
+	tracked := make(map[string]int64)
+	err := forEachTodoBatch(todos, func(args []interface{}) error {
+		rows, err := db.Query(`
+		SELECT todo_id, started_at, stopped_at, duration FROM time_entries
+		WHERE deleted = 0 AND todo_id IN (`+placeholders(len(args))+`)
+		`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var todoID, startedAtStr, stoppedAtStr string
+			var seconds int64
+			if err := rows.Scan(&todoID, &startedAtStr, &stoppedAtStr, &seconds); err != nil {
+				return err
+			}
+			if stoppedAtStr == "" {
+				startedAt, err := stringToTime(startedAtStr)
+				if err != nil {
+					return err
+				}
+				seconds = elapsedSeconds(startedAt, now)
+			}
+			tracked[todoID] += seconds
+		}
+		return rows.Err()
+	})
+	return tracked, err
+}
+
+// 按批次遍历任务ID，避免超过SQLite的参数数量限制
+func forEachTodoBatch(todos []Todo, fn func(args []interface{}) error) error {
+	for start := 0; start < len(todos); start += tagQueryBatchSize {
+		end := start + tagQueryBatchSize
+		if end > len(todos) {
+			end = len(todos)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, todo := range todos[start:end] {
+			args = append(args, todo.ID)
+		}
+		if err := fn(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 某个时间所在周的周一零点
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+}
+
+// GetEffortReport 按项目、标签或周统计估算和实际工作量
+// 按周统计时只包括在范围内完成的任务，按完成时间所在的周分组
+func GetEffortReport(userID string, opts EffortReportOptions) (*EffortReport, error) {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	now := time.Now()
+
+	switch opts.GroupBy {
+	case ReportByProject, ReportByTag:
+	case ReportByWeek:
+		if opts.From.IsZero() {
+			opts.From = weekStart(now, loc).AddDate(0, 0, -7*(defaultReportWeeks-1))
+		}
+	default:
+		return nil, fmt.Errorf("无效的分组方式: %s，可选值为project、tag、week", opts.GroupBy)
+	}
+
+	query := `SELECT ` + todoColumns + ` FROM todos WHERE deleted_at = '' AND ` + accessibleTodoCondition
+	args := []interface{}{userID, userID, userID}
+	if opts.ProjectID != "" {
+		project, err := GetProjectFromDB(opts.ProjectID)
+		if err != nil || project.Deleted || !CanViewProject(userID, project) {
+			return nil, errors.New("项目不存在或无权访问")
+		}
+		query += ` AND project_id = ?`
+		args = append(args, opts.ProjectID)
+	}
+	ranged := !opts.From.IsZero() || !opts.To.IsZero()
+	if ranged {
+		query += ` AND completed = 1`
+	}
+
+	todos, err := queryTodos(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	spans, err := loadCompletionSpans(todos)
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := loadTrackedSeconds(todos, now)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EffortReport{GroupBy: opts.GroupBy, Rows: []EffortReportRow{}, Total: EffortReportRow{Name: "合计"}}
+	index := make(map[string]int)
+	row := func(key string) *EffortReportRow {
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Rows)
+			index[key] = i
+			report.Rows = append(report.Rows, EffortReportRow{Key: key})
+		}
+		return &report.Rows[i]
+	}
+
+	// 按周统计时列出范围内的每一周，没有完成任务的周也保留
+	if opts.GroupBy == ReportByWeek {
+		to := opts.To
+		if to.IsZero() {
+			to = now
+		}
+		for week := weekStart(opts.From, loc); week.Before(to); week = week.AddDate(0, 0, 7) {
+			row(week.Format("2006-01-02")).Name = week.Format("2006-01-02") + " ~ " + week.AddDate(0, 0, 6).Format("2006-01-02")
+		}
+	}
+
+	for i := range todos {
+		todo := &todos[i]
+		span, completed := spans[todo.ID]
+		if ranged {
+			if !completed || span.completedAt.Before(opts.From) || (!opts.To.IsZero() && !span.completedAt.Before(opts.To)) {
+				continue
+			}
+		}
+
+		// 实际工作量优先使用计时记录
+		actual := tracked[todo.ID]
+		if actual == 0 && completed {
+			actual = elapsedSeconds(span.startedAt, span.completedAt)
+		}
+
+		switch opts.GroupBy {
+		case ReportByProject:
+			row(todo.ProjectID).add(todo, tracked[todo.ID], actual)
+		case ReportByTag:
+			if len(todo.TagIDs) == 0 {
+				row("").add(todo, tracked[todo.ID], actual)
+			}
+			for _, tagID := range todo.TagIDs {
+				row(tagID).add(todo, tracked[todo.ID], actual)
+			}
+		case ReportByWeek:
+			row(weekStart(span.completedAt, loc).Format("2006-01-02")).add(todo, tracked[todo.ID], actual)
+		}
+		report.Total.add(todo, tracked[todo.ID], actual)
+	}
+
+	for i := range report.Rows {
+		r := &report.Rows[i]
+		r.finish()
+		switch {
+		case opts.GroupBy == ReportByWeek:
+		case r.Key == "" && opts.GroupBy == ReportByProject:
+			r.Name = "无项目"
+		case r.Key == "":
+			r.Name = "无标签"
+		case opts.GroupBy == ReportByProject:
+			if project, err := GetProjectFromDB(r.Key); err == nil {
+				r.Name = project.Name
+			}
+		case opts.GroupBy == ReportByTag:
+			if tag, err := GetTagFromDB(r.Key); err == nil {
+				r.Name = tag.Name
+			}
+		}
+	}
+	report.Total.finish()
+
+	// 按周统计时按时间顺序，其他按名称排列，没有项目或标签的分组排在最后
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if opts.GroupBy == ReportByWeek {
+			return a.Key < b.Key
+		}
+		if (a.Key == "") != (b.Key == "") {
+			return b.Key == ""
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
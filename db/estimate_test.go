@@ -0,0 +1,100 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyTodoEstimate(t *testing.T) {
+	tests := []struct {
+		estimate float64
+		unit     EstimateUnit
+		want     float64
+		wantUnit EstimateUnit
+		valid    bool
+	}{
+		{0, EstimatePoints, 0, EstimateNone, true},
+		{29.6, EstimateMinutes, 30, EstimateMinutes, true},
+		{2.5, EstimatePoints, 2.5, EstimatePoints, true},
+		{-1, EstimateMinutes, 0, "", false},
+		{30, EstimateNone, 0, "", false},
+		{30, "hours", 0, "", false},
+		{maxEstimatePoints + 1, EstimatePoints, 0, "", false},
+		{maxEstimateMinutes + 1, EstimateMinutes, 0, "", false},
+	}
+	for _, tt := range tests {
+		todo := &Todo{Estimate: tt.estimate, EstimateUnit: tt.unit}
+		err := ApplyTodoEstimate(todo)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v %s: 期望有效=%v，实际错误 %v", tt.estimate, tt.unit, tt.valid, err)
+			continue
+		}
+		if tt.valid && (todo.Estimate != tt.want || todo.EstimateUnit != tt.wantUnit) {
+			t.Errorf("%v %s 规范化为 %v %s，期望 %v %s", tt.estimate, tt.unit, todo.Estimate, todo.EstimateUnit, tt.want, tt.wantUnit)
+		}
+	}
+}
+
+// 创建带估算的任务
+func createTestEstimatedTodo(t *testing.T, name string, estimate float64, unit EstimateUnit, completed bool, tagIDs []string) *Todo {
+	t.Helper()
+
+	todo := createTestTodo(t, "alice", "", name)
+	todo.Estimate = estimate
+	todo.EstimateUnit = unit
+	todo.Completed = completed
+	todo.TagIDs = tagIDs
+	if err := ApplyTodoEstimate(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestGetEffortReportByTag(t *testing.T) {
+	setupTestDB(t)
+
+	tag := &Tag{Name: "后端"}
+	if err := CreateTag("alice", tag); err != nil {
+		t.Fatal(err)
+	}
+	tracked := createTestEstimatedTodo(t, "接口", 60, EstimateMinutes, true, []string{tag.ID})
+	createTestEstimatedTodo(t, "页面", 3, EstimatePoints, true, nil)
+	createTestEstimatedTodo(t, "文档", 5, EstimatePoints, false, nil)
+
+	// 估算60分钟，实际计时90分钟
+	stoppedAt := time.Now().Add(-time.Hour)
+	entry := &TimeEntry{TodoID: tracked.ID, StartedAt: stoppedAt.Add(-90 * time.Minute), StoppedAt: &stoppedAt}
+	if _, err := CreateTimeEntry("alice", "laptop", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GetEffortReport("alice", EffortReportOptions{GroupBy: ReportByTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 2 || report.Rows[0].Key != tag.ID || report.Rows[1].Key != "" {
+		t.Fatalf("应该按标签分组，没有标签的分组排在最后: %+v", report.Rows)
+	}
+
+	backend := report.Rows[0]
+	if backend.EstimatedMinutes != 60 || backend.TrackedMinutes != 90 || backend.Accuracy != 1.5 {
+		t.Errorf("标签分组的工作量不正确: %+v", backend)
+	}
+	untagged := report.Rows[1]
+	if untagged.Name != "无标签" || untagged.EstimatedPoints != 8 || untagged.CompletedPoints != 3 || untagged.CompletedCount != 1 {
+		t.Errorf("无标签分组的工作量不正确: %+v", untagged)
+	}
+	if report.Total.TodoCount != 3 || report.Total.TrackedMinutes != 90 {
+		t.Errorf("合计不正确: %+v", report.Total)
+	}
+
+	if _, err := GetEffortReport("alice", EffortReportOptions{GroupBy: "month"}); err == nil {
+		t.Error("无效的分组方式应该报错")
+	}
+	if _, err := GetEffortReport("bob", EffortReportOptions{GroupBy: ReportByProject, ProjectID: "missing"}); err == nil {
+		t.Error("不存在的项目应该报错")
+	}
+}
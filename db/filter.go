@@ -0,0 +1,339 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 过滤条件不存在错误
+var errSavedFilterNotFound = errors.New("过滤条件不存在")
+
+// 保存的过滤条件表的列，与scanSavedFilter的顺序保持一致
+const savedFilterColumns = `id, user_id, name, icon, query, sort_order, deleted, created_at, updated_at`
+
+// 扫描一行过滤条件数据
+func scanSavedFilter(scanner rowScanner) (SavedFilter, error) {
+	var filter SavedFilter
+	var queryStr, createdAtStr, updatedAtStr string
+	var deletedInt int
+
+	err := scanner.Scan(
+		&filter.ID, &filter.UserID, &filter.Name, &filter.Icon, &queryStr,
+		&filter.SortOrder, &deletedInt, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return filter, err
+	}
+
+	if err := json.Unmarshal([]byte(queryStr), &filter.Query); err != nil {
+		return filter, fmt.Errorf("过滤条件 %s 的查询格式错误: %v", filter.ID, err)
+	}
+	filter.Deleted = intToBool(deletedInt)
+	filter.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// 执行过滤条件查询并扫描所有结果
+func querySavedFilters(query string, args ...interface{}) ([]SavedFilter, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := []SavedFilter{}
+	for rows.Next() {
+		filter, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, rows.Err()
+}
+
+// 保存过滤条件到数据库
+func SaveSavedFilterToDB(filter *SavedFilter) error {
+	queryJSON, err := json.Marshal(filter.Query)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO saved_filters (` + savedFilterColumns + `) VALUES (` + placeholders(9) + `)`
+	_, err = db.Exec(query,
+		filter.ID, filter.UserID, filter.Name, filter.Icon, string(queryJSON),
+		filter.SortOrder, boolToInt(filter.Deleted), timeToString(filter.CreatedAt), timeToString(filter.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID从数据库获取过滤条件（不做权限检查）
+func GetSavedFilterFromDB(filterID string) (*SavedFilter, error) {
+	query := `SELECT ` + savedFilterColumns + ` FROM saved_filters WHERE id = ?`
+
+	filter, err := scanSavedFilter(db.QueryRow(query, filterID))
+	if err == sql.ErrNoRows {
+		return nil, errSavedFilterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// 获取用户所有未删除的过滤条件
+func GetUserSavedFiltersFromDB(userID string) ([]SavedFilter, error) {
+	query := `
+	SELECT ` + savedFilterColumns + `
+	FROM saved_filters
+	WHERE user_id = ? AND deleted = 0
+	ORDER BY sort_order ASC, name ASC
+	`
+	return querySavedFilters(query, userID)
+}
+
+// 获取某个时间点之后更新的过滤条件（包含已删除的过滤条件，用于同步删除）
+func GetSavedFiltersUpdatedAfterFromDB(userID string, timestamp time.Time) ([]SavedFilter, error) {
+	query := `
+	SELECT ` + savedFilterColumns + `
+	FROM saved_filters
+	WHERE user_id = ? AND updated_at > ?
+	ORDER BY updated_at ASC
+	`
+	return querySavedFilters(query, userID, timeToString(timestamp))
+}
+
+// TodoQuery 将保存的查询条件转换为任务列表查询，相对时间按now和查询的时区计算
+// loc不为nil时代替查询中保存的时区，userID用于查询语言中的assignee:me
+func (q *SavedFilterQuery) TodoQuery(userID string, now time.Time, loc *time.Location) (TodoQuery, error) {
+	result := TodoQuery{
+		TodoFilter: TodoFilter{
+			View:       q.View,
+			Completed:  q.Completed,
+			ProjectID:  q.ProjectID,
+			Category:   q.Category,
+			ListID:     q.ListID,
+			Priorities: q.Priorities,
+			Statuses:   q.Statuses,
+			TagIDs:     q.TagIDs,
+			Text:       q.Text,
+		},
+		Sort: q.Sort,
+	}
+
+	if loc == nil {
+		var err error
+		loc, err = locationOf(q.TimeZone)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// 到期范围：只有日期的截止时间在当天结束时逾期，因此“今天到期”是逾期时间在今天零点之后、明天零点之前（包含）
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	switch q.Due {
+	case "":
+	case DueOverdue:
+		result.DueBefore = now
+	case DueToday:
+		result.DueAfter = today
+		result.DueBefore = addDays(today, 1)
+	case DueThisWeek:
+		monday := addDays(today, -((int(today.Weekday()) + 6) % 7))
+		result.DueAfter = monday
+		result.DueBefore = addDays(monday, 7)
+	default:
+		return result, fmt.Errorf("无效的到期范围: %s", q.Due)
+	}
+
+	bounds := map[string]string{
+		BoundDueAfter:      q.DueAfter,
+		BoundDueBefore:     q.DueBefore,
+		BoundCreatedAfter:  q.CreatedAfter,
+		BoundCreatedBefore: q.CreatedBefore,
+		BoundUpdatedAfter:  q.UpdatedAfter,
+		BoundUpdatedBefore: q.UpdatedBefore,
+	}
+	for _, name := range TimeBoundParams {
+		if value := bounds[name]; value != "" {
+			if err := result.SetTimeBound(name, value, loc, now); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	expr, err := ParseQueryExpr(q.Expression, userID, loc, now)
+	if err != nil {
+		return result, err
+	}
+	result.Expr = expr
+
+	return result, nil
+}
+
+// 校验并规范化查询条件
+func validateSavedFilterQuery(q *SavedFilterQuery) error {
+	q.Text = strings.TrimSpace(q.Text)
+	for i, p := range q.Priorities {
+		parsed, err := ParsePriority(string(p))
+		if err != nil {
+			return err
+		}
+		q.Priorities[i] = parsed
+	}
+
+	query, err := q.TodoQuery("", time.Now(), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := parseTodoSort(query.Sort); err != nil {
+		return err
+	}
+	_, _, err = todoFilterCondition("", &query.TodoFilter)
+	return err
+}
+
+// 检查用户是否已有同名过滤条件（忽略大小写）
+func savedFilterNameExists(filter *SavedFilter) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+	SELECT COUNT(*) FROM saved_filters
+	WHERE deleted = 0 AND id != ? AND user_id = ? AND LOWER(name) = LOWER(?)
+	`, filter.ID, filter.UserID, filter.Name).Scan(&count)
+	return count > 0, err
+}
+
+// 校验名称、查询条件和名称是否重复
+func checkSavedFilter(filter *SavedFilter) error {
+	filter.Name = strings.TrimSpace(filter.Name)
+	if filter.Name == "" {
+		return errors.New("过滤条件名称不能为空")
+	}
+	if err := validateSavedFilterQuery(&filter.Query); err != nil {
+		return err
+	}
+
+	exists, err := savedFilterNameExists(filter)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("过滤条件名称已存在")
+	}
+	return nil
+}
+
+// CreateSavedFilter 创建过滤条件
+func CreateSavedFilter(userID string, filter *SavedFilter) error {
+	now := time.Now()
+	if filter.ID == "" {
+		filter.ID = generateUUID()
+	}
+	filter.UserID = userID
+	filter.Deleted = false
+	filter.CreatedAt = now
+	filter.UpdatedAt = now
+
+	if err := checkSavedFilter(filter); err != nil {
+		return err
+	}
+	return SaveSavedFilterToDB(filter)
+}
+
+// UpdateSavedFilter 更新过滤条件的名称、图标、查询条件和排序
+func UpdateSavedFilter(userID string, filter *SavedFilter) error {
+	existing, err := GetSavedFilterFromDB(filter.ID)
+	if err != nil || existing.Deleted || existing.UserID != userID {
+		return errors.New("过滤条件不存在或无权修改")
+	}
+
+	filter.UserID = existing.UserID
+	filter.Deleted = false
+	filter.CreatedAt = existing.CreatedAt
+	filter.UpdatedAt = time.Now()
+
+	if err := checkSavedFilter(filter); err != nil {
+		return err
+	}
+	return SaveSavedFilterToDB(filter)
+}
+
+// DeleteSavedFilter 删除过滤条件，保留删除标记用于同步
+func DeleteSavedFilter(userID, filterID string) error {
+	filter, err := GetSavedFilterFromDB(filterID)
+	if err != nil || filter.Deleted || filter.UserID != userID {
+		return errors.New("过滤条件不存在或无权删除")
+	}
+
+	_, err = db.Exec(`UPDATE saved_filters SET deleted = 1, updated_at = ? WHERE id = ?`, timeToString(time.Now()), filterID)
+	return err
+}
+
+// EvaluateSavedFilter 执行保存的过滤条件，loc不为nil时代替过滤条件中保存的时区
+func EvaluateSavedFilter(userID, filterID string, loc *time.Location, cursor string, limit int) (*TodoPage, error) {
+	filter, err := GetSavedFilterFromDB(filterID)
+	if err != nil || filter.Deleted || filter.UserID != userID {
+		return nil, errors.New("过滤条件不存在或无权访问")
+	}
+
+	query, err := filter.Query.TodoQuery(userID, time.Now(), loc)
+	if err != nil {
+		return nil, err
+	}
+	query.Cursor = cursor
+	query.Limit = limit
+	return QueryTodosFromDB(userID, query)
+}
+
+// 处理客户端同步的过滤条件，基于更新时间保留最新的版本
+func applyClientSavedFilters(userID string, filters []SavedFilter) error {
+	for _, filter := range filters {
+		existing, err := GetSavedFilterFromDB(filter.ID)
+		if err != nil && err != errSavedFilterNotFound {
+			return err
+		}
+		if err == errSavedFilterNotFound {
+			// 新过滤条件
+			if filter.Deleted {
+				continue
+			}
+			if err := CreateSavedFilter(userID, &filter); err != nil {
+				return fmt.Errorf("创建过滤条件 %s 失败: %v", filter.Name, err)
+			}
+			continue
+		}
+
+		if existing.UserID != userID {
+			return fmt.Errorf("无权修改过滤条件 %s", filter.ID)
+		}
+		// 服务器版本更新或过滤条件已删除时忽略客户端的修改
+		if existing.Deleted || !filter.UpdatedAt.After(existing.UpdatedAt) {
+			continue
+		}
+
+		if filter.Deleted {
+			err = DeleteSavedFilter(userID, filter.ID)
+		} else {
+			err = UpdateSavedFilter(userID, &filter)
+		}
+		if err != nil {
+			return fmt.Errorf("同步过滤条件 %s 失败: %v", filter.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSavedFilterQueryRelativeBounds(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UTC时间为周三晚上，上海已经是周四
+	now := time.Date(2026, 10, 14, 20, 0, 0, 0, time.UTC)
+
+	q := SavedFilterQuery{Due: DueToday, CreatedAfter: "-1d", TimeZone: "Asia/Shanghai"}
+	query, err := q.TodoQuery("user", now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Date(2026, 10, 15, 0, 0, 0, 0, shanghai)
+	if !query.DueAfter.Equal(today) || !query.DueBefore.Equal(today.AddDate(0, 0, 1)) {
+		t.Errorf("今天到期的范围应该按过滤条件的时区计算，实际为 %v - %v", query.DueAfter, query.DueBefore)
+	}
+	if !query.CreatedAfter.Equal(today.AddDate(0, 0, -1)) {
+		t.Errorf("相对天数应该按过滤条件的时区计算，实际为 %v", query.CreatedAfter)
+	}
+
+	q = SavedFilterQuery{Due: DueThisWeek}
+	query, err = q.TodoQuery("user", now, shanghai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, shanghai)
+	if !query.DueAfter.Equal(monday) || !query.DueBefore.Equal(monday.AddDate(0, 0, 7)) {
+		t.Errorf("本周到期的范围应该从周一开始，实际为 %v - %v", query.DueAfter, query.DueBefore)
+	}
+}
+
+func TestSavedFilterValidation(t *testing.T) {
+	setupTestDB(t)
+
+	filter := &SavedFilter{Name: "高优先级", Query: SavedFilterQuery{Priorities: []Priority{"高"}, Sort: "due"}}
+	if err := CreateSavedFilter("alice", filter); err != nil {
+		t.Fatal(err)
+	}
+	if filter.Query.Priorities[0] != PriorityHigh {
+		t.Errorf("优先级应该被规范化，实际为 %q", filter.Query.Priorities[0])
+	}
+
+	for name, q := range map[string]SavedFilterQuery{
+		"无效的优先级":   {Priorities: []Priority{"critical"}},
+		"无效的到期范围":  {Due: "someday"},
+		"无效的排序字段":  {Sort: "owner"},
+		"无效的时间范围":  {DueBefore: "tomorrow"},
+		"无效的时区":    {TimeZone: "Mars/Base"},
+		"无效的查询表达式": {Expression: "priority:"},
+	} {
+		if err := CreateSavedFilter("alice", &SavedFilter{Name: name, Query: q}); err == nil {
+			t.Errorf("%s应该报错", name)
+		}
+	}
+	if err := CreateSavedFilter("alice", &SavedFilter{Name: " 高优先级 "}); err == nil {
+		t.Error("同一用户不应该有同名的过滤条件")
+	}
+	if err := CreateSavedFilter("bob", &SavedFilter{Name: "高优先级"}); err != nil {
+		t.Errorf("不同用户可以使用相同的名称: %v", err)
+	}
+}
+
+func TestEvaluateSavedFilter(t *testing.T) {
+	setupTestDB(t)
+
+	high := createTestTodo(t, "alice", "", "重要任务")
+	high.Priority = PriorityHigh
+	if err := SaveTodoToDB(high); err != nil {
+		t.Fatal(err)
+	}
+	createTestTodo(t, "alice", "", "普通任务")
+
+	filter := &SavedFilter{Name: "重要", Query: SavedFilterQuery{Expression: "priority:>=high -is:completed"}}
+	if err := CreateSavedFilter("alice", filter); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := EvaluateSavedFilter("alice", filter.ID, nil, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != 1 || page.Todos[0].ID != high.ID {
+		t.Errorf("过滤条件应该只返回重要任务，实际为 %d 个任务", len(page.Todos))
+	}
+
+	if _, err := EvaluateSavedFilter("bob", filter.ID, nil, "", 0); err == nil {
+		t.Error("不应该可以执行其他用户的过滤条件")
+	}
+	if err := DeleteSavedFilter("alice", filter.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EvaluateSavedFilter("alice", filter.ID, nil, "", 0); err == nil {
+		t.Error("已删除的过滤条件不应该可以执行")
+	}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"time"
+)
+
+// 任务历史操作类型常量
+const (
+	HistoryAssigned   = "assigned"
+	HistoryUnassigned = "unassigned"
+
+	HistoryStatusChanged = "status_changed" // 看板状态变更，用于计算周期时间
+
+	HistoryCompleted = "completed"
+	HistoryReopened  = "reopened"
+	HistoryRenamed   = "renamed"
+
+	HistoryArchived   = "archived"
+	HistoryUnarchived = "unarchived"
+	HistoryTrashed    = "trashed"
+	HistoryRestored   = "restored"
+)
+
+// 记录任务变更历史
+func AddTodoHistory(todoID, userID, action, oldValue, newValue string) error {
+	query := `
+	INSERT INTO todo_history (id, todo_id, user_id, action, old_value, new_value, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := db.Exec(query, generateUUID(), todoID, userID, action, oldValue, newValue, timeToString(time.Now()))
+	return err
+}
+
+// RecordTodoChanges 记录任务保存前后的完成状态、名称和看板状态变更，新任务不记录
+func RecordTodoChanges(userID string, previous, todo *Todo) error {
+	if previous == nil {
+		return nil
+	}
+	if previous.Name != todo.Name {
+		if err := AddTodoHistory(todo.ID, userID, HistoryRenamed, previous.Name, todo.Name); err != nil {
+			return err
+		}
+	}
+	if previous.Completed != todo.Completed {
+		action := HistoryCompleted
+		if !todo.Completed {
+			action = HistoryReopened
+		}
+		if err := AddTodoHistory(todo.ID, userID, action, "", ""); err != nil {
+			return err
+		}
+	}
+	return RecordStatusChange(userID, previous, todo)
+}
+
+// 获取任务的变更历史（按时间正序）
+func GetTodoHistoryFromDB(todoID string) ([]TodoHistory, error) {
+	query := `
+	SELECT id, todo_id, user_id, action, old_value, new_value, created_at
+	FROM todo_history
+	WHERE todo_id = ?
+	ORDER BY created_at ASC, rowid ASC
+	`
+
+	rows, err := db.Query(query, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []TodoHistory{}
+	for rows.Next() {
+		var record TodoHistory
+		var createdAtStr string
+
+		err := rows.Scan(
+			&record.ID, &record.TodoID, &record.UserID, &record.Action,
+			&record.OldValue, &record.NewValue, &createdAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		record.CreatedAt, err = stringToTime(createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, record)
+	}
+
+	return history, rows.Err()
+}
+
+// 获取某个时间点之后用户失去访问权限（取消分配、被移出共享清单或清单被删除）、且目前仍无权查看的任务ID
+// 客户端同步时据此删除本地副本
+func GetRevokedTodoIDsAfterFromDB(userID string, timestamp time.Time) ([]string, error) {
+	query := `
+	SELECT todo_id FROM todo_history WHERE action = ? AND old_value = ? AND created_at > ?
+	UNION
+	SELECT todo_id FROM todo_revocations WHERE user_id = ? AND revoked_at > ?
+	`
+
+	ts := timeToString(timestamp)
+	rows, err := db.Query(query, HistoryUnassigned, userID, ts, userID, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []string
+	for rows.Next() {
+		var todoID string
+		if err := rows.Scan(&todoID); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, todoID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var revoked []string
+	for _, todoID := range candidates {
+		todo, err := GetTodoFromDB(todoID)
+		if err != nil || !CanViewTodo(userID, todo) {
+			revoked = append(revoked, todoID)
+		}
+	}
+	return revoked, nil
+}
@@ -0,0 +1,530 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 清单成员角色常量
+const (
+	ListRoleViewer = "viewer" // 只能查看清单中的任务
+	ListRoleEditor = "editor" // 可以创建、修改、删除清单中的任务
+	ListRoleAdmin  = "admin"  // 可以管理清单成员和邀请
+)
+
+// 清单邀请状态常量
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// 角色权限等级，数值越大权限越高
+func listRoleLevel(role string) int {
+	switch role {
+	case ListRoleViewer:
+		return 1
+	case ListRoleEditor:
+		return 2
+	case ListRoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// 检查清单角色是否有效
+func IsValidListRole(role string) bool {
+	return listRoleLevel(role) > 0
+}
+
+// 创建共享清单，创建者自动成为清单管理员
+func CreateList(ownerID, name string) (*List, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("清单名称不能为空")
+	}
+
+	now := time.Now()
+	list := &List{
+		ID:        generateUUID(),
+		Name:      name,
+		OwnerID:   ownerID,
+		Role:      ListRoleAdmin,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO lists (id, name, owner_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	`, list.ID, list.Name, list.OwnerID, timeToString(list.CreatedAt), timeToString(list.UpdatedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO list_members (list_id, user_id, role, joined_at)
+	VALUES (?, ?, ?, ?)
+	`, list.ID, ownerID, ListRoleAdmin, timeToString(now))
+	if err != nil {
+		return nil, err
+	}
+
+	return list, tx.Commit()
+}
+
+// 从数据库获取清单
+func GetListFromDB(listID string) (*List, error) {
+	query := `
+	SELECT id, name, owner_id, created_at, updated_at
+	FROM lists
+	WHERE id = ?
+	`
+
+	var list List
+	var createdAtStr, updatedAtStr string
+
+	err := db.QueryRow(query, listID).Scan(&list.ID, &list.Name, &list.OwnerID, &createdAtStr, &updatedAtStr)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("清单不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	list.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// 获取用户所在的所有清单，并填充用户在清单中的角色
+func GetUserListsFromDB(userID string) ([]List, error) {
+	query := `
+	SELECT l.id, l.name, l.owner_id, m.role, l.created_at, l.updated_at
+	FROM lists l
+	JOIN list_members m ON m.list_id = l.id
+	WHERE m.user_id = ?
+	ORDER BY l.created_at ASC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		var createdAtStr, updatedAtStr string
+
+		err := rows.Scan(&list.ID, &list.Name, &list.OwnerID, &list.Role, &createdAtStr, &updatedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		list.CreatedAt, err = stringToTime(createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		list.UpdatedAt, err = stringToTime(updatedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+// 重命名清单
+func RenameList(listID, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("清单名称不能为空")
+	}
+
+	result, err := db.Exec(`UPDATE lists SET name = ?, updated_at = ? WHERE id = ?`, name, timeToString(time.Now()), listID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("清单不存在")
+	}
+	return nil
+}
+
+// 删除清单及其中的任务、成员和邀请
+// 任务与单独删除时一样彻底删除并记录删除标记，同时为所有成员记录访问撤销，使成员的设备同步删除本地副本
+func DeleteList(listID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := recordListRevocations(tx, listID, "", time.Now()); err != nil {
+		return err
+	}
+
+	var ids []interface{}
+	rows, err := tx.Query(`SELECT id FROM todos WHERE list_id = ?`, listID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var hashes []string
+	for start := 0; start < len(ids); start += tagQueryBatchSize {
+		end := start + tagQueryBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batchHashes, err := purgeTodoRows(tx, ids[start:end])
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, batchHashes...)
+	}
+
+	statements := []string{
+		`DELETE FROM list_members WHERE list_id = ?`,
+		`DELETE FROM list_invitations WHERE list_id = ?`,
+		`DELETE FROM lists WHERE id = ?`,
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement, listID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	removeBlobs(hashes)
+	return nil
+}
+
+// 记录清单成员失去清单中所有任务的访问权限，userID为空时记录所有成员
+func recordListRevocations(tx *sql.Tx, listID, userID string, now time.Time) error {
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO todo_revocations (todo_id, user_id, revoked_at)
+	SELECT t.id, m.user_id, ? FROM todos t JOIN list_members m ON m.list_id = t.list_id
+	WHERE t.list_id = ? AND (? = '' OR m.user_id = ?)
+	`, timeToString(now), listID, userID, userID)
+	return err
+}
+
+// 获取用户在清单中的角色
+func GetListMemberRole(listID, userID string) (string, error) {
+	var role string
+	err := db.QueryRow(`SELECT role FROM list_members WHERE list_id = ? AND user_id = ?`, listID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", errors.New("不是该清单的成员")
+	}
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// 检查用户在清单中是否至少拥有指定角色
+func HasListRole(listID, userID, role string) bool {
+	memberRole, err := GetListMemberRole(listID, userID)
+	if err != nil {
+		return false
+	}
+	return listRoleLevel(memberRole) >= listRoleLevel(role)
+}
+
+// 获取清单的所有成员
+func GetListMembersFromDB(listID string) ([]ListMember, error) {
+	query := `
+	SELECT list_id, user_id, role, joined_at
+	FROM list_members
+	WHERE list_id = ?
+	ORDER BY joined_at ASC
+	`
+
+	rows, err := db.Query(query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var member ListMember
+		var joinedAtStr string
+
+		err := rows.Scan(&member.ListID, &member.UserID, &member.Role, &joinedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		member.JoinedAt, err = stringToTime(joinedAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		if user, err := GetUserByID(member.UserID); err == nil {
+			member.Username = user.Username
+		}
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// 修改清单成员角色，清单创建者的角色不能修改
+func UpdateListMemberRole(listID, userID, role string) error {
+	if !IsValidListRole(role) {
+		return errors.New("无效的清单角色")
+	}
+
+	list, err := GetListFromDB(listID)
+	if err != nil {
+		return err
+	}
+	if list.OwnerID == userID {
+		return errors.New("不能修改清单创建者的角色")
+	}
+
+	result, err := db.Exec(`UPDATE list_members SET role = ? WHERE list_id = ? AND user_id = ?`, role, listID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("成员不存在")
+	}
+	return nil
+}
+
+// 移除清单成员，清单创建者不能被移除
+func RemoveListMember(listID, userID string) error {
+	list, err := GetListFromDB(listID)
+	if err != nil {
+		return err
+	}
+	if list.OwnerID == userID {
+		return errors.New("不能移除清单创建者")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 被移除的成员的设备同步时删除清单中任务的本地副本
+	now := time.Now()
+	if err := recordListRevocations(tx, listID, userID, now); err != nil {
+		return err
+	}
+	// 任务负责人可以访问任务，取消分配给该成员的任务，否则移除后仍然可以查看和修改
+	_, err = tx.Exec(`UPDATE todos SET assignee_id = '', updated_at = ? WHERE list_id = ? AND assignee_id = ?`,
+		timeToString(now), listID, userID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM list_members WHERE list_id = ? AND user_id = ?`, listID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("成员不存在")
+	}
+	return tx.Commit()
+}
+
+// 通过用户名或邮箱邀请用户加入清单
+func InviteToList(listID, inviterID, identifier, role string) (*ListInvitation, error) {
+	if !IsValidListRole(role) {
+		return nil, errors.New("无效的清单角色")
+	}
+
+	invitee, err := FindUserByUsernameOrEmail(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := GetListMemberRole(listID, invitee.ID); err == nil {
+		return nil, errors.New("该用户已是清单成员")
+	}
+
+	var pending int
+	err = db.QueryRow(`
+	SELECT COUNT(*) FROM list_invitations
+	WHERE list_id = ? AND invitee_id = ? AND status = ?
+	`, listID, invitee.ID, InvitationPending).Scan(&pending)
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, errors.New("已向该用户发送过邀请")
+	}
+
+	invitation := &ListInvitation{
+		ID:        generateUUID(),
+		ListID:    listID,
+		InviterID: inviterID,
+		InviteeID: invitee.ID,
+		Role:      role,
+		Status:    InvitationPending,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = db.Exec(`
+	INSERT INTO list_invitations (id, list_id, inviter_id, invitee_id, role, status, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, invitation.ID, invitation.ListID, invitation.InviterID, invitation.InviteeID,
+		invitation.Role, invitation.Status, timeToString(invitation.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// 获取用户待处理的清单邀请
+func GetPendingInvitationsFromDB(userID string) ([]ListInvitation, error) {
+	query := `
+	SELECT i.id, i.list_id, l.name, i.inviter_id, i.invitee_id, i.role, i.status, i.created_at
+	FROM list_invitations i
+	JOIN lists l ON l.id = i.list_id
+	WHERE i.invitee_id = ? AND i.status = ?
+	ORDER BY i.created_at DESC
+	`
+
+	rows, err := db.Query(query, userID, InvitationPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []ListInvitation{}
+	for rows.Next() {
+		var invitation ListInvitation
+		var createdAtStr string
+
+		err := rows.Scan(
+			&invitation.ID, &invitation.ListID, &invitation.ListName, &invitation.InviterID,
+			&invitation.InviteeID, &invitation.Role, &invitation.Status, &createdAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitation.CreatedAt, err = stringToTime(createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// 接受或拒绝清单邀请
+func RespondToInvitation(invitationID, userID string, accept bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var listID, role, status string
+	err = tx.QueryRow(`
+	SELECT list_id, role, status FROM list_invitations
+	WHERE id = ? AND invitee_id = ?
+	`, invitationID, userID).Scan(&listID, &role, &status)
+	if err == sql.ErrNoRows {
+		return errors.New("邀请不存在")
+	}
+	if err != nil {
+		return err
+	}
+	if status != InvitationPending {
+		return fmt.Errorf("邀请已处理: %s", status)
+	}
+
+	newStatus := InvitationDeclined
+	if accept {
+		newStatus = InvitationAccepted
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO list_members (list_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)
+		`, listID, userID, role, timeToString(time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE list_invitations SET status = ? WHERE id = ?`, newStatus, invitationID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 检查用户是否可以查看任务，任务负责人也可以查看
+func CanViewTodo(userID string, todo *Todo) bool {
+	if todo.AssigneeID != "" && todo.AssigneeID == userID {
+		return true
+	}
+	if todo.ListID == "" {
+		return todo.UserID == userID
+	}
+	return HasListRole(todo.ListID, userID, ListRoleViewer)
+}
+
+// 检查用户是否可以修改任务，任务负责人也可以修改
+func CanEditTodo(userID string, todo *Todo) bool {
+	if todo.AssigneeID != "" && todo.AssigneeID == userID {
+		return true
+	}
+	return CanDeleteTodo(userID, todo)
+}
+
+// 检查用户是否可以删除或移动任务（创建者或清单编辑者）
+func CanDeleteTodo(userID string, todo *Todo) bool {
+	if todo.ListID == "" {
+		return todo.UserID == userID
+	}
+	return HasListRole(todo.ListID, userID, ListRoleEditor)
+}
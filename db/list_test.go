@@ -0,0 +1,140 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemoveListMemberRevokesTodos(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleEditor)
+	todo := createTestTodo(t, "owner", list.ID, "共享任务")
+	before := time.Now().Add(-time.Second)
+
+	if err := RemoveListMember(list.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := GetRevokedTodoIDsAfterFromDB("member", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(revoked, todo.ID) {
+		t.Errorf("被移除的成员应该收到任务的删除通知，实际为 %v", revoked)
+	}
+
+	revoked, err = GetRevokedTodoIDsAfterFromDB("owner", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 0 {
+		t.Errorf("仍然是成员的用户不应该收到删除通知，实际为 %v", revoked)
+	}
+
+	// 重新加入清单后可以再次访问，不再通知删除
+	addTestListMember(t, list.ID, "member", ListRoleViewer)
+	revoked, err = GetRevokedTodoIDsAfterFromDB("member", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 0 {
+		t.Errorf("重新加入清单后不应该收到删除通知，实际为 %v", revoked)
+	}
+}
+
+func TestDeleteListPurgesTodos(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleEditor)
+	todo := createTestTodo(t, "owner", list.ID, "共享任务")
+	other := createTestTodo(t, "owner", "", "个人任务")
+	if _, err := db.Exec(`INSERT INTO todo_tags (todo_id, tag_id) VALUES (?, ?)`, todo.ID, "tag"); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+
+	if err := DeleteList(list.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetTodoFromDB(todo.ID); err == nil {
+		t.Error("清单中的任务应该被删除")
+	}
+	if _, err := GetTodoFromDB(other.ID); err != nil {
+		t.Errorf("其他任务不应该被删除: %v", err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM todo_tags WHERE todo_id = ?`, todo.ID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("任务的标签关联应该被删除，实际剩余 %d 条", count)
+	}
+	if purged, err := IsTodoPurged(todo.ID); err != nil || !purged {
+		t.Errorf("应该记录任务的删除标记: %v", err)
+	}
+
+	for _, userID := range []string{"owner", "member"} {
+		revoked, err := GetRevokedTodoIDsAfterFromDB(userID, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !containsString(revoked, todo.ID) {
+			t.Errorf("清单成员 %s 应该收到任务的删除通知，实际为 %v", userID, revoked)
+		}
+	}
+}
+
+func TestRemoveListMemberUnassignsTodos(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleViewer)
+	todo := createTestTodo(t, "owner", list.ID, "分配给成员的任务")
+	todo.AssigneeID = "member"
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	personal := createTestTodo(t, "owner", "", "个人任务")
+	personal.AssigneeID = "member"
+	if err := SaveTodoToDB(personal); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+
+	if err := RemoveListMember(list.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+
+	todo, err = GetTodoFromDB(todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.AssigneeID != "" || CanViewTodo("member", todo) || CanEditTodo("member", todo) {
+		t.Errorf("被移除的成员不应该再负责和访问清单中的任务，负责人为 %q", todo.AssigneeID)
+	}
+	revoked, err := GetRevokedTodoIDsAfterFromDB("member", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(revoked, todo.ID) || containsString(revoked, personal.ID) {
+		t.Errorf("应该只通知删除清单中的任务，实际为 %v", revoked)
+	}
+
+	// 清单外的个人任务不受影响
+	if personal, err = GetTodoFromDB(personal.ID); err != nil || personal.AssigneeID != "member" {
+		t.Errorf("个人任务的负责人不应该改变: %v", err)
+	}
+}
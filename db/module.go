@@ -10,6 +10,8 @@ type User struct {
 	Username  string    `json:"username"`
 	Password  string    `json:"password_hash,omitempty"` // 存储密码哈希值，不返回给前端
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`     // 用户角色（user/admin）
+	Disabled  bool      `json:"disabled"` // 账号是否被禁用
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -26,22 +28,271 @@ type Device struct {
 // Todo 任务结构体，增加用户ID关联
 type Todo struct {
 	ID          string    `json:"id"`
-	UserID      string    `json:"user_id"`             // 关联用户ID
-	DeviceID    string    `json:"device_id,omitempty"` // 创建任务的设备ID
+	UserID      string    `json:"user_id"`               // 关联用户ID
+	DeviceID    string    `json:"device_id,omitempty"`   // 创建任务的设备ID
+	ListID      string    `json:"list_id,omitempty"`     // 所属共享清单ID，为空表示个人任务
+	AssigneeID  string    `json:"assignee_id,omitempty"` // 任务负责人ID
+	ProjectID   string    `json:"project_id,omitempty"`  // 所属项目ID
+	TagIDs      []string  `json:"tag_ids"`               // 标签ID列表，提交时不传表示不修改
+	ParentID    string    `json:"parent_id,omitempty"`   // 父任务ID，为空表示顶层任务
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Completed   bool      `json:"completed"`
 	CreateAt    time.Time `json:"created_at"`
 	UpdateAt    time.Time `json:"updated_at"` // 增加更新时间字段用于冲突解决
-	DeadLine    string    `json:"deadline"`   // 任务截止时间
-	Category    string    `json:"category"`   // 任务分类
-	Priority    string    `json:"priority"`   // 任务优先级
+	DeadLine    Deadline  `json:"deadline"`   // 任务截止时间，只有日期或带时区的日期时间
+	Category    string    `json:"category"`   // 任务分类（已废弃，保留给旧客户端，与所属项目名称一致）
+	Priority    Priority  `json:"priority"`   // 任务优先级：low、medium、high、urgent或空
+
+	// 重复任务
+	Recurrence      string `json:"recurrence,omitempty"`       // RFC 5545 RRULE重复规则，例如FREQ=WEEKLY;BYDAY=MO,WE
+	TimeZone        string `json:"time_zone,omitempty"`        // IANA时区，例如Asia/Shanghai，用于解释截止时间和计算下一次重复
+	SeriesID        string `json:"series_id,omitempty"`        // 重复序列ID，即第一次任务的ID
+	OccurrenceIndex int    `json:"occurrence_index,omitempty"` // 本次任务在重复序列中的序号，从1开始
+
+	// 在清单、项目和父任务中的手动排序位置（分数索引），按字符串顺序排列
+	Position string `json:"position"`
+
+	// 在所属项目工作流中的状态，完成标记由状态是否为完成状态决定
+	Status string `json:"status"`
+
+	// 工作量估算，单位为分钟或故事点，为0表示没有估算
+	Estimate     float64      `json:"estimate,omitempty"`
+	EstimateUnit EstimateUnit `json:"estimate_unit,omitempty"`
+
+	// 所属项目中定义的自定义字段的值，按字段标识保存
+	CustomFields map[string]interface{} `json:"custom_fields"`
+
+	// 归档和移入回收站的时间，为空表示未归档、不在回收站，通过归档和回收站接口修改
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+
+	// 以下字段由服务器根据子任务计算，不保存到数据库
+	SubtaskCount     int `json:"subtask_count"`     // 所有层级的子任务数量
+	SubtaskCompleted int `json:"subtask_completed"` // 已完成的子任务数量
+	Progress         int `json:"progress"`          // 完成百分比，没有子任务时按自身完成状态计算
+
+	// 以下字段由服务器根据依赖关系计算，依赖通过依赖接口修改
+	BlockedBy []string `json:"blocked_by"` // 前置任务ID
+	Blocked   bool     `json:"blocked"`    // 是否有未完成的前置任务
+}
+
+// List 共享清单结构体
+type List struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   string    `json:"owner_id"`       // 清单创建者，不能被移除
+	Role      string    `json:"role,omitempty"` // 当前用户在清单中的角色（仅查询时填充）
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListMember 清单成员结构体
+type ListMember struct {
+	ListID   string    `json:"list_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username,omitempty"` // 仅查询时填充
+	Role     string    `json:"role"`               // viewer/editor/admin
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ListInvitation 清单邀请结构体
+type ListInvitation struct {
+	ID        string    `json:"id"`
+	ListID    string    `json:"list_id"`
+	ListName  string    `json:"list_name,omitempty"` // 仅查询时填充
+	InviterID string    `json:"inviter_id"`
+	InviteeID string    `json:"invitee_id"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"` // pending/accepted/declined
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Project 项目结构体，取代自由填写的分类字符串
+type Project struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`             // 创建者ID
+	ListID    string    `json:"list_id,omitempty"`   // 所属共享清单ID，为空表示个人项目
+	ParentID  string    `json:"parent_id,omitempty"` // 父项目ID
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Icon      string    `json:"icon"`
+	Archived  bool      `json:"archived"`
+	SortOrder int       `json:"sort_order"`
+	Workflow  *Workflow `json:"workflow,omitempty"` // 看板工作流，为空表示使用默认工作流
+	Deleted   bool      `json:"deleted,omitempty"`  // 删除标记，用于同步删除到其他设备
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CustomFields []CustomField `json:"custom_fields,omitempty"` // 项目任务的自定义字段定义
+}
+
+// Tag 标签结构体，一个任务可以有多个标签
+type Tag struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`           // 创建者ID
+	ListID     string    `json:"list_id,omitempty"` // 所属共享清单ID，为空表示个人标签
+	Name       string    `json:"name"`
+	Color      string    `json:"color"`
+	Deleted    bool      `json:"deleted,omitempty"`     // 删除标记，用于同步删除到其他设备
+	MergedInto string    `json:"merged_into,omitempty"` // 被合并到的目标标签ID
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TodoHistory 任务变更历史记录
+type TodoHistory struct {
+	ID        string    `json:"id"`
+	TodoID    string    `json:"todo_id"`
+	UserID    string    `json:"user_id"` // 操作者ID
+	Action    string    `json:"action"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-// 内存存储（临时）
+// 内存存储（临时），任务已迁移到SQLite
 var Users []User
 var Devices []Device
-var Todos []Todo
 
 // 数据库操作接口（后续会替换为实际数据库实现）
 // 这里保留接口定义，便于后续实现数据库持久化
+
+// Reminder 任务提醒，可以是绝对时间，也可以是截止时间之前的偏移量
+type Reminder struct {
+	ID            string    `json:"id"`
+	TodoID        string    `json:"todo_id"`
+	UserID        string    `json:"user_id"`                  // 接收提醒的用户ID
+	Channel       string    `json:"channel"`                  // 通知渠道：feed、webhook或email
+	Target        string    `json:"target,omitempty"`         // webhook地址，邮件总是发送到用户账号的邮箱
+	Relative      bool      `json:"relative"`                 // 是否相对截止时间提醒
+	OffsetMinutes int       `json:"offset_minutes,omitempty"` // 截止时间之前多少分钟提醒
+	RemindAt      time.Time `json:"remind_at"`                // 提醒时间，相对提醒但任务没有截止时间时为零值
+	Status        string    `json:"status"`                   // pending、sending、sent、failed或cancelled
+	Attempts      int       `json:"attempts"`                 // 已尝试发送的次数
+	LastError     string    `json:"last_error,omitempty"`
+	FiredAt       time.Time `json:"fired_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Notification 应用内通知
+type Notification struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	TodoID     string    `json:"todo_id,omitempty"`
+	ReminderID string    `json:"reminder_id,omitempty"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	Read       bool      `json:"read"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SavedFilter 保存的过滤条件（智能清单），在用户的所有设备间同步
+type SavedFilter struct {
+	ID        string           `json:"id"`
+	UserID    string           `json:"user_id"`
+	Name      string           `json:"name"`
+	Icon      string           `json:"icon"`
+	Query     SavedFilterQuery `json:"query"`
+	SortOrder int              `json:"sort_order"`
+	Deleted   bool             `json:"deleted,omitempty"` // 删除标记，用于同步删除到其他设备
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// SavedFilterQuery 保存的查询条件，字段与任务列表的查询参数一致
+// 时间范围可以使用相对今天的天数（例如+7d），每次执行时重新计算
+type SavedFilterQuery struct {
+	View       string     `json:"view,omitempty"`
+	Completed  *bool      `json:"completed,omitempty"`
+	ProjectID  string     `json:"project_id,omitempty"`
+	Category   string     `json:"category,omitempty"`
+	ListID     string     `json:"list_id,omitempty"`
+	Priorities []Priority `json:"priorities,omitempty"`
+	Statuses   []string   `json:"statuses,omitempty"`
+	TagIDs     []string   `json:"tag_ids,omitempty"`
+	Text       string     `json:"text,omitempty"`
+	Due        string     `json:"due,omitempty"`        // overdue、today或week，按执行时的时间计算
+	Expression string     `json:"expression,omitempty"` // 查询语言表达式，例如priority:high due:<7d -completed
+
+	DueAfter      string `json:"due_after,omitempty"`
+	DueBefore     string `json:"due_before,omitempty"`
+	CreatedAfter  string `json:"created_after,omitempty"`
+	CreatedBefore string `json:"created_before,omitempty"`
+	UpdatedAfter  string `json:"updated_after,omitempty"`
+	UpdatedBefore string `json:"updated_before,omitempty"`
+
+	Sort     string `json:"sort,omitempty"`
+	TimeZone string `json:"time_zone,omitempty"` // 解释日期和相对时间使用的IANA时区，为空时使用服务器时区
+}
+
+// Comment 任务评论，正文为Markdown，删除后保留记录但清空正文
+type Comment struct {
+	ID        string    `json:"id"`
+	TodoID    string    `json:"todo_id"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"` // 作者用户名，读取时填充
+	Body      string    `json:"body"`
+	Mentions  []string  `json:"mentions"` // 被@提到的用户ID
+	Edited    bool      `json:"edited"`
+	Deleted   bool      `json:"deleted"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Attachment 任务附件，内容按SHA-256保存在BlobStore中
+type Attachment struct {
+	ID        string    `json:"id"`
+	TodoID    string    `json:"todo_id"`
+	UserID    string    `json:"user_id"` // 上传者，附件大小计入上传者的配额
+	BlobHash  string    `json:"sha256"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"` // 根据文件内容识别的类型
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TimeEntry 任务的计时记录，StoppedAt为空表示计时器正在运行
+// Duration为计时秒数，正在运行的计时器计算到当前时间
+type TimeEntry struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	TodoID    string     `json:"todo_id"`
+	DeviceID  string     `json:"device_id"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	Duration  int64      `json:"duration"`
+	Running   bool       `json:"running"`
+	Note      string     `json:"note"`
+	Deleted   bool       `json:"deleted,omitempty"` // 删除标记，用于同步删除到其他设备
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Template 任务模板，实例化时按开始日期一次创建模板中的所有任务
+type Template struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`           // 创建者ID
+	ListID      string         `json:"list_id,omitempty"` // 所属共享清单ID，为空表示个人模板
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Items       []TemplateItem `json:"items"` // 父任务排在子任务之前
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// TemplateItem 模板中的一个任务，子任务通过ParentRef引用父任务的Ref
+type TemplateItem struct {
+	Ref           string                 `json:"ref"` // 模板内的标识，不传时自动生成
+	ParentRef     string                 `json:"parent_ref,omitempty"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description,omitempty"`
+	Priority      Priority               `json:"priority,omitempty"`
+	Tags          []string               `json:"tags,omitempty"`            // 标签名称，实例化时在目标清单中查找或创建
+	DueOffsetDays *int                   `json:"due_offset_days,omitempty"` // 截止日期相对开始日期的天数，为空表示没有截止时间
+	DueTime       string                 `json:"due_time,omitempty"`        // 截止时刻（15:04），为空表示只有日期
+	Estimate      float64                `json:"estimate,omitempty"`
+	EstimateUnit  EstimateUnit           `json:"estimate_unit,omitempty"`
+	CustomFields  map[string]interface{} `json:"custom_fields,omitempty"` // 目标项目中没有定义的字段会被忽略
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+)
+
+// 保存应用内通知
+func SaveNotificationToDB(notification *Notification) error {
+	if notification.ID == "" {
+		notification.ID = generateUUID()
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	_, err := db.Exec(`
+	INSERT OR REPLACE INTO notifications (id, user_id, todo_id, reminder_id, title, body, read, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, notification.ID, notification.UserID, notification.TodoID, notification.ReminderID,
+		notification.Title, notification.Body, boolToInt(notification.Read), timeToString(notification.CreatedAt))
+	return err
+}
+
+// 获取用户的应用内通知，按时间倒序
+func GetUserNotificationsFromDB(userID string, unreadOnly bool, limit int) ([]Notification, error) {
+	query := `
+	SELECT id, user_id, todo_id, reminder_id, title, body, read, created_at
+	FROM notifications
+	WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read = 0`
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+
+	rows, err := db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var readInt int
+		var createdAtStr string
+		err := rows.Scan(
+			&notification.ID, &notification.UserID, &notification.TodoID, &notification.ReminderID,
+			&notification.Title, &notification.Body, &readInt, &createdAtStr,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notification.Read = intToBool(readInt)
+		notification.CreatedAt, err = stringToTime(createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+// 将用户的通知标记为已读，ids为空时标记全部
+func MarkNotificationsRead(userID string, ids []string) error {
+	if len(ids) == 0 {
+		_, err := db.Exec(`UPDATE notifications SET read = 1 WHERE user_id = ?`, userID)
+		return err
+	}
+
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := db.Exec(`UPDATE notifications SET read = 1 WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)`, args...)
+	return err
+}
@@ -0,0 +1,404 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 任务的手动排序使用分数索引：position是可以按字符串比较的键，
+// 在两个任务之间插入时生成一个介于两者之间的新键，只需要修改被移动的任务
+
+// 分数索引使用的字符，按ASCII顺序排列
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// 最小的整数部分，不能作为键使用
+var smallestPositionInteger = "A" + strings.Repeat("0", 26)
+
+var errInvalidPosition = errors.New("无效的排序位置")
+
+// 整数部分的长度由第一个字符决定：a-z表示2到27位的正数，A-Z表示2到27位的负数
+func positionIntegerLength(head byte) (int, error) {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2, nil
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2, nil
+	}
+	return 0, errInvalidPosition
+}
+
+// 获取键的整数部分
+func positionIntegerPart(key string) (string, error) {
+	if key == "" {
+		return "", errInvalidPosition
+	}
+	n, err := positionIntegerLength(key[0])
+	if err != nil {
+		return "", err
+	}
+	if n > len(key) {
+		return "", errInvalidPosition
+	}
+	return key[:n], nil
+}
+
+// ValidatePosition 校验排序位置的格式
+func ValidatePosition(key string) error {
+	if key == smallestPositionInteger {
+		return errInvalidPosition
+	}
+	integer, err := positionIntegerPart(key)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(positionDigits, key[i]) < 0 {
+			return errInvalidPosition
+		}
+	}
+	// 小数部分不能以最小的字符结尾，否则无法在它之前插入
+	if len(key) > len(integer) && key[len(key)-1] == positionDigits[0] {
+		return errInvalidPosition
+	}
+	return nil
+}
+
+// 生成介于小数部分a和b之间的小数部分，b为空表示没有上限
+func positionMidpoint(a, b string) string {
+	if b != "" {
+		// 去掉相同的前缀
+		n := 0
+		for n < len(b) {
+			digit := positionDigits[0]
+			if n < len(a) {
+				digit = a[n]
+			}
+			if digit != b[n] {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + positionMidpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(positionDigits, a[0])
+	}
+	digitB := len(positionDigits)
+	if b != "" {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if a != "" {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + positionMidpoint(rest, "")
+}
+
+// 整数部分加一，超出范围时返回空字符串
+func incrementPositionInteger(x string) string {
+	head, digits := x[0], []byte(x[1:])
+	carry := true
+	for i := len(digits) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) + 1
+		if d == len(positionDigits) {
+			digits[i] = positionDigits[0]
+		} else {
+			digits[i] = positionDigits[d]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digits)
+	}
+
+	switch head {
+	case 'Z':
+		return "a" + string(positionDigits[0])
+	case 'z':
+		return ""
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, positionDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits)
+}
+
+// 整数部分减一，超出范围时返回空字符串
+func decrementPositionInteger(x string) string {
+	head, digits := x[0], []byte(x[1:])
+	last := positionDigits[len(positionDigits)-1]
+	borrow := true
+	for i := len(digits) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) - 1
+		if d == -1 {
+			digits[i] = last
+		} else {
+			digits[i] = positionDigits[d]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digits)
+	}
+
+	switch head {
+	case 'a':
+		return "Z" + string(last)
+	case 'A':
+		return ""
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, last)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits)
+}
+
+// PositionBetween 生成介于a和b之间的排序位置，a为空表示最前面，b为空表示最后面
+func PositionBetween(a, b string) (string, error) {
+	if a != "" {
+		if err := ValidatePosition(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := ValidatePosition(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("排序位置%s必须小于%s", a, b)
+	}
+
+	switch {
+	case a == "" && b == "":
+		return "a" + string(positionDigits[0]), nil
+	case a == "":
+		ib, _ := positionIntegerPart(b)
+		fb := b[len(ib):]
+		if ib == smallestPositionInteger {
+			return ib + positionMidpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		if res := decrementPositionInteger(ib); res != "" {
+			return res, nil
+		}
+		return "", errors.New("排序位置超出范围")
+	case b == "":
+		ia, _ := positionIntegerPart(a)
+		fa := a[len(ia):]
+		if res := incrementPositionInteger(ia); res != "" {
+			return res, nil
+		}
+		return ia + positionMidpoint(fa, ""), nil
+	}
+
+	ia, _ := positionIntegerPart(a)
+	fa := a[len(ia):]
+	ib, _ := positionIntegerPart(b)
+	fb := b[len(ib):]
+	if ia == ib {
+		return ia + positionMidpoint(fa, fb), nil
+	}
+	res := incrementPositionInteger(ia)
+	if res == "" {
+		return "", errors.New("排序位置超出范围")
+	}
+	if res < b {
+		return res, nil
+	}
+	return ia + positionMidpoint(fa, ""), nil
+}
+
+// 同一排序范围中的任务：同一清单、同一项目、同一父任务，个人任务还需要是同一用户
+const positionScopeCondition = `list_id = ? AND project_id = ? AND parent_id = ? AND (list_id != '' OR user_id = ?)`
+
+func positionScopeArgs(todo *Todo) []interface{} {
+	return []interface{}{todo.ListID, todo.ProjectID, todo.ParentID, todo.UserID}
+}
+
+// SamePositionScope 两个任务是否在同一排序范围中
+func SamePositionScope(a, b *Todo) bool {
+	return a.ListID == b.ListID && a.ProjectID == b.ProjectID && a.ParentID == b.ParentID &&
+		(a.ListID != "" || a.UserID == b.UserID)
+}
+
+// 获取排序范围中介于某个位置之后（或之前）最近的位置，不包括任务自身
+func neighborPosition(todo *Todo, position string, after bool) (string, error) {
+	query := `SELECT COALESCE(MIN(position), '') FROM todos WHERE ` + positionScopeCondition + ` AND id != ? AND position != '' AND position > ?`
+	if !after {
+		query = `SELECT COALESCE(MAX(position), '') FROM todos WHERE ` + positionScopeCondition + ` AND id != ? AND position != '' AND position < ?`
+	}
+	args := append(positionScopeArgs(todo), todo.ID, position)
+
+	var neighbor string
+	err := db.QueryRow(query, args...).Scan(&neighbor)
+	return neighbor, err
+}
+
+// 排序范围中最后的位置，不包括任务自身
+func lastPosition(todo *Todo) (string, error) {
+	var last string
+	err := db.QueryRow(`SELECT COALESCE(MAX(position), '') FROM todos WHERE `+positionScopeCondition+` AND id != ?`,
+		append(positionScopeArgs(todo), todo.ID)...).Scan(&last)
+	return last, err
+}
+
+// 校验任务的排序位置，没有位置的任务排到最后
+// 不同设备同时把任务移动到同一个位置时会生成相同的键，此时把当前任务移到紧随其后的位置
+func ApplyTodoPosition(todo *Todo) error {
+	if todo.Position == "" {
+		last, err := lastPosition(todo)
+		if err != nil {
+			return err
+		}
+		todo.Position, err = PositionBetween(last, "")
+		return err
+	}
+
+	if err := ValidatePosition(todo.Position); err != nil {
+		return fmt.Errorf("%v: %s", err, todo.Position)
+	}
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM todos WHERE `+positionScopeCondition+` AND id != ? AND position = ?`,
+		append(positionScopeArgs(todo), todo.ID, todo.Position)...).Scan(&count)
+	if err != nil || count == 0 {
+		return err
+	}
+
+	next, err := neighborPosition(todo, todo.Position, true)
+	if err != nil {
+		return err
+	}
+	todo.Position, err = PositionBetween(todo.Position, next)
+	return err
+}
+
+// MoveTodo 将任务移动到afterID之后或beforeID之前，两者都为空时移动到最后
+// 只修改被移动任务的排序位置
+func MoveTodo(todo *Todo, afterID, beforeID string) error {
+	neighbor := func(id string) (*Todo, error) {
+		other, err := GetTodoFromDB(id)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("任务 %s 不存在", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !SamePositionScope(todo, other) {
+			return nil, errors.New("只能在同一清单、项目和父任务中调整顺序")
+		}
+		if other.Position == "" {
+			return nil, fmt.Errorf("任务 %s 没有排序位置", id)
+		}
+		return other, nil
+	}
+
+	var a, b string
+	var err error
+	switch {
+	case afterID == todo.ID || beforeID == todo.ID:
+		return errors.New("不能相对任务自身移动")
+	case afterID != "":
+		after, err := neighbor(afterID)
+		if err != nil {
+			return err
+		}
+		a = after.Position
+		if beforeID != "" {
+			before, err := neighbor(beforeID)
+			if err != nil {
+				return err
+			}
+			b = before.Position
+		} else if b, err = neighborPosition(todo, a, true); err != nil {
+			return err
+		}
+	case beforeID != "":
+		before, err := neighbor(beforeID)
+		if err != nil {
+			return err
+		}
+		b = before.Position
+		if a, err = neighborPosition(todo, b, false); err != nil {
+			return err
+		}
+	default:
+		if a, err = lastPosition(todo); err != nil {
+			return err
+		}
+	}
+
+	position, err := PositionBetween(a, b)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = db.Exec(`UPDATE todos SET position = ?, updated_at = ? WHERE id = ?`, position, timeToString(now), todo.ID)
+	if err != nil {
+		return err
+	}
+	todo.Position = position
+	todo.UpdateAt = now
+	return nil
+}
+
+// MigratePositions 为还没有排序位置的任务按创建时间依次生成排序位置
+func MigratePositions() error {
+	rows, err := db.Query(`SELECT ` + todoColumns + ` FROM todos WHERE position = '' ORDER BY created_at ASC, id ASC`)
+	if err != nil {
+		return err
+	}
+
+	var todos []Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		todos = append(todos, todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range todos {
+		if err := ApplyTodoPosition(&todos[i]); err != nil {
+			return err
+		}
+		_, err = db.Exec(`UPDATE todos SET position = ? WHERE id = ?`, todos[i].Position, todos[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string // 为空表示应该返回错误
+	}{
+		{"", "", "a0"},
+		{"", "a0", "Zz"},
+		{"", "Zz", "Zy"},
+		{"a0", "", "a1"},
+		{"a1", "", "a2"},
+		{"a0", "a1", "a0V"},
+		{"a1", "a2", "a1V"},
+		{"a0V", "a1", "a0l"},
+		{"Zz", "a0", "ZzV"},
+		{"Zz", "a1", "a0"},
+		{"", "Y00", "Xzzz"},
+		{"bzz", "", "c000"},
+		{"a0", "a0V", "a0G"},
+		{"a0", "a0G", "a08"},
+		{"b125", "b129", "b127"},
+		{"a0", "a1V", "a1"},
+		{"Zz", "a01", "a0"},
+		{"", "a0V", "a0"},
+		{"", "b999", "b99"},
+		{"", "A000000000000000000000000001", "A000000000000000000000000000V"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzy", "", "zzzzzzzzzzzzzzzzzzzzzzzzzzz"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzz", "", "zzzzzzzzzzzzzzzzzzzzzzzzzzzV"},
+		// 无效的位置
+		{"", "A00000000000000000000000000", ""},
+		{"a00", "", ""},
+		{"a00", "a1", ""},
+		{"0", "1", ""},
+		{"a1", "a0", ""},
+		{"a1", "a1", ""},
+		{"a!", "", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := PositionBetween(tt.a, tt.b)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("PositionBetween(%q, %q) 应该返回错误，实际为 %q", tt.a, tt.b, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("PositionBetween(%q, %q) = %q %v，期望 %q", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+}
+
+func TestPositionMidpoint(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"", "", "V"},
+		{"", "V", "G"},
+		{"V", "", "l"},
+		{"1", "2", "1V"},
+		{"y", "z", "yV"},
+		{"z", "", "zV"},
+		{"a1", "a2", "a1V"},
+		{"001", "002", "001V"},
+		{"", "01", "00V"},
+	}
+	for _, tt := range tests {
+		got := positionMidpoint(tt.a, tt.b)
+		if got != tt.want {
+			t.Errorf("positionMidpoint(%q, %q) = %q，期望 %q", tt.a, tt.b, got, tt.want)
+		}
+		if got <= tt.a || (tt.b != "" && got >= tt.b) {
+			t.Errorf("positionMidpoint(%q, %q) = %q 不在两者之间", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestPositionIntegerStep(t *testing.T) {
+	tests := []struct {
+		x, inc, dec string
+	}{
+		{"a0", "a1", "Zz"},
+		{"a1", "a2", "a0"},
+		{"az", "b00", "ay"},
+		{"b00", "b01", "az"},
+		{"Zz", "a0", "Zy"},
+		{"Y00", "Y01", "Xzzz"},
+		{"Xzzz", "Y00", "Xzzy"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzz", "", "zzzzzzzzzzzzzzzzzzzzzzzzzzy"},
+		{"A00000000000000000000000000", "A00000000000000000000000001", ""},
+	}
+	for _, tt := range tests {
+		if got := incrementPositionInteger(tt.x); got != tt.inc {
+			t.Errorf("incrementPositionInteger(%q) = %q，期望 %q", tt.x, got, tt.inc)
+		}
+		if got := decrementPositionInteger(tt.x); got != tt.dec {
+			t.Errorf("decrementPositionInteger(%q) = %q，期望 %q", tt.x, got, tt.dec)
+		}
+	}
+}
+
+func TestValidatePosition(t *testing.T) {
+	for _, key := range []string{"a0", "a0V", "Zz", "b12", "zzzzzzzzzzzzzzzzzzzzzzzzzzz", "A000000000000000000000000001"} {
+		if err := ValidatePosition(key); err != nil {
+			t.Errorf("%q 应该是有效的位置: %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "a", "b1", "a00", "a0-", "0", "A00000000000000000000000000", "a0 "} {
+		if err := ValidatePosition(key); err == nil {
+			t.Errorf("%q 应该是无效的位置", key)
+		}
+	}
+}
+
+// 反复在同一位置插入时生成的位置保持有序且唯一
+func TestPositionBetweenRepeatedInserts(t *testing.T) {
+	keys := []string{}
+	prepend, appendKey := "", ""
+	for i := 0; i < 200; i++ {
+		var err error
+		if prepend, err = PositionBetween("", firstOr(keys, "")); err != nil {
+			t.Fatal(err)
+		}
+		keys = append([]string{prepend}, keys...)
+		if appendKey, err = PositionBetween(keys[len(keys)-1], ""); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, appendKey)
+	}
+	// 不断在前两个位置之间插入
+	for i := 0; i < 200; i++ {
+		key, err := PositionBetween(keys[0], keys[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append([]string{keys[0], key}, keys[1:]...)
+	}
+
+	if !sort.StringsAreSorted(keys) {
+		t.Fatal("生成的位置没有按顺序排列")
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Fatalf("生成了重复的位置 %q", keys[i])
+		}
+		if err := ValidatePosition(keys[i]); err != nil {
+			t.Fatalf("生成了无效的位置 %q", keys[i])
+		}
+	}
+	// 位置的长度随插入次数缓慢增长
+	if length := len(keys[1]); length > 40 {
+		t.Errorf("连续插入200次后位置长度为 %d", length)
+	}
+}
+
+func firstOr(keys []string, def string) string {
+	if len(keys) == 0 {
+		return def
+	}
+	return keys[0]
+}
+
+// 按手动顺序返回任务名称
+func positionOrder(t *testing.T, userID string) string {
+	t.Helper()
+
+	page, err := QueryTodosFromDB(userID, TodoQuery{Sort: "position"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, todo := range page.Todos {
+		names = append(names, todo.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestMoveTodo(t *testing.T) {
+	setupTestDB(t)
+	a := createTestTodo(t, "user", "", "a")
+	b := createTestTodo(t, "user", "", "b")
+	c := createTestTodo(t, "user", "", "c")
+	if got := positionOrder(t, "user"); got != "a,b,c" {
+		t.Fatalf("新任务应该依次排到最后，实际为 %s", got)
+	}
+
+	steps := []struct {
+		todo            *Todo
+		afterID, before string
+		want            string
+	}{
+		{c, "", a.ID, "c,a,b"},
+		{c, a.ID, "", "a,c,b"},
+		{a, c.ID, b.ID, "c,a,b"},
+		{c, "", "", "a,b,c"},
+		{b, "", a.ID, "b,a,c"},
+	}
+	for _, step := range steps {
+		if err := MoveTodo(step.todo, step.afterID, step.before); err != nil {
+			t.Fatalf("移动任务 %s 失败: %v", step.todo.Name, err)
+		}
+		if got := positionOrder(t, "user"); got != step.want {
+			t.Errorf("移动任务 %s 后顺序为 %s，期望 %s", step.todo.Name, got, step.want)
+		}
+	}
+
+	other := createTestTodo(t, "other", "", "other")
+	if err := MoveTodo(a, other.ID, ""); err == nil {
+		t.Error("不同排序范围的任务之间不能移动")
+	}
+	if err := MoveTodo(a, a.ID, ""); err == nil {
+		t.Error("不能相对任务自身移动")
+	}
+}
+
+// 两个设备把任务移动到同一位置时，后保存的任务排在后面
+func TestApplyTodoPositionResolvesDuplicates(t *testing.T) {
+	setupTestDB(t)
+	a := createTestTodo(t, "user", "", "a")
+	b := createTestTodo(t, "user", "", "b")
+	c := createTestTodo(t, "user", "", "c")
+
+	c.Position = a.Position
+	if err := ApplyTodoPosition(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Position <= a.Position || c.Position >= b.Position {
+		t.Errorf("重复的位置应该移到 %s 和 %s 之间，实际为 %s", a.Position, b.Position, c.Position)
+	}
+
+	c.Position = "a00"
+	if err := ApplyTodoPosition(c); err == nil {
+		t.Error("无效的位置应该返回错误")
+	}
+}
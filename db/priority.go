@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Priority 任务优先级
+type Priority string
+
+// 任务优先级取值，空字符串表示未设置
+const (
+	PriorityNone   Priority = ""
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// 各优先级的排序值，数值越大优先级越高
+var priorityRanks = map[Priority]int{
+	PriorityNone:   0,
+	PriorityLow:    1,
+	PriorityMedium: 2,
+	PriorityHigh:   3,
+	PriorityUrgent: 4,
+}
+
+// 兼容旧客户端和旧数据的写法，包括前端使用过的中文标签
+var priorityAliases = map[string]Priority{
+	"none":   PriorityNone,
+	"无":      PriorityNone,
+	"l":      PriorityLow,
+	"低":      PriorityLow,
+	"m":      PriorityMedium,
+	"med":    PriorityMedium,
+	"normal": PriorityMedium,
+	"中":      PriorityMedium,
+	"普通":     PriorityMedium,
+	"h":      PriorityHigh,
+	"高":      PriorityHigh,
+	"重要":     PriorityHigh,
+	"紧急":     PriorityUrgent,
+}
+
+// ParsePriority 解析优先级，忽略大小写并兼容中文标签
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, ok := priorityRanks[Priority(s)]; ok {
+		return Priority(s), nil
+	}
+	if p, ok := priorityAliases[s]; ok {
+		return p, nil
+	}
+	return PriorityNone, fmt.Errorf("无效的优先级: %s，可选值为low、medium、high、urgent", s)
+}
+
+// Rank 优先级的排序值
+func (p Priority) Rank() int {
+	return priorityRanks[p]
+}
+
+// 校验并规范化任务的优先级
+func ApplyTodoPriority(todo *Todo) error {
+	p, err := ParsePriority(string(todo.Priority))
+	if err != nil {
+		return err
+	}
+	todo.Priority = p
+	return nil
+}
+
+// MigratePriorities 将旧版本自由填写的优先级转换为固定的取值并计算排序值
+// 无法识别的优先级会被清空
+func MigratePriorities() error {
+	rows, err := db.Query(`SELECT DISTINCT COALESCE(priority, '') FROM todos`)
+	if err != nil {
+		return err
+	}
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			rows.Close()
+			return err
+		}
+		values = append(values, value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		p, err := ParsePriority(value)
+		if err != nil {
+			log.Printf("无法识别的优先级 %q 已清空", value)
+		}
+		_, err = db.Exec(`UPDATE todos SET priority = ?, priority_rank = ? WHERE COALESCE(priority, '') = ? AND (priority IS NOT ? OR priority_rank != ?)`,
+			string(p), p.Rank(), value, string(p), p.Rank())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
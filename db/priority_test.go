@@ -0,0 +1,67 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Priority
+		valid bool
+	}{
+		{"", PriorityNone, true},
+		{"none", PriorityNone, true},
+		{" HIGH ", PriorityHigh, true},
+		{"med", PriorityMedium, true},
+		{"普通", PriorityMedium, true},
+		{"紧急", PriorityUrgent, true},
+		{"urgent", PriorityUrgent, true},
+		{"critical", PriorityNone, false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.input)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %q, %v，期望 %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestMigratePrioritiesAndOrdering(t *testing.T) {
+	setupTestDB(t)
+
+	for _, priority := range []string{"低", "URGENT", "随便", "normal", ""} {
+		todo := createTestTodo(t, "alice", "", priority)
+		if _, err := db.Exec(`UPDATE todos SET priority = ?, priority_rank = 0 WHERE id = ?`, priority, todo.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MigratePriorities(); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := QueryTodosFromDB("alice", TodoQuery{Sort: "-priority,name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var priorities []Priority
+	for _, todo := range page.Todos {
+		names = append(names, todo.Name)
+		priorities = append(priorities, todo.Priority)
+	}
+	// 无法识别的优先级被清空，未设置优先级的任务排在最后
+	wantPriorities := []Priority{PriorityUrgent, PriorityMedium, PriorityLow, PriorityNone, PriorityNone}
+	if !reflect.DeepEqual(priorities, wantPriorities) || names[0] != "URGENT" || names[2] != "低" {
+		t.Errorf("按优先级排序不正确: %v %v", names, priorities)
+	}
+
+	page, err = QueryTodosFromDB("alice", TodoQuery{TodoFilter: TodoFilter{Priorities: []Priority{PriorityLow, PriorityUrgent}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != 2 {
+		t.Errorf("按优先级过滤应该返回2个任务，实际为 %d", len(page.Todos))
+	}
+}
@@ -0,0 +1,513 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 项目不存在错误
+var errProjectNotFound = errors.New("项目不存在")
+
+// 项目嵌套的最大深度，防止异常数据导致无限循环
+const maxProjectDepth = 32
+
+// 项目表的列，与scanProject的顺序保持一致
+const projectColumns = `id, user_id, list_id, parent_id, name, color, icon, archived, sort_order, workflow, custom_fields, deleted, created_at, updated_at`
+
+// 用户可访问的按范围划分的数据（项目、标签等）：自己的个人数据或用户所在共享清单中的数据
+// 使用时需要传入两次用户ID
+const accessibleScopedCondition = `((list_id = '' AND user_id = ?) OR list_id IN (SELECT list_id FROM list_members WHERE user_id = ?))`
+
+// 扫描一行项目数据
+func scanProject(scanner rowScanner) (Project, error) {
+	var project Project
+	var archivedInt, deletedInt int
+	var workflowStr, customFieldsStr, createdAtStr, updatedAtStr string
+
+	err := scanner.Scan(
+		&project.ID, &project.UserID, &project.ListID, &project.ParentID, &project.Name,
+		&project.Color, &project.Icon, &archivedInt, &project.SortOrder, &workflowStr, &customFieldsStr, &deletedInt,
+		&createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return project, err
+	}
+
+	project.Workflow, err = stringToWorkflow(workflowStr)
+	if err != nil {
+		return project, fmt.Errorf("项目 %s 的工作流格式错误: %v", project.ID, err)
+	}
+	project.CustomFields, err = stringToCustomFields(customFieldsStr)
+	if err != nil {
+		return project, fmt.Errorf("项目 %s 的自定义字段格式错误: %v", project.ID, err)
+	}
+
+	project.Archived = intToBool(archivedInt)
+	project.Deleted = intToBool(deletedInt)
+	project.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return project, err
+	}
+
+	project.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return project, err
+	}
+
+	return project, nil
+}
+
+// 执行项目查询并扫描所有结果
+func queryProjects(query string, args ...interface{}) ([]Project, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, rows.Err()
+}
+
+// 保存项目到数据库
+func SaveProjectToDB(project *Project) error {
+	workflow, err := workflowToString(project.Workflow)
+	if err != nil {
+		return err
+	}
+	customFields, err := customFieldsToString(project.CustomFields)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO projects (` + projectColumns + `) VALUES (` + placeholders(14) + `)`
+	_, err = db.Exec(query,
+		project.ID, project.UserID, project.ListID, project.ParentID, project.Name,
+		project.Color, project.Icon, boolToInt(project.Archived), project.SortOrder, workflow, customFields, boolToInt(project.Deleted),
+		timeToString(project.CreatedAt), timeToString(project.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID从数据库获取项目（不做权限检查）
+func GetProjectFromDB(projectID string) (*Project, error) {
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE id = ?`
+
+	project, err := scanProject(db.QueryRow(query, projectID))
+	if err == sql.ErrNoRows {
+		return nil, errProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// 获取用户可访问的所有未删除项目
+func GetUserProjectsFromDB(userID string) ([]Project, error) {
+	query := `
+	SELECT ` + projectColumns + `
+	FROM projects
+	WHERE deleted = 0 AND ` + accessibleScopedCondition + `
+	ORDER BY sort_order ASC, created_at ASC
+	`
+	return queryProjects(query, userID, userID)
+}
+
+// 获取某个时间点之后更新的项目（包含已删除的项目，用于同步删除）
+func GetProjectsUpdatedAfterFromDB(userID string, timestamp time.Time) ([]Project, error) {
+	query := `
+	SELECT ` + projectColumns + `
+	FROM projects
+	WHERE ` + accessibleScopedCondition + `
+	  AND (updated_at > ? OR list_id IN (SELECT list_id FROM list_members WHERE user_id = ? AND joined_at > ?))
+	ORDER BY updated_at ASC
+	`
+	ts := timeToString(timestamp)
+	return queryProjects(query, userID, userID, ts, userID, ts)
+}
+
+// 检查用户是否可以查看项目
+func CanViewProject(userID string, project *Project) bool {
+	if project.ListID == "" {
+		return project.UserID == userID
+	}
+	return HasListRole(project.ListID, userID, ListRoleViewer)
+}
+
+// 检查用户是否可以修改项目
+func CanEditProject(userID string, project *Project) bool {
+	if project.ListID == "" {
+		return project.UserID == userID
+	}
+	return HasListRole(project.ListID, userID, ListRoleEditor)
+}
+
+// 验证项目的父项目：必须属于同一范围且不能形成循环
+func validateProjectParent(project *Project) error {
+	if project.ParentID == "" {
+		return nil
+	}
+	if project.ParentID == project.ID {
+		return errors.New("项目不能以自己为父项目")
+	}
+
+	parent, err := GetProjectFromDB(project.ParentID)
+	if err != nil || parent.Deleted {
+		return errors.New("父项目不存在")
+	}
+	if parent.ListID != project.ListID || (project.ListID == "" && parent.UserID != project.UserID) {
+		return errors.New("父项目必须与项目属于同一清单")
+	}
+
+	// 沿父项目链向上查找，检测循环引用
+	current := parent
+	for depth := 0; current.ParentID != ""; depth++ {
+		if depth >= maxProjectDepth {
+			return errors.New("项目层级过深")
+		}
+		if current.ParentID == project.ID {
+			return errors.New("父项目不能是该项目的子项目")
+		}
+		current, err = GetProjectFromDB(current.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 创建项目
+func CreateProject(userID string, project *Project) error {
+	project.Name = strings.TrimSpace(project.Name)
+	if project.Name == "" {
+		return errors.New("项目名称不能为空")
+	}
+	if project.ListID != "" && !HasListRole(project.ListID, userID, ListRoleEditor) {
+		return errors.New("无权在该清单中创建项目")
+	}
+
+	now := time.Now()
+	if project.ID == "" {
+		project.ID = generateUUID()
+	}
+	project.UserID = userID
+	project.Deleted = false
+	project.CreatedAt = now
+	project.UpdatedAt = now
+
+	if err := validateProjectParent(project); err != nil {
+		return err
+	}
+	if err := applyProjectWorkflow(project); err != nil {
+		return err
+	}
+	if err := applyProjectCustomFields(project); err != nil {
+		return err
+	}
+
+	return SaveProjectToDB(project)
+}
+
+// 更新项目，项目所属清单和创建者不能修改
+func UpdateProject(userID string, project *Project) error {
+	existing, err := GetProjectFromDB(project.ID)
+	if err != nil || existing.Deleted || !CanEditProject(userID, existing) {
+		return errors.New("项目不存在或无权修改")
+	}
+
+	project.Name = strings.TrimSpace(project.Name)
+	if project.Name == "" {
+		return errors.New("项目名称不能为空")
+	}
+
+	project.UserID = existing.UserID
+	project.ListID = existing.ListID
+	project.CreatedAt = existing.CreatedAt
+	project.UpdatedAt = time.Now()
+	// 不传工作流的旧客户端保留原工作流
+	if project.Workflow == nil {
+		project.Workflow = existing.Workflow
+	}
+	if project.CustomFields == nil {
+		project.CustomFields = existing.CustomFields
+	}
+
+	if err := validateProjectParent(project); err != nil {
+		return err
+	}
+	if err := applyProjectWorkflow(project); err != nil {
+		return err
+	}
+	if err := applyProjectCustomFields(project); err != nil {
+		return err
+	}
+
+	err = SaveProjectToDB(project)
+	if err != nil {
+		return err
+	}
+
+	// 工作流变更后重新映射任务的状态
+	oldWorkflow, _ := workflowToString(existing.Workflow)
+	newWorkflow, _ := workflowToString(project.Workflow)
+	if oldWorkflow != newWorkflow {
+		if err := remapProjectStatuses(project); err != nil {
+			return err
+		}
+	}
+
+	// 字段定义变更后清除不再有效的字段值
+	oldFields, _ := customFieldsToString(existing.CustomFields)
+	newFields, _ := customFieldsToString(project.CustomFields)
+	if oldFields != newFields {
+		if err := pruneProjectCustomValues(project); err != nil {
+			return err
+		}
+	}
+
+	// 项目改名时同步更新任务上的旧分类字段
+	if project.Name != existing.Name {
+		_, err = db.Exec(`UPDATE todos SET category = ?, updated_at = ? WHERE project_id = ?`,
+			project.Name, timeToString(project.UpdatedAt), project.ID)
+	}
+	return err
+}
+
+// 删除项目：标记为已删除，子项目移动到上级项目，任务移出该项目
+func DeleteProject(userID, projectID string) error {
+	project, err := GetProjectFromDB(projectID)
+	if err != nil || project.Deleted || !CanEditProject(userID, project) {
+		return errors.New("项目不存在或无权删除")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := timeToString(time.Now())
+
+	_, err = tx.Exec(`UPDATE projects SET deleted = 1, updated_at = ? WHERE id = ?`, now, projectID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE projects SET parent_id = ?, updated_at = ? WHERE parent_id = ?`, project.ParentID, now, projectID)
+	if err != nil {
+		return err
+	}
+
+	// 任务移出项目后使用默认工作流，项目的自定义字段值一并清除
+	_, err = tx.Exec(`
+	UPDATE todos SET project_id = '', category = '', status = CASE WHEN completed = 1 THEN ? ELSE ? END, custom_fields = '{}', updated_at = ?
+	WHERE project_id = ?`, StatusDone, StatusTodo, now, projectID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 按名称查找未删除的项目（忽略大小写和首尾空白），不存在时返回nil
+// 个人项目按创建者查找，共享清单项目按清单查找
+func findProjectByName(ownerID, listID, name string) (*Project, error) {
+	query := `
+	SELECT ` + projectColumns + `
+	FROM projects
+	WHERE deleted = 0 AND list_id = ? AND (list_id != '' OR user_id = ?) AND LOWER(TRIM(name)) = LOWER(?)
+	ORDER BY created_at ASC
+	LIMIT 1
+	`
+	project, err := scanProject(db.QueryRow(query, listID, ownerID, strings.TrimSpace(name)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// 按名称查找项目，不存在时创建
+// 个人任务使用任务创建者的个人项目，共享清单中的任务使用清单项目
+func FindOrCreateProjectByName(userID, ownerID, listID, name string) (*Project, error) {
+	project, err := findProjectByName(ownerID, listID, name)
+	if err != nil || project != nil {
+		return project, err
+	}
+
+	newProject := &Project{Name: name, ListID: listID}
+	if listID == "" {
+		// 个人项目始终归属任务创建者
+		userID = ownerID
+	}
+	err = CreateProject(userID, newProject)
+	if err != nil {
+		return nil, err
+	}
+	return newProject, nil
+}
+
+// 根据任务的项目ID或旧版分类字段确定任务所属项目
+// 传入project_id时校验项目，否则按分类名称查找或创建项目；分类字段始终与项目名称保持一致
+func ApplyTodoProject(userID string, todo *Todo) error {
+	if todo.ProjectID == "" {
+		if strings.TrimSpace(todo.Category) == "" {
+			todo.Category = ""
+			return nil
+		}
+		project, err := FindOrCreateProjectByName(userID, todo.UserID, todo.ListID, todo.Category)
+		if err != nil {
+			return err
+		}
+		todo.ProjectID = project.ID
+		todo.Category = project.Name
+		return nil
+	}
+
+	project, err := GetProjectFromDB(todo.ProjectID)
+	if err != nil || project.Deleted || !CanViewProject(userID, project) {
+		return errors.New("项目不存在或无权访问")
+	}
+	if project.ListID != todo.ListID || (project.ListID == "" && project.UserID != todo.UserID) {
+		return errors.New("任务与项目不属于同一清单")
+	}
+	todo.Category = project.Name
+	return nil
+}
+
+// 将旧版本的分类字符串迁移为项目
+// 同一用户（或同一共享清单）中忽略大小写相同的分类合并为一个项目，可重复执行
+func MigrateCategoriesToProjects() error {
+	rows, err := db.Query(`
+	SELECT id, user_id, list_id, category
+	FROM todos
+	WHERE project_id = '' AND category IS NOT NULL AND TRIM(category) != ''
+	`)
+	if err != nil {
+		return err
+	}
+
+	type pendingTodo struct {
+		id, userID, listID, category string
+	}
+	var pending []pendingTodo
+	for rows.Next() {
+		var todo pendingTodo
+		if err := rows.Scan(&todo.id, &todo.userID, &todo.listID, &todo.category); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 更新修改时间，让客户端在下次同步时拿到迁移后的项目
+	now := timeToString(time.Now())
+
+	// 缓存已处理的分类，键为 范围|小写分类名
+	projectCache := make(map[string]*Project)
+	for _, todo := range pending {
+		scope := "user:" + todo.userID
+		if todo.listID != "" {
+			scope = "list:" + todo.listID
+		}
+		key := scope + "|" + strings.ToLower(strings.TrimSpace(todo.category))
+
+		project, ok := projectCache[key]
+		if !ok {
+			creatorID := todo.userID
+			if todo.listID != "" {
+				if list, err := GetListFromDB(todo.listID); err == nil {
+					creatorID = list.OwnerID
+				}
+			}
+			project, err = findOrCreateMigratedProject(creatorID, todo.userID, todo.listID, todo.category)
+			if err != nil {
+				return fmt.Errorf("迁移分类 %s 失败: %v", todo.category, err)
+			}
+			projectCache[key] = project
+		}
+
+		_, err = db.Exec(`UPDATE todos SET project_id = ?, category = ?, updated_at = ? WHERE id = ?`, project.ID, project.Name, now, todo.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 迁移时查找或创建项目，跳过权限检查（清单创建者可能已不在成员中）
+func findOrCreateMigratedProject(creatorID, ownerID, listID, name string) (*Project, error) {
+	project, err := findProjectByName(ownerID, listID, name)
+	if err != nil || project != nil {
+		return project, err
+	}
+
+	now := time.Now()
+	newProject := &Project{
+		ID:        generateUUID(),
+		UserID:    creatorID,
+		ListID:    listID,
+		Name:      strings.TrimSpace(name),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return newProject, SaveProjectToDB(newProject)
+}
+
+// 处理客户端同步的项目，基于更新时间保留最新的版本
+func applyClientProjects(userID string, projects []Project) error {
+	for _, project := range projects {
+		existing, err := GetProjectFromDB(project.ID)
+		if err != nil && err != errProjectNotFound {
+			return err
+		}
+		if err == errProjectNotFound {
+			// 新项目
+			if project.Deleted {
+				continue
+			}
+			if err := CreateProject(userID, &project); err != nil {
+				return fmt.Errorf("创建项目 %s 失败: %v", project.Name, err)
+			}
+			continue
+		}
+
+		if !CanEditProject(userID, existing) {
+			return fmt.Errorf("无权修改项目 %s", project.ID)
+		}
+		// 服务器版本更新时忽略客户端的修改
+		if !project.UpdatedAt.After(existing.UpdatedAt) {
+			continue
+		}
+
+		if project.Deleted {
+			err = DeleteProject(userID, project.ID)
+		} else {
+			err = UpdateProject(userID, &project)
+		}
+		if err != nil {
+			return fmt.Errorf("同步项目 %s 失败: %v", project.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMigrateCategoriesToProjects(t *testing.T) {
+	setupTestDB(t)
+
+	old := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	var todos []*Todo
+	for _, category := range []string{"工作", " 工作 ", "生活"} {
+		todo := createTestTodo(t, "alice", "", "任务")
+		todo.Category = category
+		todo.UpdateAt = old
+		if err := SaveTodoToDB(todo); err != nil {
+			t.Fatal(err)
+		}
+		todos = append(todos, todo)
+	}
+	other := createTestTodo(t, "bob", "", "其他用户的任务")
+	other.Category = "工作"
+	if err := SaveTodoToDB(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateCategoriesToProjects(); err != nil {
+		t.Fatal(err)
+	}
+	// 重复执行不应该创建新项目
+	if err := MigrateCategoriesToProjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	var migrated []*Todo
+	for _, todo := range append(todos, other) {
+		todo, err := GetTodoFromDB(todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.ProjectID == "" {
+			t.Fatalf("任务 %s 没有迁移到项目", todo.ID)
+		}
+		if !todo.UpdateAt.After(old) {
+			t.Errorf("迁移后应该更新修改时间，以便客户端同步，实际为 %v", todo.UpdateAt)
+		}
+		migrated = append(migrated, todo)
+	}
+
+	if migrated[0].ProjectID != migrated[1].ProjectID {
+		t.Error("忽略大小写和空白相同的分类应该合并为一个项目")
+	}
+	if migrated[0].ProjectID == migrated[2].ProjectID {
+		t.Error("不同的分类应该迁移为不同的项目")
+	}
+	if migrated[0].ProjectID == migrated[3].ProjectID {
+		t.Error("不同用户的分类不应该合并")
+	}
+	project, err := GetProjectFromDB(migrated[0].ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.UserID != "alice" || project.Name != "工作" {
+		t.Errorf("迁移的项目不正确: %+v", project)
+	}
+}
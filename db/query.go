@@ -0,0 +1,459 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务列表查询范围
+const (
+	ViewAll      = ""
+	ViewAssigned = "assigned" // 只查询分配给我的任务
+	ViewCreated  = "created"  // 只查询我创建的任务
+)
+
+// 每页最多返回的任务数量
+const MaxTodoPageSize = 500
+
+// 查询参数无效的错误，用于和数据库错误区分
+type invalidQueryError struct {
+	err error
+}
+
+func (e *invalidQueryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidQueryError) Unwrap() error {
+	return e.err
+}
+
+// IsInvalidQuery 判断错误是否由无效的查询参数引起，其他错误为数据库错误
+func IsInvalidQuery(err error) bool {
+	var invalid *invalidQueryError
+	return errors.As(err, &invalid)
+}
+
+// TodoFilter 任务列表的过滤条件，零值字段表示不按该条件过滤
+// 创建和更新时间范围的After包含边界，Before不包含边界
+// 截止时间按开始逾期的时间比较，只有日期的截止时间在当天结束时逾期，因此DueAfter不包含边界，DueBefore包含边界
+type TodoFilter struct {
+	View       string
+	Completed  *bool
+	ProjectID  string
+	Category   string // 兼容旧客户端按分类名称过滤
+	ListID     string
+	Priorities []Priority
+	Statuses   []string   // 工作流状态，任务处于其中任意一个状态
+	TagIDs     []string   // 任务需要包含所有标签
+	Text       string     // 名称或描述中包含的文字
+	Expr       *QueryExpr // 查询语言表达式
+	Archived   string     // 是否包含已归档的任务，为空时不包含（查询表达式使用is:archived时除外）
+
+	DueAfter      time.Time
+	DueBefore     time.Time
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
+
+// 已归档任务的过滤方式，回收站中的任务总是不包含
+const (
+	ArchivedExclude = "exclude" // 不包含已归档的任务
+	ArchivedInclude = "include" // 同时包含已归档和未归档的任务
+	ArchivedOnly    = "only"    // 只包含已归档的任务
+)
+
+// 时间范围参数名
+const (
+	BoundDueAfter      = "due_after"
+	BoundDueBefore     = "due_before"
+	BoundCreatedAfter  = "created_after"
+	BoundCreatedBefore = "created_before"
+	BoundUpdatedAfter  = "updated_after"
+	BoundUpdatedBefore = "updated_before"
+)
+
+// TimeBoundParams 所有的时间范围参数名
+var TimeBoundParams = []string{
+	BoundDueAfter, BoundDueBefore,
+	BoundCreatedAfter, BoundCreatedBefore,
+	BoundUpdatedAfter, BoundUpdatedBefore,
+}
+
+// 相对今天的天数，例如+7d表示七天后，-1d表示昨天，0d表示今天
+var relativeDatePattern = regexp.MustCompile(`^([+-]?\d+)d$`)
+
+// SetTimeBound 按参数名设置时间范围，value为2006-01-02、RFC3339或相对今天的天数
+// 只有日期时按loc解释，作为结束边界时包含当天
+func (f *TodoFilter) SetTimeBound(name, value string, loc *time.Location, now time.Time) error {
+	var target *time.Time
+	switch name {
+	case BoundDueAfter:
+		target = &f.DueAfter
+	case BoundDueBefore:
+		target = &f.DueBefore
+	case BoundCreatedAfter:
+		target = &f.CreatedAfter
+	case BoundCreatedBefore:
+		target = &f.CreatedBefore
+	case BoundUpdatedAfter:
+		target = &f.UpdatedAfter
+	case BoundUpdatedBefore:
+		target = &f.UpdatedBefore
+	default:
+		return fmt.Errorf("不支持的时间范围: %s", name)
+	}
+
+	value = strings.TrimSpace(value)
+	if m := relativeDatePattern.FindStringSubmatch(value); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return fmt.Errorf("无效的时间参数%s: %s", name, value)
+		}
+		local := now.In(loc)
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		value = addDays(today, days).Format(deadlineDateLayout)
+	}
+
+	d, err := ParseDeadline(value, loc)
+	if err != nil || d.Time.IsZero() {
+		return fmt.Errorf("无效的时间参数%s: %s", name, value)
+	}
+	*target = d.Time
+	if d.DateOnly && strings.HasSuffix(name, "_before") {
+		// 只有日期的结束时间包含当天
+		*target = d.DueAt()
+	}
+	return nil
+}
+
+// TodoQuery 任务列表查询，Sort为逗号分隔的排序字段，字段前加-表示倒序
+// Limit为0时返回所有结果
+type TodoQuery struct {
+	TodoFilter
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// TodoPage 一页查询结果，NextCursor为空表示没有更多结果
+type TodoPage struct {
+	Todos      []Todo
+	NextCursor string
+}
+
+// 可以排序的字段：SQL表达式和从任务中取得对应值的方法，用于生成分页游标
+type todoSortField struct {
+	expr  string
+	value func(todo *Todo) interface{}
+}
+
+// 没有截止时间的任务排在有截止时间的任务之后
+const noDueSortValue = "~"
+
+// 创建和修改时间按保存时的时区偏移写入，不同来源的偏移可能不同，比较和排序前统一转换为UTC
+func utcTimeExpr(column string) string {
+	return "strftime('%Y-%m-%dT%H:%M:%SZ', " + column + ")"
+}
+
+// 与utcTimeExpr对应的参数值
+func utcTimeString(t time.Time) string {
+	return timeToString(t.UTC())
+}
+
+var todoSortFields = map[string]todoSortField{
+	"priority": {"priority_rank", func(todo *Todo) interface{} { return todo.Priority.Rank() }},
+	"due": {"COALESCE(NULLIF(due_at, ''), '" + noDueSortValue + "')", func(todo *Todo) interface{} {
+		if _, dueAt := deadlineValues(todo.DeadLine); dueAt != "" {
+			return dueAt
+		}
+		return noDueSortValue
+	}},
+	"created":  {utcTimeExpr("created_at"), func(todo *Todo) interface{} { return utcTimeString(todo.CreateAt) }},
+	"updated":  {utcTimeExpr("updated_at"), func(todo *Todo) interface{} { return utcTimeString(todo.UpdateAt) }},
+	"name":     {"name", func(todo *Todo) interface{} { return todo.Name }},
+	"position": {"position", func(todo *Todo) interface{} { return todo.Position }},
+	"estimate": {"estimate", func(todo *Todo) interface{} { return todo.Estimate }},
+}
+
+// 兼容之前的排序参数
+var todoSortAliases = map[string]string{
+	"":         "-updated",
+	"priority": "-priority,due,-updated", // 优先级从高到低，同级按截止时间
+}
+
+// 解析后的排序字段
+type todoSortKey struct {
+	field todoSortField
+	desc  bool
+}
+
+// 解析排序参数，最后总是按任务ID排序保证顺序稳定
+func parseTodoSort(sort string) ([]todoSortKey, error) {
+	if alias, ok := todoSortAliases[sort]; ok {
+		sort = alias
+	}
+
+	var keys []todoSortKey
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(sort, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if seen[name] {
+			return nil, fmt.Errorf("重复的排序字段: %s", name)
+		}
+		seen[name] = true
+		if key, ok := parseCustomFieldName(name); ok {
+			keys = append(keys, customFieldSortKeys(key, desc)...)
+			continue
+		}
+		field, ok := todoSortFields[name]
+		if !ok {
+			return nil, fmt.Errorf("不支持的排序字段: %s", name)
+		}
+		keys = append(keys, todoSortKey{field: field, desc: desc})
+	}
+
+	keys = append(keys, todoSortKey{field: todoSortField{"id", func(todo *Todo) interface{} { return todo.ID }}})
+	return keys, nil
+}
+
+// 按自定义字段排序，没有值的任务无论正序倒序都排在最后
+// 字段标识已经过校验，可以直接拼接到JSON路径中
+func customFieldSortKeys(key string, desc bool) []todoSortKey {
+	path := "'$." + key + "'"
+	missing := todoSortField{"(json_type(custom_fields, " + path + ") IS NULL)", func(todo *Todo) interface{} {
+		_, ok := todo.CustomFields[key]
+		return boolToInt(!ok)
+	}}
+	value := todoSortField{"COALESCE(json_extract(custom_fields, " + path + "), '')", func(todo *Todo) interface{} {
+		return customFieldSortValue(todo, key)
+	}}
+	return []todoSortKey{{field: missing}, {field: value, desc: desc}}
+}
+
+// 分页游标，记录上一页最后一个任务的排序字段值
+type todoCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func encodeTodoCursor(sort string, keys []todoSortKey, todo *Todo) string {
+	cursor := todoCursor{Sort: sort}
+	for _, key := range keys {
+		cursor.Values = append(cursor.Values, key.field.value(todo))
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTodoCursor(s, sort string, keys []todoSortKey) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的分页游标")
+	}
+	var cursor todoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("无效的分页游标")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("分页游标与排序方式不一致")
+	}
+	return cursor.Values, nil
+}
+
+// 生成游标之后的条件：(k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func cursorCondition(keys []todoSortKey, values []interface{}) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].field.expr+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if key.desc {
+			op = " < ?"
+		}
+		parts = append(parts, key.field.expr+op)
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// 转义LIKE中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// 生成过滤条件
+func todoFilterCondition(userID string, filter *TodoFilter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	switch filter.View {
+	case ViewAll:
+		add(accessibleTodoCondition, userID, userID, userID)
+	case ViewAssigned:
+		add(`assignee_id = ?`, userID)
+	case ViewCreated:
+		add(`user_id = ? AND `+accessibleTodoCondition, userID, userID, userID, userID)
+	default:
+		return "", nil, fmt.Errorf("不支持的查询范围: %s", filter.View)
+	}
+
+	add(`deleted_at = ''`)
+	switch filter.Archived {
+	case "":
+		if filter.Expr == nil || !filter.Expr.archived {
+			add(`archived_at = ''`)
+		}
+	case ArchivedExclude:
+		add(`archived_at = ''`)
+	case ArchivedInclude:
+	case ArchivedOnly:
+		add(`archived_at != ''`)
+	default:
+		return "", nil, fmt.Errorf("无效的归档过滤方式: %s，可选值为exclude、include、only", filter.Archived)
+	}
+
+	if filter.Completed != nil {
+		add(`completed = ?`, boolToInt(*filter.Completed))
+	}
+	if filter.ProjectID != "" {
+		add(`project_id = ?`, filter.ProjectID)
+	}
+	if filter.Category != "" {
+		add(`category = ?`, filter.Category)
+	}
+	if filter.ListID != "" {
+		add(`list_id = ?`, filter.ListID)
+	}
+	if len(filter.Priorities) > 0 {
+		var ranks []interface{}
+		for _, p := range filter.Priorities {
+			p, err := ParsePriority(string(p))
+			if err != nil {
+				return "", nil, err
+			}
+			ranks = append(ranks, p.Rank())
+		}
+		add(`priority_rank IN (`+placeholders(len(ranks))+`)`, ranks...)
+	}
+	if len(filter.Statuses) > 0 {
+		var statuses []interface{}
+		for _, status := range filter.Statuses {
+			statuses = append(statuses, status)
+		}
+		add(`status IN (`+placeholders(len(statuses))+`)`, statuses...)
+	}
+	for _, tagID := range filter.TagIDs {
+		add(`id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ?)`, tagID)
+	}
+	if filter.Text != "" {
+		pattern := "%" + escapeLike(filter.Text) + "%"
+		add(`(name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	// due_at保存的是UTC时间，直接比较即可
+	if !filter.DueAfter.IsZero() {
+		add(`due_at != '' AND due_at > ?`, timeToString(filter.DueAfter.UTC()))
+	}
+	if !filter.DueBefore.IsZero() {
+		add(`due_at != '' AND due_at <= ?`, timeToString(filter.DueBefore.UTC()))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		add(utcTimeExpr("created_at")+` >= ?`, utcTimeString(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		add(utcTimeExpr("created_at")+` < ?`, utcTimeString(filter.CreatedBefore))
+	}
+	if !filter.UpdatedAfter.IsZero() {
+		add(utcTimeExpr("updated_at")+` >= ?`, utcTimeString(filter.UpdatedAfter))
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		add(utcTimeExpr("updated_at")+` < ?`, utcTimeString(filter.UpdatedBefore))
+	}
+
+	if filter.Expr != nil {
+		add(filter.Expr.sql, filter.Expr.args...)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// QueryTodosFromDB 按条件查询用户可访问的任务，支持多字段排序和基于游标的分页
+func QueryTodosFromDB(userID string, q TodoQuery) (*TodoPage, error) {
+	keys, err := parseTodoSort(q.Sort)
+	if err != nil {
+		return nil, &invalidQueryError{err}
+	}
+	if q.Limit < 0 || q.Limit > MaxTodoPageSize {
+		return nil, &invalidQueryError{fmt.Errorf("每页数量应在1到%d之间", MaxTodoPageSize)}
+	}
+
+	condition, args, err := todoFilterCondition(userID, &q.TodoFilter)
+	if err != nil {
+		return nil, &invalidQueryError{err}
+	}
+
+	if q.Cursor != "" {
+		values, err := decodeTodoCursor(q.Cursor, q.Sort, keys)
+		if err != nil {
+			return nil, &invalidQueryError{err}
+		}
+		cursorCond, cursorArgs := cursorCondition(keys, values)
+		condition += " AND " + cursorCond
+		args = append(args, cursorArgs...)
+	}
+
+	var order []string
+	for _, key := range keys {
+		if key.desc {
+			order = append(order, key.field.expr+" DESC")
+		} else {
+			order = append(order, key.field.expr+" ASC")
+		}
+	}
+
+	query := `
+	SELECT ` + todoColumns + `
+	FROM todos
+	WHERE ` + condition + `
+	ORDER BY ` + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		// 多查询一条用于判断是否还有下一页
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	todos, err := queryTodos(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TodoPage{Todos: todos}
+	if q.Limit > 0 && len(todos) > q.Limit {
+		page.Todos = todos[:q.Limit]
+		page.NextCursor = encodeTodoCursor(q.Sort, keys, &page.Todos[q.Limit-1])
+	}
+	if page.Todos == nil {
+		page.Todos = []Todo{}
+	}
+	return page, nil
+}
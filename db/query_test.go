@@ -0,0 +1,109 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryTodosDistinguishesInvalidQuery(t *testing.T) {
+	setupTestDB(t)
+	createTestTodo(t, "user", "", "任务")
+
+	for name, q := range map[string]TodoQuery{
+		"不支持的排序字段": {Sort: "owner"},
+		"重复的排序字段":  {Sort: "name,-name"},
+		"每页数量超出范围": {Limit: MaxTodoPageSize + 1},
+		"无效的查询范围":  {TodoFilter: TodoFilter{View: "shared"}},
+		"无效的归档过滤":  {TodoFilter: TodoFilter{Archived: "all"}},
+		"无效的分页游标":  {Limit: 1, Cursor: "invalid"},
+	} {
+		if _, err := QueryTodosFromDB("user", q); !IsInvalidQuery(err) {
+			t.Errorf("%s应该返回查询参数错误，实际为 %v", name, err)
+		}
+	}
+
+	page, err := QueryTodosFromDB("user", TodoQuery{Sort: "position,-estimate,cf.points"})
+	if err != nil || len(page.Todos) != 1 {
+		t.Fatalf("查询应该成功，实际 %v %v", page, err)
+	}
+
+	// 数据库错误不是查询参数错误
+	if _, err := db.Exec(`ALTER TABLE todos RENAME TO todos_old`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := QueryTodosFromDB("user", TodoQuery{}); err == nil || IsInvalidQuery(err) {
+		t.Errorf("数据库错误不应该被当作查询参数错误，实际为 %v", err)
+	}
+}
+
+func TestQueryTodosCompareTimesInUTC(t *testing.T) {
+	setupTestDB(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按不同的时区偏移保存：纽约时间10月17日22:00、10月18日01:00和10月17日23:30
+	created := map[string]time.Time{
+		"前一天":   time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		"当天":    time.Date(2026, 10, 18, 1, 0, 0, 0, newYork),
+		"前一天晚上": time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+	}
+	for name, at := range created {
+		todo := createTestTodo(t, "user", "", name)
+		todo.CreateAt = at
+		todo.UpdateAt = at
+		if err := SaveTodoToDB(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, bound := range []string{BoundCreatedAfter, BoundUpdatedAfter} {
+		var q TodoQuery
+		if err := q.SetTimeBound(bound, "2026-10-18", newYork, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if names := queryPageNames(t, q); !reflect.DeepEqual(names, []string{"当天"}) {
+			t.Errorf("%s应该按实际时间比较，实际返回 %v", bound, names)
+		}
+	}
+
+	// 排序和分页游标同样按实际时间
+	want := []string{"前一天", "前一天晚上", "当天"}
+	for _, sort := range []string{"created", "updated"} {
+		q := TodoQuery{Sort: sort, Limit: 1}
+		var names []string
+		for {
+			page, err := QueryTodosFromDB("user", q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, todo := range page.Todos {
+				names = append(names, todo.Name)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("按%s排序应该为 %v，实际为 %v", sort, want, names)
+		}
+	}
+}
+
+// 查询一页任务并返回名称
+func queryPageNames(t *testing.T, q TodoQuery) []string {
+	t.Helper()
+
+	page, err := QueryTodosFromDB("user", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, todo := range page.Todos {
+		names = append(names, todo.Name)
+	}
+	return names
+}
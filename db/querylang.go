@@ -0,0 +1,365 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 任务查询语言，例如：priority:high due:<7d -completed tag:customer "invoice"
+//
+//	查询   = 或条件
+//	或条件 = 与条件 { "OR" 与条件 }
+//	与条件 = 一元条件 { ["AND"] 一元条件 }
+//	一元条件 = "-" 一元条件 | "(" 查询 ")" | 字段条件 | 文字
+//	字段条件 = 字段名 ":" [运算符] 值，运算符为 < <= > >= =
+//	自定义字段的字段名为 "cf." 字段标识，例如cf.severity:high
+//
+// 不带字段名的词或用双引号括起来的短语匹配任务名称和描述
+
+// QueryError 查询语法或语义错误，Pos为出错位置（从1开始的字符序号）
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("查询语法错误（第%d个字符）: %s", e.Pos, e.Msg)
+}
+
+func queryErrorf(pos int, format string, args ...interface{}) error {
+	return &QueryError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// QueryNode 查询语法树的节点
+type QueryNode interface {
+	String() string
+}
+
+// AndNode 所有子条件都满足
+type AndNode struct {
+	Children []QueryNode
+}
+
+// OrNode 任意一个子条件满足
+type OrNode struct {
+	Children []QueryNode
+}
+
+// NotNode 子条件不满足
+type NotNode struct {
+	Child QueryNode
+}
+
+// TermNode 单个条件，Field为空时匹配任务名称和描述
+type TermNode struct {
+	Pos      int
+	Field    string
+	Op       string // 空、=、<、<=、>、>=
+	Value    string
+	ValuePos int  // 值的位置，用于报告值的错误
+	Quoted   bool // 值是否用双引号括起来
+}
+
+func (n *AndNode) String() string { return joinNodes("AND", n.Children) }
+func (n *OrNode) String() string  { return joinNodes("OR", n.Children) }
+func (n *NotNode) String() string { return "(NOT " + n.Child.String() + ")" }
+
+func (n *TermNode) String() string {
+	value := n.Value
+	if n.Quoted {
+		value = fmt.Sprintf("%q", value)
+	}
+	if n.Field == "" {
+		return value
+	}
+	return n.Field + ":" + n.Op + value
+}
+
+func joinNodes(op string, children []QueryNode) string {
+	var parts []string
+	for _, child := range children {
+		parts = append(parts, child.String())
+	}
+	return "(" + strings.Join(parts, " "+op+" ") + ")"
+}
+
+// 词法单元类型
+const (
+	tokenTerm = iota
+	tokenNot
+	tokenOr
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind int
+	pos  int
+	term *TermNode
+}
+
+// 比较运算符，较长的放在前面
+var queryOperators = []string{"<=", ">=", "<", ">", "="}
+
+// 将查询拆分为词法单元，位置按字符计算
+func lexQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	var tokens []queryToken
+
+	isBoundary := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')'
+	}
+
+	// 读取双引号中的内容，i指向开始的引号
+	readQuoted := func(i int) (string, int, error) {
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == '"' {
+				return string(runes[i+1 : j]), j + 1, nil
+			}
+		}
+		return "", 0, queryErrorf(i+1, "引号没有闭合")
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, pos: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, pos: i + 1})
+			i++
+		case r == '-' && i+1 < len(runes) && !isBoundary(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: tokenNot, pos: i + 1})
+			i++
+		case r == '"':
+			value, next, err := readQuoted(i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenTerm, pos: i + 1, term: &TermNode{Pos: i + 1, Value: value, ValuePos: i + 1, Quoted: true}})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !isBoundary(runes[i]) && runes[i] != ':' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			// 字段条件
+			if i < len(runes) && runes[i] == ':' && isFieldName(word) {
+				i++
+				term := &TermNode{Pos: start + 1, Field: strings.ToLower(word)}
+				for _, op := range queryOperators {
+					if strings.HasPrefix(string(runes[i:]), op) {
+						term.Op = op
+						i += len(op)
+						break
+					}
+				}
+				term.ValuePos = i + 1
+				if i < len(runes) && runes[i] == '"' {
+					value, next, err := readQuoted(i)
+					if err != nil {
+						return nil, err
+					}
+					term.Value, term.Quoted = value, true
+					i = next
+				} else {
+					valueStart := i
+					for i < len(runes) && !isBoundary(runes[i]) {
+						i++
+					}
+					term.Value = string(runes[valueStart:i])
+				}
+				if term.Value == "" {
+					return nil, queryErrorf(start+1, "字段%s缺少值", term.Field)
+				}
+				tokens = append(tokens, queryToken{kind: tokenTerm, pos: start + 1, term: term})
+				continue
+			}
+
+			// 普通的词，可以包含冒号和引号
+			for i < len(runes) && !isBoundary(runes[i]) {
+				i++
+			}
+			word = string(runes[start:i])
+			switch word {
+			case "OR":
+				tokens = append(tokens, queryToken{kind: tokenOr, pos: start + 1})
+			case "AND":
+				// 条件之间默认就是“并且”的关系
+			default:
+				tokens = append(tokens, queryToken{kind: tokenTerm, pos: start + 1, term: &TermNode{Pos: start + 1, Value: word, ValuePos: start + 1}})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isFieldName(word string) bool {
+	if word == "" {
+		return false
+	}
+	for i, r := range word {
+		// 自定义字段名可以包含点和数字，例如cf.story_points
+		if i > 0 && (r >= '0' && r <= '9' || r == '.') {
+			continue
+		}
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// 括号和取反最多嵌套的层数，避免过深的递归
+const maxQueryNesting = 32
+
+// 递归下降语法分析器
+type queryParser struct {
+	tokens  []queryToken
+	pos     int
+	depth   int // 当前所在括号的层数
+	nesting int // 当前括号和取反嵌套的层数
+	end     int // 查询末尾的位置，用于报告缺少内容的错误
+}
+
+// ParseQuery 将查询解析为语法树，查询为空时返回nil
+func ParseQuery(input string) (QueryNode, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &queryParser{tokens: tokens, end: len([]rune(input)) + 1}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		// 只有多余的右括号会走到这里
+		return nil, queryErrorf(tok.pos, "多余的右括号")
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (QueryNode, error) {
+	var children []QueryNode
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &OrNode{Children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (QueryNode, error) {
+	var children []QueryNode
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenRParen {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 0 {
+		tok, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, queryErrorf(p.end, "缺少查询条件")
+		case tok.kind == tokenOr:
+			return nil, queryErrorf(tok.pos, "OR前面缺少查询条件")
+		case p.depth == 0:
+			return nil, queryErrorf(tok.pos, "多余的右括号")
+		default:
+			return nil, queryErrorf(tok.pos, "括号中缺少查询条件")
+		}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &AndNode{Children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (QueryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, queryErrorf(p.end, "缺少查询条件")
+	}
+	p.pos++
+
+	if tok.kind == tokenNot || tok.kind == tokenLParen {
+		if p.nesting >= maxQueryNesting {
+			return nil, queryErrorf(tok.pos, "括号和取反最多嵌套%d层", maxQueryNesting)
+		}
+		p.nesting++
+		defer func() { p.nesting-- }()
+	}
+
+	switch tok.kind {
+	case tokenNot:
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	case tokenLParen:
+		p.depth++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		next, ok := p.peek()
+		if !ok || next.kind != tokenRParen {
+			return nil, queryErrorf(tok.pos, "括号没有闭合")
+		}
+		p.pos++
+		return node, nil
+	case tokenTerm:
+		return tok.term, nil
+	default:
+		return nil, queryErrorf(tok.pos, "意外的%s", tokenName(tok.kind))
+	}
+}
+
+func tokenName(kind int) string {
+	switch kind {
+	case tokenOr:
+		return "OR"
+	case tokenRParen:
+		return "右括号"
+	default:
+		return "符号"
+	}
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`invoice`, `invoice`},
+		{`priority:high due:<7d`, `(priority:high AND due:<7d)`},
+		{`a AND b`, `(a AND b)`},
+		{`a b OR c`, `((a AND b) OR c)`},
+		{`a (b OR c)`, `(a AND (b OR c))`},
+		{`-(a OR b)`, `(- AND (a OR b))`},
+		{`--a`, `(NOT (NOT a))`},
+		{`"fix bug" tag:"customer x"`, `("fix bug" AND tag:"customer x")`},
+		{`cf.points:>=3`, `cf.points:>=3`},
+		{`Priority:HIGH`, `priority:HIGH`},
+		{`http://example.com`, `http://example.com`},
+		{`a - b`, `(a AND - AND b)`},
+		{`  `, `<nil>`},
+	}
+
+	for _, tt := range tests {
+		node, err := ParseQuery(tt.input)
+		if err != nil {
+			t.Errorf("%q 解析失败: %v", tt.input, err)
+			continue
+		}
+		got := "<nil>"
+		if node != nil {
+			got = node.String()
+		}
+		if got != tt.want {
+			t.Errorf("%q 解析为 %s，期望 %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{`"open`, 1, "引号没有闭合"},
+		{`due:`, 1, "缺少值"},
+		{`(a`, 1, "括号没有闭合"},
+		{`a)`, 2, "多余的右括号"},
+		{`()`, 2, "括号中缺少查询条件"},
+		{`OR a`, 1, "OR前面缺少查询条件"},
+		{`a OR`, 5, "缺少查询条件"},
+		{strings.Repeat("(", maxQueryNesting+1) + "a" + strings.Repeat(")", maxQueryNesting+1), maxQueryNesting + 1, "最多嵌套"},
+		{strings.Repeat("-", maxQueryNesting+1) + "a", maxQueryNesting + 1, "最多嵌套"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.input)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("%q 应该返回查询错误，实际为 %v", tt.input, err)
+			continue
+		}
+		if queryErr.Pos != tt.pos || !strings.Contains(queryErr.Msg, tt.msg) {
+			t.Errorf("%q 的错误为第%d个字符 %s，期望第%d个字符 %s", tt.input, queryErr.Pos, queryErr.Msg, tt.pos, tt.msg)
+		}
+	}
+
+	// 嵌套层数以内可以正常解析
+	nested := strings.Repeat("(", maxQueryNesting) + "a" + strings.Repeat(")", maxQueryNesting)
+	if _, err := ParseQuery(nested); err != nil {
+		t.Errorf("嵌套%d层应该可以解析: %v", maxQueryNesting, err)
+	}
+	// 很长的查询不会因为递归过深崩溃
+	if _, err := ParseQuery(strings.Repeat("(", 100000)); err == nil {
+		t.Error("过深的嵌套应该返回错误")
+	}
+}
+
+func TestParseQueryExprErrors(t *testing.T) {
+	for _, input := range []string{
+		"owner:me",
+		"priority:someday",
+		"is:pinned",
+		"has:color",
+		"tag:>a",
+		"due:someday",
+		"cf.:1",
+	} {
+		_, err := ParseQueryExpr(input, "user", time.UTC, time.Now())
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("%q 应该返回查询错误，实际为 %v", input, err)
+		}
+	}
+}
+
+func TestQueryExprArchived(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"is:archived", true},
+		{"archived", true},
+		{"is:archived tag:customer", true},
+		{`"archived"`, false},
+		{"-is:archived", false},
+		{"-is:archived OR foo", false},
+		{"is:archived OR foo", false},
+		{"(is:archived OR foo) bar", false},
+		{"-is:archived bar", false},
+		{"(is:archived) bar", true},
+	}
+	for _, tt := range tests {
+		expr, err := ParseQueryExpr(tt.input, "user", time.UTC, time.Now())
+		if err != nil {
+			t.Fatalf("%q 解析失败: %v", tt.input, err)
+		}
+		if expr.archived != tt.want {
+			t.Errorf("%q 是否包含已归档任务为 %v，期望 %v", tt.input, expr.archived, tt.want)
+		}
+	}
+}
+
+// 执行查询并返回匹配任务的名称
+func queryTodoNames(t *testing.T, userID, input string) []string {
+	t.Helper()
+
+	expr, err := ParseQueryExpr(input, userID, time.UTC, time.Now())
+	if err != nil {
+		t.Fatalf("%q 解析失败: %v", input, err)
+	}
+	page, err := QueryTodosFromDB(userID, TodoQuery{TodoFilter: TodoFilter{Expr: expr}})
+	if err != nil {
+		t.Fatalf("%q 查询失败: %v", input, err)
+	}
+	var names []string
+	for _, todo := range page.Todos {
+		names = append(names, todo.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestQueryExprMatchesTodos(t *testing.T) {
+	setupTestDB(t)
+
+	invoice := createTestTodo(t, "user", "", "send invoice")
+	invoice.Priority = PriorityHigh
+	if err := ApplyTodoPriority(invoice); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(invoice); err != nil {
+		t.Fatal(err)
+	}
+	done := createTestTodo(t, "user", "", "call customer")
+	done.Completed = true
+	if err := SaveTodoToDB(done); err != nil {
+		t.Fatal(err)
+	}
+	old := createTestTodo(t, "user", "", "old invoice")
+	if _, err := ArchiveTodo("user", old.ID); err != nil {
+		t.Fatal(err)
+	}
+	createTestTodo(t, "other", "", "other invoice")
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"invoice", "send invoice"},
+		{"priority:high", "send invoice"},
+		{"-completed", "send invoice"},
+		{"completed OR priority:high", "call customer,send invoice"},
+		{"is:archived", "old invoice"},
+		{"invoice is:archived", "old invoice"},
+		// 只有顶层的is:archived才包含已归档的任务
+		{"-is:archived OR invoice", "call customer,send invoice"},
+		{"is:archived OR completed", "call customer"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(queryTodoNames(t, "user", tt.input), ","); got != tt.want {
+			t.Errorf("%q 匹配 %s，期望 %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestQueryExprAssignee(t *testing.T) {
+	setupTestDB(t)
+	addTestUsers(t, "user", "bob")
+
+	assigned := createTestTodo(t, "user", "", "assigned")
+	if _, err := AssignTodo("user", assigned.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	createTestTodo(t, "user", "", "unassigned")
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"assignee:bob", "assigned"},
+		{"assignee:BOB@example.com", "assigned"},
+		{"assignee:none", "unassigned"},
+		{"assignee:me", ""},
+		{"assignee:nobody", ""},
+		{"-assignee:nobody", "assigned,unassigned"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(queryTodoNames(t, "user", tt.input), ","); got != tt.want {
+			t.Errorf("%q 匹配 %s，期望 %s", tt.input, got, tt.want)
+		}
+	}
+	if got := strings.Join(queryTodoNames(t, "bob", "assignee:me"), ","); got != "assigned" {
+		t.Errorf("assignee:me 匹配 %s，期望 assigned", got)
+	}
+}
+
+func TestQueryExprCreatedInUTC(t *testing.T) {
+	setupTestDB(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 纽约时间10月17日22:00按UTC保存，10月18日01:00按纽约时间保存
+	for name, at := range map[string]time.Time{
+		"17日": time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		"18日": time.Date(2026, 10, 18, 1, 0, 0, 0, newYork),
+	} {
+		todo := createTestTodo(t, "user", "", name)
+		todo.CreateAt = at
+		todo.UpdateAt = at
+		if err := SaveTodoToDB(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"created:2026-10-18", "18日"},
+		{"created:<2026-10-18", "17日"},
+		{"updated:>=2026-10-18", "18日"},
+		{"updated:<=2026-10-17", "17日"},
+	}
+	for _, tt := range tests {
+		expr, err := ParseQueryExpr(tt.input, "user", newYork, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := QueryTodosFromDB("user", TodoQuery{TodoFilter: TodoFilter{Expr: expr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, todo := range page.Todos {
+			names = append(names, todo.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("%q 匹配 %s，期望 %s", tt.input, got, tt.want)
+		}
+	}
+}
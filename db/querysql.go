@@ -0,0 +1,458 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryExpr 已解析并转换为SQL条件的查询
+type QueryExpr struct {
+	Root QueryNode
+	sql  string
+	args []interface{}
+
+	archived bool // 是否要求任务已归档，此时不再默认排除已归档的任务
+}
+
+// ParseQueryExpr 解析查询并转换为参数化的SQL条件
+// 日期和相对时间（例如7d）按loc和now计算，assignee:me表示userID
+func ParseQueryExpr(input, userID string, loc *time.Location, now time.Time) (*QueryExpr, error) {
+	root, err := ParseQuery(input)
+	if err != nil || root == nil {
+		return nil, err
+	}
+
+	c := &queryCompiler{userID: userID, loc: loc, now: now}
+	sql, args, err := c.compile(root)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryExpr{Root: root, sql: sql, args: args, archived: requiresArchived(root)}, nil
+}
+
+// 查询是否要求任务已归档：is:archived必须是顶层的条件或顶层AND的一个条件
+// 在OR或取反中使用时仍然默认排除已归档的任务，例如-is:archived OR foo
+func requiresArchived(root QueryNode) bool {
+	children := []QueryNode{root}
+	if and, ok := root.(*AndNode); ok {
+		children = and.Children
+	}
+	for _, child := range children {
+		if term, ok := child.(*TermNode); ok && isArchivedTerm(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否为is:archived或不带字段名的archived
+func isArchivedTerm(term *TermNode) bool {
+	if !strings.EqualFold(term.Value, "archived") {
+		return false
+	}
+	return term.Field == "is" || term.Field == "" && !term.Quoted
+}
+
+// 将语法树转换为SQL条件
+type queryCompiler struct {
+	userID string
+	loc    *time.Location
+	now    time.Time
+}
+
+// 字段条件的转换方法
+type queryFieldCompiler func(c *queryCompiler, term *TermNode) (string, []interface{}, error)
+
+var queryFields map[string]queryFieldCompiler
+
+// 字段的别名
+var queryFieldAliases = map[string]string{
+	"p":        "priority",
+	"deadline": "due",
+	"t":        "tag",
+	"tags":     "tag",
+	"category": "project",
+}
+
+func init() {
+	queryFields = map[string]queryFieldCompiler{
+		"priority": compilePriorityTerm,
+		"due":      compileTimeTerm("due_at", true),
+		"created":  compileTimeTerm("created_at", false),
+		"updated":  compileTimeTerm("updated_at", false),
+		"tag":      compileTagTerm,
+		"project":  compileProjectTerm,
+		"list":     compileListTerm,
+		"assignee": compileAssigneeTerm,
+		"is":       compileIsTerm,
+		"has":      compileHasTerm,
+		"status":   compileStatusTerm,
+	}
+}
+
+// 不带字段名也可以使用的条件
+var queryFlags = map[string]string{
+	"completed": "completed",
+	"done":      "completed",
+	"overdue":   "overdue",
+	"archived":  "archived",
+}
+
+func (c *queryCompiler) compile(node QueryNode) (string, []interface{}, error) {
+	switch n := node.(type) {
+	case *AndNode:
+		return c.compileChildren(n.Children, " AND ")
+	case *OrNode:
+		return c.compileChildren(n.Children, " OR ")
+	case *NotNode:
+		sql, args, err := c.compile(n.Child)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + sql, args, nil
+	case *TermNode:
+		return c.compileTerm(n)
+	}
+	return "", nil, queryErrorf(1, "无法识别的查询")
+}
+
+func (c *queryCompiler) compileChildren(children []QueryNode, op string) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	for _, child := range children {
+		sql, childArgs, err := c.compile(child)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, childArgs...)
+	}
+	return "(" + strings.Join(parts, op) + ")", args, nil
+}
+
+func (c *queryCompiler) compileTerm(term *TermNode) (string, []interface{}, error) {
+	if term.Field == "" {
+		if flag, ok := queryFlags[strings.ToLower(term.Value)]; ok && !term.Quoted {
+			return compileIsTerm(c, &TermNode{Pos: term.Pos, Field: "is", Value: flag, ValuePos: term.ValuePos})
+		}
+		pattern := "%" + escapeLike(term.Value) + "%"
+		return `(name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, []interface{}{pattern, pattern}, nil
+	}
+
+	field := term.Field
+	if strings.HasPrefix(field, customFieldPrefix) {
+		key, ok := parseCustomFieldName(field)
+		if !ok {
+			return "", nil, queryErrorf(term.Pos, "无效的自定义字段%s", term.Field)
+		}
+		return c.compileCustomFieldTerm(term, key)
+	}
+	if alias, ok := queryFieldAliases[field]; ok {
+		field = alias
+	}
+	compile, ok := queryFields[field]
+	if !ok {
+		var names []string
+		for name := range queryFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", nil, queryErrorf(term.Pos, "未知的字段%s，可用的字段为%s（要搜索包含冒号的文字请加双引号）", term.Field, strings.Join(names, "、"))
+	}
+	return compile(c, term)
+}
+
+// 只支持等于的字段
+func requireEquals(term *TermNode) error {
+	if term.Op != "" && term.Op != "=" {
+		return queryErrorf(term.Pos, "字段%s不支持比较运算符%s", term.Field, term.Op)
+	}
+	return nil
+}
+
+// 值是否表示“没有”
+func isNoneValue(term *TermNode) bool {
+	return !term.Quoted && strings.EqualFold(term.Value, "none")
+}
+
+// priority:high、priority:>=medium
+func compilePriorityTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	p, err := ParsePriority(term.Value)
+	if err != nil {
+		return "", nil, queryErrorf(term.ValuePos, "%s", err.Error())
+	}
+	op := term.Op
+	if op == "" {
+		op = "="
+	}
+	return "priority_rank " + op + " ?", []interface{}{p.Rank()}, nil
+}
+
+// 解析时间值：日期、相对今天的天数（7d、-3d）、today、tomorrow、yesterday或RFC3339时间
+// 返回的区间为[start, end)，具体时间的start和end相同
+func (c *queryCompiler) timeValue(term *TermNode) (start, end time.Time, err error) {
+	local := c.now.In(c.loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.loc)
+
+	value := strings.ToLower(term.Value)
+	switch value {
+	case "today":
+		return today, addDays(today, 1), nil
+	case "tomorrow":
+		return addDays(today, 1), addDays(today, 2), nil
+	case "yesterday":
+		return addDays(today, -1), today, nil
+	case "now":
+		return c.now, c.now, nil
+	}
+
+	if m := relativeDatePattern.FindStringSubmatch(value); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err == nil {
+			day := addDays(today, days)
+			return day, addDays(day, 1), nil
+		}
+	}
+
+	d, err := ParseDeadline(term.Value, c.loc)
+	if err != nil || d.Time.IsZero() {
+		return start, end, queryErrorf(term.ValuePos, "无效的时间%s，可以使用2006-01-02、7d、-3d、today等", term.Value)
+	}
+	if d.DateOnly {
+		return d.Time, d.DueAt(), nil
+	}
+	return d.Time, d.Time, nil
+}
+
+// 时间字段：due:<7d、created:>=-30d、updated:today、due:none
+// 截止时间按开始逾期的时间比较，只有日期的截止时间在当天结束时逾期，因此某一天到期的范围是(当天零点, 第二天零点]
+func compileTimeTerm(column string, due bool) queryFieldCompiler {
+	return func(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+		if isNoneValue(term) {
+			if !due {
+				return "", nil, queryErrorf(term.ValuePos, "字段%s不能为none", term.Field)
+			}
+			if err := requireEquals(term); err != nil {
+				return "", nil, err
+			}
+			return column + " = ''", nil, nil
+		}
+
+		start, end, err := c.timeValue(term)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// due_at保存的是UTC时间，创建和修改时间转换为UTC后再比较
+		s, e := utcTimeString(start), utcTimeString(end)
+		expr := column
+		if !due {
+			expr = utcTimeExpr(column)
+		}
+
+		// 具体时间直接比较
+		if start.Equal(end) {
+			op := term.Op
+			if op == "" {
+				op = "="
+			}
+			sql := expr + " " + op + " ?"
+			if due {
+				sql = "(due_at != '' AND " + sql + ")"
+			}
+			return sql, []interface{}{s}, nil
+		}
+
+		var sql string
+		var args []interface{}
+		if due {
+			switch term.Op {
+			case "", "=":
+				sql, args = "due_at > ? AND due_at <= ?", []interface{}{s, e}
+			case "<":
+				sql, args = "due_at <= ?", []interface{}{s}
+			case "<=":
+				sql, args = "due_at <= ?", []interface{}{e}
+			case ">":
+				sql, args = "due_at > ?", []interface{}{e}
+			case ">=":
+				sql, args = "due_at > ?", []interface{}{s}
+			}
+			return "(due_at != '' AND " + sql + ")", args, nil
+		}
+
+		switch term.Op {
+		case "", "=":
+			sql, args = expr+" >= ? AND "+expr+" < ?", []interface{}{s, e}
+		case "<":
+			sql, args = expr+" < ?", []interface{}{s}
+		case "<=":
+			sql, args = expr+" < ?", []interface{}{e}
+		case ">":
+			sql, args = expr+" >= ?", []interface{}{e}
+		case ">=":
+			sql, args = expr+" >= ?", []interface{}{s}
+		}
+		return "(" + sql + ")", args, nil
+	}
+}
+
+// tag:customer，按标签名称匹配（忽略大小写），tag:none表示没有标签
+func compileTagTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	if isNoneValue(term) {
+		return "id NOT IN (SELECT todo_id FROM todo_tags)", nil, nil
+	}
+	return `id IN (SELECT tt.todo_id FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE t.deleted = 0 AND LOWER(t.name) = LOWER(?))`,
+		[]interface{}{term.Value}, nil
+}
+
+// project:工作，按项目名称或ID匹配，project:none表示没有项目
+func compileProjectTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	if isNoneValue(term) {
+		return "project_id = ''", nil, nil
+	}
+	return `project_id IN (SELECT id FROM projects WHERE deleted = 0 AND (id = ? OR LOWER(name) = LOWER(?)))`,
+		[]interface{}{term.Value, term.Value}, nil
+}
+
+// list:家庭，按共享清单名称或ID匹配，list:none表示个人任务
+func compileListTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	if isNoneValue(term) {
+		return "list_id = ''", nil, nil
+	}
+	return `list_id IN (SELECT id FROM lists WHERE id = ? OR LOWER(name) = LOWER(?))`,
+		[]interface{}{term.Value, term.Value}, nil
+}
+
+// assignee:me、assignee:用户名或邮箱、assignee:none
+func compileAssigneeTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	switch {
+	case isNoneValue(term):
+		return "assignee_id = ''", nil, nil
+	case !term.Quoted && strings.EqualFold(term.Value, "me"):
+		return "assignee_id = ?", []interface{}{c.userID}, nil
+	}
+	// 用户只保存在内存中，先按用户名或邮箱找到用户ID，不存在的用户不匹配任何任务
+	user, err := FindUserByUsernameOrEmail(term.Value)
+	if err != nil {
+		return "0", nil, nil
+	}
+	return "assignee_id = ?", []interface{}{user.ID}, nil
+}
+
+// status:in_progress，按工作流状态的标识匹配
+func compileStatusTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	return "status = ?", []interface{}{strings.ToLower(term.Value)}, nil
+}
+
+// is:completed、is:open、is:overdue、is:recurring、is:subtask、is:assigned、is:blocked、is:archived
+func compileIsTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	switch strings.ToLower(term.Value) {
+	case "completed", "done":
+		return "completed = 1", nil, nil
+	case "open", "todo":
+		return "completed = 0", nil, nil
+	case "overdue":
+		return "(completed = 0 AND due_at != '' AND due_at <= ?)", []interface{}{timeToString(c.now.UTC())}, nil
+	case "recurring":
+		return "recurrence != ''", nil, nil
+	case "subtask":
+		return "parent_id != ''", nil, nil
+	case "assigned":
+		return "assignee_id != ''", nil, nil
+	case "blocked":
+		return blockedTodoCondition, nil, nil
+	case "archived":
+		return "archived_at != ''", nil, nil
+	}
+	return "", nil, queryErrorf(term.ValuePos, "无效的状态%s，可以使用completed、open、overdue、recurring、subtask、assigned、blocked、archived", term.Value)
+}
+
+// has:deadline、has:tag、has:project、has:description、has:subtasks
+func compileHasTerm(c *queryCompiler, term *TermNode) (string, []interface{}, error) {
+	if err := requireEquals(term); err != nil {
+		return "", nil, err
+	}
+	switch strings.ToLower(term.Value) {
+	case "deadline", "due":
+		return "due_at != ''", nil, nil
+	case "tag", "tags":
+		return "id IN (SELECT todo_id FROM todo_tags)", nil, nil
+	case "project":
+		return "project_id != ''", nil, nil
+	case "description":
+		return "description != ''", nil, nil
+	case "subtasks":
+		return "id IN (SELECT parent_id FROM todos WHERE parent_id != '')", nil, nil
+	case "estimate":
+		return "estimate > 0", nil, nil
+	}
+	return "", nil, queryErrorf(term.ValuePos, "无效的属性%s，可以使用deadline、tag、project、description、subtasks、estimate", term.Value)
+}
+
+// 自定义字段：cf.severity:high、cf.points:>=3、cf.launch:<7d、cf.customer:none
+// 等于时忽略大小写匹配文字和选项，多选字段包含该选项即可；比较运算符用于数字和日期字段
+func (c *queryCompiler) compileCustomFieldTerm(term *TermNode, key string) (string, []interface{}, error) {
+	path := "$." + key
+	if isNoneValue(term) {
+		if err := requireEquals(term); err != nil {
+			return "", nil, err
+		}
+		return "json_type(custom_fields, ?) IS NULL", []interface{}{path}, nil
+	}
+
+	number, numErr := strconv.ParseFloat(term.Value, 64)
+	isNumber := numErr == nil && !term.Quoted
+
+	if term.Op == "" || term.Op == "=" {
+		conditions := []string{"value = ? COLLATE NOCASE"}
+		args := []interface{}{path, term.Value}
+		switch {
+		case isNumber:
+			conditions = append(conditions, "value = ?")
+			args = append(args, number)
+		case !term.Quoted && strings.EqualFold(term.Value, "true"):
+			conditions = append(conditions, "type = 'true'")
+		case !term.Quoted && strings.EqualFold(term.Value, "false"):
+			conditions = append(conditions, "type = 'false'")
+		case !term.Quoted:
+			// today、7d等表示某一天的值匹配日期字段
+			if start, end, err := c.timeValue(term); err == nil && end.After(start) {
+				conditions = append(conditions, "value = ?")
+				args = append(args, start.In(c.loc).Format(deadlineDateLayout))
+			}
+		}
+		return "EXISTS (SELECT 1 FROM json_each(custom_fields, ?) WHERE " + strings.Join(conditions, " OR ") + ")", args, nil
+	}
+
+	if isNumber {
+		return "(json_type(custom_fields, ?) IN ('integer', 'real') AND json_extract(custom_fields, ?) " + term.Op + " ?)",
+			[]interface{}{path, path, number}, nil
+	}
+	start, _, err := c.timeValue(term)
+	if err != nil {
+		return "", nil, queryErrorf(term.ValuePos, "自定义字段的比较运算只支持数字和日期: %s", term.Value)
+	}
+	return "(json_type(custom_fields, ?) = 'text' AND json_extract(custom_fields, ?) " + term.Op + " ?)",
+		[]interface{}{path, path, start.In(c.loc).Format(deadlineDateLayout)}, nil
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// 获取重复任务本次发生的截止时间，没有截止时间时以创建日期作为本次发生的日期
+func occurrenceDeadline(todo *Todo) (Deadline, error) {
+	if !todo.DeadLine.Time.IsZero() {
+		return todo.DeadLine, nil
+	}
+
+	loc, err := todoLocation(todo)
+	if err != nil {
+		return Deadline{}, err
+	}
+	y, m, d := todo.CreateAt.In(loc).Date()
+	return Deadline{Time: time.Date(y, m, d, 0, 0, 0, 0, loc), DateOnly: true}, nil
+}
+
+// 校验任务的重复规则，并为新的重复任务初始化序列信息
+func ApplyTodoRecurrence(todo *Todo) error {
+	todo.Recurrence = strings.TrimPrefix(strings.TrimSpace(todo.Recurrence), "RRULE:")
+	if todo.Recurrence == "" {
+		return nil
+	}
+
+	if _, err := ParseRRule(todo.Recurrence); err != nil {
+		return err
+	}
+	if _, err := occurrenceDeadline(todo); err != nil {
+		return err
+	}
+
+	if todo.SeriesID == "" {
+		todo.SeriesID = todo.ID
+	}
+	if todo.OccurrenceIndex == 0 {
+		todo.OccurrenceIndex = 1
+	}
+	return nil
+}
+
+// 计算重复任务下一次发生时的截止时间
+func nextOccurrenceDeadline(todo *Todo) (Deadline, bool, error) {
+	rule, err := ParseRRule(todo.Recurrence)
+	if err != nil {
+		return Deadline{}, false, err
+	}
+	current, err := occurrenceDeadline(todo)
+	if err != nil {
+		return Deadline{}, false, err
+	}
+
+	next, ok := rule.Next(current.Time, todo.OccurrenceIndex)
+	if !ok {
+		return Deadline{}, false, nil
+	}
+	return Deadline{Time: next, DateOnly: current.DateOnly}, true, nil
+}
+
+// 重复任务完成后生成下一次任务，已经生成过或重复已结束时返回nil
+func CreateNextOccurrence(todo *Todo) (*Todo, error) {
+	if todo.Recurrence == "" || todo.SeriesID == "" {
+		return nil, nil
+	}
+
+	// 多个设备同时完成同一次任务时只生成一次
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM todos WHERE series_id = ? AND occurrence_index > ?`,
+		todo.SeriesID, todo.OccurrenceIndex).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+
+	deadline, ok, err := nextOccurrenceDeadline(todo)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := *todo
+	next.ID = generateUUID()
+	next.Completed = false
+	next.DeadLine = deadline
+	next.OccurrenceIndex = todo.OccurrenceIndex + 1
+	next.CreateAt = now
+	next.UpdateAt = now
+	next.TagIDs = append([]string{}, todo.TagIDs...)
+	next.ArchivedAt = nil
+	next.DeletedAt = nil
+
+	// 下一次任务从工作流的初始状态开始
+	next.Status = ""
+	err = ApplyTodoStatus(nil, &next)
+	if err != nil {
+		return nil, err
+	}
+
+	// 下一次任务排在本次任务之后
+	err = ApplyTodoPosition(&next)
+	if err != nil {
+		return nil, err
+	}
+
+	err = SaveTodoToDB(&next)
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// 保存任务后记录变更历史，任务从未完成变为完成时生成下一次重复任务，previous为保存前的任务（新任务为nil）
+func onTodoSaved(userID string, previous, todo *Todo) error {
+	if err := RecordTodoChanges(userID, previous, todo); err != nil {
+		return err
+	}
+	NotifyUnblockedTodos(userID, previous, todo)
+	if !todo.Completed || (previous != nil && previous.Completed) {
+		return nil
+	}
+	_, err := CreateNextOccurrence(todo)
+	return err
+}
+
+// 跳过本次重复，任务直接移动到下一次发生的时间
+func SkipOccurrence(todo *Todo) error {
+	if todo.Recurrence == "" {
+		return errors.New("任务不是重复任务")
+	}
+	if todo.Completed {
+		return errors.New("已完成的任务不能跳过")
+	}
+
+	deadline, ok, err := nextOccurrenceDeadline(todo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("已经是最后一次重复，无法跳过")
+	}
+
+	todo.DeadLine = deadline
+	todo.OccurrenceIndex++
+	todo.UpdateAt = time.Now()
+	return SaveTodoToDB(todo)
+}
+
+// 修改本次及以后的所有重复任务：名称、描述、优先级、重复规则和时区同步到同一序列中未完成的后续任务
+// 每个任务都经过与修改单个任务相同的校验，并与批量操作一样在一个事务中保存，提交后重新计算提醒和记录历史
+func UpdateFutureOccurrences(userID string, todo *Todo) error {
+	if todo.SeriesID == "" {
+		return errors.New("任务不是重复任务")
+	}
+
+	previous, err := GetTodoFromDB(todo.ID)
+	if err != nil {
+		return err
+	}
+	items := []*bulkItem{{previous: *previous, todo: todo, modified: true}}
+
+	future, err := queryTodos(`SELECT `+todoColumns+` FROM todos
+	WHERE series_id = ? AND occurrence_index > ? AND completed = 0 AND deleted_at = ''
+	ORDER BY occurrence_index`, todo.SeriesID, todo.OccurrenceIndex)
+	if err != nil {
+		return err
+	}
+	for i := range future {
+		next := &future[i]
+		item := &bulkItem{previous: *next, todo: next, modified: true}
+		item.previous.TagIDs = append([]string(nil), next.TagIDs...)
+
+		next.Name = todo.Name
+		next.Description = todo.Description
+		next.Priority = todo.Priority
+		next.Recurrence = todo.Recurrence
+		next.TimeZone = todo.TimeZone
+		next.UpdateAt = todo.UpdateAt
+		items = append(items, item)
+	}
+
+	for _, item := range items {
+		err := ApplyTodoDeadline(item.todo)
+		if err == nil {
+			err = ApplyTodoPriority(item.todo)
+		}
+		if err == nil {
+			err = ApplyTodoRecurrence(item.todo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeBulkTodos(items, todo.UpdateAt); err != nil {
+		return err
+	}
+	for _, item := range items {
+		finishBulkTodo(userID, item)
+	}
+	return nil
+}
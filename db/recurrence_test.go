@@ -0,0 +1,128 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 创建每天重复的任务及其下一次任务
+func createTestSeries(t *testing.T, tagIDs []string) (*Todo, *Todo) {
+	t.Helper()
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := createTestTodo(t, "alice", "", "每日任务")
+	todo.Recurrence = "FREQ=DAILY"
+	todo.TimeZone = "Asia/Shanghai"
+	todo.DeadLine = Deadline{Time: time.Date(2026, 10, 20, 0, 0, 0, 0, shanghai), DateOnly: true}
+	todo.TagIDs = tagIDs
+	if err := ApplyTodoRecurrence(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	next, err := CreateNextOccurrence(todo)
+	if err != nil || next == nil {
+		t.Fatalf("生成下一次任务失败: %v", err)
+	}
+	return todo, next
+}
+
+func TestUpdateFutureOccurrences(t *testing.T) {
+	setupTestDB(t)
+
+	tag := &Tag{Name: "标签"}
+	if err := CreateTag("alice", tag); err != nil {
+		t.Fatal(err)
+	}
+	todo, next := createTestSeries(t, []string{tag.ID})
+	reminder := &Reminder{TodoID: next.ID, Channel: ChannelFeed, Relative: true, OffsetMinutes: 60}
+	if err := CreateReminder("alice", reminder); err != nil {
+		t.Fatal(err)
+	}
+
+	todo.Name = "新名称"
+	todo.Priority = PriorityHigh
+	todo.TimeZone = "America/New_York"
+	todo.UpdateAt = time.Now().Add(time.Second)
+	if err := UpdateFutureOccurrences("alice", todo); err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{todo.ID, next.ID} {
+		saved, err := GetTodoFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Name != "新名称" || saved.Priority != PriorityHigh || saved.TimeZone != "America/New_York" {
+			t.Errorf("任务 %s 没有更新: %+v", id, saved)
+		}
+		if !saved.DeadLine.DateOnly || saved.DeadLine.Time.Location().String() != newYork.String() {
+			t.Errorf("只有日期的截止时间应该转换到新的时区，实际为 %v", saved.DeadLine.Time)
+		}
+		if !reflect.DeepEqual(saved.TagIDs, []string{tag.ID}) {
+			t.Errorf("任务的标签不应该丢失，实际为 %v", saved.TagIDs)
+		}
+
+		history, err := GetTodoHistoryFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed := false
+		for _, record := range history {
+			renamed = renamed || record.Action == HistoryRenamed
+		}
+		if !renamed {
+			t.Errorf("任务 %s 应该记录改名历史", id)
+		}
+	}
+
+	// 截止时间随时区变化后重新计算相对提醒
+	saved, err := GetTodoFromDB(next.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := GetReminderFromDB(reminder.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := saved.DeadLine.Time.Add(-time.Hour); !updated.RemindAt.Equal(want) {
+		t.Errorf("相对提醒应该为 %v，实际为 %v", want, updated.RemindAt)
+	}
+}
+
+func TestUpdateFutureOccurrencesValidates(t *testing.T) {
+	setupTestDB(t)
+
+	todo, next := createTestSeries(t, nil)
+	for _, change := range []func(*Todo){
+		func(todo *Todo) { todo.TimeZone = "Mars/Base" },
+		func(todo *Todo) { todo.Priority = "bogus" },
+		func(todo *Todo) { todo.Recurrence = "FREQ=SOMETIMES" },
+	} {
+		changed := *todo
+		changed.Name = "新名称"
+		change(&changed)
+		if err := UpdateFutureOccurrences("alice", &changed); err == nil {
+			t.Errorf("无效的修改应该报错: %+v", changed)
+		}
+	}
+
+	for _, id := range []string{todo.ID, next.ID} {
+		saved, err := GetTodoFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Name != "每日任务" || saved.TimeZone != "Asia/Shanghai" {
+			t.Errorf("校验失败时不应该修改任何任务: %+v", saved)
+		}
+	}
+}
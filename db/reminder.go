@@ -0,0 +1,323 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 提醒通知渠道
+const (
+	ChannelFeed    = "feed"
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// 提醒状态
+const (
+	ReminderPending   = "pending"
+	ReminderSending   = "sending"
+	ReminderSent      = "sent"
+	ReminderFailed    = "failed"
+	ReminderCancelled = "cancelled"
+)
+
+// 发送失败时最多重试的次数
+const maxReminderAttempts = 5
+
+// 提醒表的列，与scanReminder的顺序保持一致
+const reminderColumns = `id, todo_id, user_id, channel, target, relative, offset_minutes, remind_at,
+	       status, attempts, last_error, fired_at, created_at, updated_at`
+
+// IsValidChannel 检查通知渠道是否有效
+func IsValidChannel(channel string) bool {
+	return channel == ChannelFeed || channel == ChannelWebhook || channel == ChannelEmail
+}
+
+// 可选时间转换为字符串，零值保存为空字符串
+func optionalTimeToString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return timeToString(t.UTC())
+}
+
+// 空字符串转换为时间零值
+func optionalStringToTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return stringToTime(s)
+}
+
+// 扫描一行提醒数据
+func scanReminder(scanner rowScanner) (Reminder, error) {
+	var reminder Reminder
+	var relativeInt int
+	var remindAtStr, firedAtStr, createdAtStr, updatedAtStr string
+
+	err := scanner.Scan(
+		&reminder.ID, &reminder.TodoID, &reminder.UserID, &reminder.Channel, &reminder.Target,
+		&relativeInt, &reminder.OffsetMinutes, &remindAtStr,
+		&reminder.Status, &reminder.Attempts, &reminder.LastError, &firedAtStr, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return reminder, err
+	}
+
+	reminder.Relative = intToBool(relativeInt)
+	if reminder.RemindAt, err = optionalStringToTime(remindAtStr); err != nil {
+		return reminder, err
+	}
+	if reminder.FiredAt, err = optionalStringToTime(firedAtStr); err != nil {
+		return reminder, err
+	}
+	if reminder.CreatedAt, err = stringToTime(createdAtStr); err != nil {
+		return reminder, err
+	}
+	if reminder.UpdatedAt, err = stringToTime(updatedAtStr); err != nil {
+		return reminder, err
+	}
+	return reminder, nil
+}
+
+// 执行提醒查询并扫描所有结果
+func queryReminders(query string, args ...interface{}) ([]Reminder, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+// 保存提醒到数据库
+func saveReminderToDB(reminder *Reminder) error {
+	query := `INSERT OR REPLACE INTO reminders (` + reminderColumns + `) VALUES (` + placeholders(14) + `)`
+	_, err := db.Exec(query,
+		reminder.ID, reminder.TodoID, reminder.UserID, reminder.Channel, reminder.Target,
+		boolToInt(reminder.Relative), reminder.OffsetMinutes, optionalTimeToString(reminder.RemindAt),
+		reminder.Status, reminder.Attempts, reminder.LastError, optionalTimeToString(reminder.FiredAt),
+		timeToString(reminder.CreatedAt), timeToString(reminder.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID获取提醒
+func GetReminderFromDB(reminderID string) (*Reminder, error) {
+	query := `SELECT ` + reminderColumns + ` FROM reminders WHERE id = ?`
+	reminder, err := scanReminder(db.QueryRow(query, reminderID))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("提醒不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// 获取用户的提醒，todoID不为空时只返回该任务的提醒
+func GetUserRemindersFromDB(userID, todoID string) ([]Reminder, error) {
+	query := `SELECT ` + reminderColumns + ` FROM reminders WHERE user_id = ?`
+	args := []interface{}{userID}
+	if todoID != "" {
+		query += ` AND todo_id = ?`
+		args = append(args, todoID)
+	}
+	query += ` ORDER BY remind_at ASC`
+	return queryReminders(query, args...)
+}
+
+// 计算相对提醒的提醒时间，任务没有截止时间时返回零值
+func relativeRemindAt(todo *Todo, offsetMinutes int) time.Time {
+	if todo.DeadLine.Time.IsZero() {
+		return time.Time{}
+	}
+	return todo.DeadLine.Time.Add(-time.Duration(offsetMinutes) * time.Minute)
+}
+
+// 创建提醒，用户需要能够查看该任务
+func CreateReminder(userID string, reminder *Reminder) error {
+	todo, err := GetTodoFromDB(reminder.TodoID)
+	if err != nil || !CanViewTodo(userID, todo) {
+		return errors.New("任务不存在或无权访问")
+	}
+	if !IsValidChannel(reminder.Channel) {
+		return fmt.Errorf("无效的通知渠道: %s", reminder.Channel)
+	}
+	if reminder.Channel == ChannelWebhook && reminder.Target == "" {
+		return errors.New("webhook提醒需要指定地址")
+	}
+	if reminder.Channel == ChannelEmail {
+		// 邮件只能发送到自己账号的邮箱，避免通过提醒向任意地址发送邮件
+		user, err := GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if target := strings.TrimSpace(reminder.Target); target != "" && !strings.EqualFold(target, user.Email) {
+			return errors.New("邮件提醒只能发送到自己账号的邮箱")
+		}
+		reminder.Target = ""
+	}
+
+	if reminder.Relative {
+		if reminder.OffsetMinutes < 0 {
+			return errors.New("提前提醒的分钟数不能为负数")
+		}
+		if todo.DeadLine.Time.IsZero() {
+			return errors.New("任务没有截止时间，无法设置相对提醒")
+		}
+		reminder.RemindAt = relativeRemindAt(todo, reminder.OffsetMinutes)
+	} else {
+		if reminder.RemindAt.IsZero() {
+			return errors.New("提醒时间不能为空")
+		}
+		reminder.OffsetMinutes = 0
+	}
+
+	now := time.Now()
+	reminder.ID = generateUUID()
+	reminder.UserID = userID
+	reminder.Status = ReminderPending
+	reminder.Attempts = 0
+	reminder.LastError = ""
+	reminder.FiredAt = time.Time{}
+	reminder.CreatedAt = now
+	reminder.UpdatedAt = now
+	return saveReminderToDB(reminder)
+}
+
+// 删除提醒
+func DeleteReminder(userID, reminderID string) error {
+	result, err := db.Exec(`DELETE FROM reminders WHERE id = ? AND user_id = ?`, reminderID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("提醒不存在或无权删除")
+	}
+	return nil
+}
+
+// 推迟提醒到指定时间，已发送的提醒会重新发送一次
+func SnoozeReminder(userID, reminderID string, until time.Time) (*Reminder, error) {
+	reminder, err := GetReminderFromDB(reminderID)
+	if err != nil || reminder.UserID != userID {
+		return nil, errors.New("提醒不存在或无权修改")
+	}
+	if reminder.Status == ReminderSending {
+		return nil, errors.New("提醒正在发送，请稍后重试")
+	}
+
+	// 推迟后变为绝对时间提醒，不再跟随截止时间变化
+	reminder.Relative = false
+	reminder.OffsetMinutes = 0
+	reminder.RemindAt = until
+	reminder.Status = ReminderPending
+	reminder.Attempts = 0
+	reminder.LastError = ""
+	reminder.UpdatedAt = time.Now()
+	return reminder, saveReminderToDB(reminder)
+}
+
+// 任务截止时间变化后重新计算尚未发送的相对提醒
+func refreshTodoReminders(todo *Todo) error {
+	_, err := db.Exec(`
+	UPDATE reminders SET remind_at = CASE WHEN ? = '' THEN '' ELSE strftime('%Y-%m-%dT%H:%M:%SZ', ?, '-' || offset_minutes || ' minutes') END
+	WHERE todo_id = ? AND relative = 1 AND status = ?
+	`, optionalTimeToString(todo.DeadLine.Time), optionalTimeToString(todo.DeadLine.Time), todo.ID, ReminderPending)
+	return err
+}
+
+// ClaimDueReminders 领取到期的提醒并标记为发送中，同一个提醒只会被领取一次
+func ClaimDueReminders(now time.Time, limit int) ([]Reminder, error) {
+	due, err := queryReminders(`
+	SELECT `+reminderColumns+` FROM reminders
+	WHERE status = ? AND remind_at != '' AND remind_at <= ?
+	  AND todo_id NOT IN (SELECT id FROM todos WHERE deleted_at != '')
+	ORDER BY remind_at ASC LIMIT ?
+	`, ReminderPending, timeToString(now.UTC()), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []Reminder{}
+	for _, reminder := range due {
+		result, err := db.Exec(`UPDATE reminders SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+			ReminderSending, timeToString(now), reminder.ID, ReminderPending)
+		if err != nil {
+			return nil, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 1 {
+			reminder.Status = ReminderSending
+			claimed = append(claimed, reminder)
+		}
+	}
+	return claimed, nil
+}
+
+// FinishReminder 记录提醒的发送结果，失败时按指数退避重试，超过次数后标记为失败
+func FinishReminder(reminder *Reminder, now time.Time, sendErr error) error {
+	reminder.Attempts++
+	reminder.UpdatedAt = now
+	switch {
+	case sendErr == nil:
+		reminder.Status = ReminderSent
+		reminder.LastError = ""
+		reminder.FiredAt = now
+	case reminder.Attempts >= maxReminderAttempts:
+		reminder.Status = ReminderFailed
+		reminder.LastError = sendErr.Error()
+	default:
+		reminder.Status = ReminderPending
+		reminder.LastError = sendErr.Error()
+		reminder.RemindAt = now.Add(time.Duration(1<<uint(reminder.Attempts)) * time.Minute)
+	}
+	return saveReminderToDB(reminder)
+}
+
+// ReleaseReminder 将已领取但暂时无法处理的提醒放回待发送状态，下次检查时重新处理
+func ReleaseReminder(reminder *Reminder, now time.Time) error {
+	_, err := db.Exec(`UPDATE reminders SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		ReminderPending, timeToString(now), reminder.ID, ReminderSending)
+	if err != nil {
+		return err
+	}
+	reminder.Status = ReminderPending
+	return nil
+}
+
+// CancelReminder 任务已完成、已删除或用户已无权查看时取消提醒
+func CancelReminder(reminder *Reminder, now time.Time, reason string) error {
+	reminder.Status = ReminderCancelled
+	reminder.LastError = reason
+	reminder.UpdatedAt = now
+	return saveReminderToDB(reminder)
+}
+
+// RecoverInterruptedReminders 服务启动时处理上次发送过程中中断的提醒
+// 无法确定这些提醒是否已经送达，为避免重复发送直接标记为失败
+func RecoverInterruptedReminders(now time.Time) (int, error) {
+	result, err := db.Exec(`UPDATE reminders SET status = ?, last_error = ?, updated_at = ? WHERE status = ?`,
+		ReminderFailed, "发送过程中服务中断", timeToString(now), ReminderSending)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
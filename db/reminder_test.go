@@ -0,0 +1,26 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateEmailReminderOnlyToOwnAddress(t *testing.T) {
+	setupTestDB(t)
+	Users = append(Users, User{ID: "user", Username: "user", Email: "user@example.com"})
+	t.Cleanup(func() { Users = Users[:len(Users)-1] })
+	todo := createTestTodo(t, "user", "", "任务")
+
+	reminder := &Reminder{TodoID: todo.ID, Channel: ChannelEmail, Target: "victim@example.com", RemindAt: time.Now()}
+	if err := CreateReminder("user", reminder); err == nil {
+		t.Error("不应该允许向其他邮箱发送提醒")
+	}
+
+	reminder = &Reminder{TodoID: todo.ID, Channel: ChannelEmail, Target: "USER@example.com", RemindAt: time.Now()}
+	if err := CreateReminder("user", reminder); err != nil {
+		t.Fatalf("应该允许向自己的邮箱发送提醒: %v", err)
+	}
+	if reminder.Target != "" {
+		t.Errorf("邮件提醒应该总是发送到账号的邮箱，实际保存的地址为 %s", reminder.Target)
+	}
+}
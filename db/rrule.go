@@ -0,0 +1,332 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 重复规则频率
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// 计算下一次重复时最多向后查找的周期数，避免无效规则导致死循环
+const maxRRuleIterations = 1000
+
+// RRULE中星期的写法
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRuleDay BYDAY中的一项，Ordinal不为0时表示当月第几个（负数表示倒数第几个）该星期
+type RRuleDay struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// RRule RFC 5545重复规则，支持DAILY/WEEKLY/MONTHLY、INTERVAL、BYDAY、BYMONTHDAY、COUNT和UNTIL
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []RRuleDay
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+
+	// UNTIL为日期或不带Z的当地时间时为true，此时Until的钟点按重复序列所在的时区解释
+	untilFloating bool
+}
+
+// ParseRRule 解析RRULE字符串，兼容带"RRULE:"前缀的写法
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("重复规则不能为空")
+	}
+
+	rule := &RRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("无效的重复规则: %s", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return nil, fmt.Errorf("不支持的重复频率: %s", value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("无效的INTERVAL: %s", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("无效的COUNT: %s", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, floating, err := parseRRuleUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+			rule.untilFloating = floating
+		case "BYDAY":
+			for _, item := range strings.Split(value, ",") {
+				day, err := parseRRuleDay(item)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, item := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(item)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("无效的BYMONTHDAY: %s", item)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			// 一周固定从周一开始
+			if value != "MO" {
+				return nil, errors.New("WKST只支持MO")
+			}
+		default:
+			return nil, fmt.Errorf("不支持的重复规则属性: %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("重复规则缺少FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("COUNT和UNTIL不能同时使用")
+	}
+	if len(rule.ByMonthDay) > 0 && len(rule.ByDay) > 0 {
+		return nil, errors.New("BYDAY和BYMONTHDAY不能同时使用")
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != FreqMonthly {
+		return nil, errors.New("BYMONTHDAY只能用于MONTHLY")
+	}
+	for _, day := range rule.ByDay {
+		if day.Ordinal != 0 && rule.Freq != FreqMonthly {
+			return nil, errors.New("带序号的BYDAY只能用于MONTHLY")
+		}
+	}
+
+	return rule, nil
+}
+
+// 解析BYDAY中的一项，例如MO、1MO、-1FR
+func parseRRuleDay(s string) (RRuleDay, error) {
+	if len(s) < 2 {
+		return RRuleDay{}, fmt.Errorf("无效的BYDAY: %s", s)
+	}
+	weekday, ok := rruleWeekdays[s[len(s)-2:]]
+	if !ok {
+		return RRuleDay{}, fmt.Errorf("无效的BYDAY: %s", s)
+	}
+
+	day := RRuleDay{Weekday: weekday}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return RRuleDay{}, fmt.Errorf("无效的BYDAY: %s", s)
+		}
+		day.Ordinal = n
+	}
+	return day, nil
+}
+
+// 解析UNTIL，支持UTC时间、不带Z的当地时间和日期三种写法
+// 后两种写法没有时区，返回的钟点在计算时按重复序列所在的时区解释（floating为true）
+func parseRRuleUntil(s string) (until time.Time, floating bool, err error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("20060102T150405", s); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse("20060102", s); err == nil {
+		// 只有日期时包含当天全天
+		return t.Add(24*time.Hour - time.Second), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("无效的UNTIL: %s", s)
+}
+
+// UNTIL在loc时区中对应的时刻
+func (r *RRule) untilIn(loc *time.Location) time.Time {
+	if !r.untilFloating {
+		return r.Until
+	}
+	y, m, d := r.Until.Date()
+	h, min, s := r.Until.Clock()
+	return time.Date(y, m, d, h, min, s, 0, loc)
+}
+
+// Next 计算current之后的下一次重复时间，没有下一次时返回false
+// 计算在current所在的时区中进行，按当地时间保持钟点不变，因此跨越夏令时切换时不会偏移
+// index为current在整个重复序列中的序号（从1开始），用于判断COUNT
+func (r *RRule) Next(current time.Time, index int) (time.Time, bool) {
+	if r.Count > 0 && index >= r.Count {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case FreqDaily:
+		next, ok = r.nextDaily(current), true
+	case FreqWeekly:
+		next, ok = r.nextWeekly(current)
+	case FreqMonthly:
+		next, ok = r.nextMonthly(current)
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.untilIn(current.Location())) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// 在current的日期基础上增加天数，保持当地钟点不变
+func addDays(current time.Time, days int) time.Time {
+	y, m, d := current.Date()
+	h, min, s := current.Clock()
+	return time.Date(y, m, d+days, h, min, s, 0, current.Location())
+}
+
+// 判断某一天是否满足不带序号的BYDAY条件
+func (r *RRule) matchWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Ordinal == 0 && day.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RRule) nextDaily(current time.Time) time.Time {
+	next := addDays(current, r.Interval)
+	// 带BYDAY的DAILY规则跳过不符合的日期
+	for i := 0; i < maxRRuleIterations && !r.matchWeekday(next); i++ {
+		next = addDays(next, r.Interval)
+	}
+	return next
+}
+
+func (r *RRule) nextWeekly(current time.Time) (time.Time, bool) {
+	if len(r.ByDay) == 0 {
+		return addDays(current, 7*r.Interval), true
+	}
+
+	// 本周剩余的日期（周一为一周的第一天）
+	offset := (int(current.Weekday()) + 6) % 7
+	for i := offset + 1; i < 7; i++ {
+		next := addDays(current, i-offset)
+		if r.matchWeekday(next) {
+			return next, true
+		}
+	}
+
+	// 跳到INTERVAL周之后的周一重新查找
+	weekStart := addDays(current, 7*r.Interval-offset)
+	for i := 0; i < 7; i++ {
+		next := addDays(weekStart, i)
+		if r.matchWeekday(next) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *RRule) nextMonthly(current time.Time) (time.Time, bool) {
+	y, m, _ := current.Date()
+	h, min, s := current.Clock()
+	loc := current.Location()
+
+	for i := 0; i < maxRRuleIterations; i++ {
+		month := time.Date(y, m+time.Month(i*r.Interval), 1, h, min, s, 0, loc)
+		for _, day := range r.monthDays(month, current.Day()) {
+			next := time.Date(month.Year(), month.Month(), day, h, min, s, 0, loc)
+			if next.After(current) {
+				return next, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// 计算某个月中符合规则的日期（升序），没有BYDAY和BYMONTHDAY时使用起始日期的日
+// 当月不存在的日期（例如2月30日）按RFC 5545的规定直接跳过
+func (r *RRule) monthDays(month time.Time, startDay int) []int {
+	daysInMonth := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	set := map[int]bool{}
+
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if startDay <= daysInMonth {
+			set[startDay] = true
+		}
+	}
+
+	for _, n := range r.ByMonthDay {
+		day := n
+		if n < 0 {
+			day = daysInMonth + n + 1
+		}
+		if day >= 1 && day <= daysInMonth {
+			set[day] = true
+		}
+	}
+
+	for _, byDay := range r.ByDay {
+		var matches []int
+		for day := 1; day <= daysInMonth; day++ {
+			if time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.UTC).Weekday() == byDay.Weekday {
+				matches = append(matches, day)
+			}
+		}
+		switch {
+		case byDay.Ordinal == 0:
+			for _, day := range matches {
+				set[day] = true
+			}
+		case byDay.Ordinal > 0 && byDay.Ordinal <= len(matches):
+			set[matches[byDay.Ordinal-1]] = true
+		case byDay.Ordinal < 0 && -byDay.Ordinal <= len(matches):
+			set[matches[len(matches)+byDay.Ordinal]] = true
+		}
+	}
+
+	days := make([]int, 0, len(set))
+	for day := range set {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	return days
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 从start开始展开最多n次重复（包括start本身）
+func expandRRule(t *testing.T, rule string, start time.Time, n int) []time.Time {
+	t.Helper()
+
+	r, err := ParseRRule(rule)
+	if err != nil {
+		t.Fatalf("解析 %s 失败: %v", rule, err)
+	}
+	occurrences := []time.Time{start}
+	for index := 1; len(occurrences) < n; index++ {
+		next, ok := r.Next(occurrences[len(occurrences)-1], index)
+		if !ok {
+			break
+		}
+		occurrences = append(occurrences, next)
+	}
+	return occurrences
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("无法加载时区 %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestRRuleNext(t *testing.T) {
+	utc := time.UTC
+	newYork := mustLoadLocation(t, "America/New_York")
+	shanghai := mustLoadLocation(t, "Asia/Shanghai")
+	date := func(loc *time.Location, y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		n     int
+		want  []time.Time
+	}{
+		{
+			name:  "每隔一天",
+			rule:  "FREQ=DAILY;INTERVAL=2",
+			start: date(utc, 2025, 1, 30, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 30, 9, 0), date(utc, 2025, 2, 1, 9, 0), date(utc, 2025, 2, 3, 9, 0)},
+		},
+		{
+			name:  "工作日",
+			rule:  "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			start: date(utc, 2025, 1, 3, 9, 0), // 周五
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 3, 9, 0), date(utc, 2025, 1, 6, 9, 0), date(utc, 2025, 1, 7, 9, 0)},
+		},
+		{
+			name:  "每周一三五",
+			rule:  "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			start: date(utc, 2025, 1, 6, 9, 0), // 周一
+			n:     5,
+			want: []time.Time{
+				date(utc, 2025, 1, 6, 9, 0), date(utc, 2025, 1, 8, 9, 0), date(utc, 2025, 1, 10, 9, 0),
+				date(utc, 2025, 1, 13, 9, 0), date(utc, 2025, 1, 15, 9, 0),
+			},
+		},
+		{
+			name:  "每两周的周二",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+			start: date(utc, 2025, 1, 7, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 7, 9, 0), date(utc, 2025, 1, 21, 9, 0), date(utc, 2025, 2, 4, 9, 0)},
+		},
+		{
+			name:  "每月31日跳过没有31日的月份",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31",
+			start: date(utc, 2025, 1, 31, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 31, 9, 0), date(utc, 2025, 3, 31, 9, 0), date(utc, 2025, 5, 31, 9, 0)},
+		},
+		{
+			name:  "每月最后一天",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(utc, 2024, 1, 31, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2024, 1, 31, 9, 0), date(utc, 2024, 2, 29, 9, 0), date(utc, 2024, 3, 31, 9, 0)},
+		},
+		{
+			name:  "每月最后一个周五",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: date(utc, 2025, 1, 31, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 31, 9, 0), date(utc, 2025, 2, 28, 9, 0), date(utc, 2025, 3, 28, 9, 0)},
+		},
+		{
+			name:  "每月第二个周一",
+			rule:  "FREQ=MONTHLY;BYDAY=2MO",
+			start: date(utc, 2025, 1, 13, 9, 0),
+			n:     3,
+			want:  []time.Time{date(utc, 2025, 1, 13, 9, 0), date(utc, 2025, 2, 10, 9, 0), date(utc, 2025, 3, 10, 9, 0)},
+		},
+		{
+			name:  "2月29日每月重复时跳过平年2月",
+			rule:  "FREQ=MONTHLY;INTERVAL=12",
+			start: date(utc, 2024, 2, 29, 9, 0),
+			n:     2,
+			want:  []time.Time{date(utc, 2024, 2, 29, 9, 0), date(utc, 2028, 2, 29, 9, 0)},
+		},
+		{
+			name:  "COUNT包括第一次",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: date(utc, 2025, 1, 1, 9, 0),
+			n:     10,
+			want:  []time.Time{date(utc, 2025, 1, 1, 9, 0), date(utc, 2025, 1, 2, 9, 0), date(utc, 2025, 1, 3, 9, 0)},
+		},
+		{
+			name:  "UTC写法的UNTIL",
+			rule:  "FREQ=DAILY;UNTIL=20250103T090000Z",
+			start: date(utc, 2025, 1, 1, 9, 0),
+			n:     10,
+			want:  []time.Time{date(utc, 2025, 1, 1, 9, 0), date(utc, 2025, 1, 2, 9, 0), date(utc, 2025, 1, 3, 9, 0)},
+		},
+		{
+			name:  "日期写法的UNTIL按序列时区包含当天",
+			rule:  "FREQ=DAILY;UNTIL=20250301",
+			start: date(newYork, 2025, 2, 27, 20, 0), // 当地20点是UTC第二天1点
+			n:     10,
+			want:  []time.Time{date(newYork, 2025, 2, 27, 20, 0), date(newYork, 2025, 2, 28, 20, 0), date(newYork, 2025, 3, 1, 20, 0)},
+		},
+		{
+			name:  "不带Z的UNTIL按序列时区解释",
+			rule:  "FREQ=DAILY;UNTIL=20250301T080000",
+			start: date(shanghai, 2025, 2, 27, 9, 0),
+			n:     10,
+			want:  []time.Time{date(shanghai, 2025, 2, 27, 9, 0), date(shanghai, 2025, 2, 28, 9, 0)},
+		},
+		{
+			name:  "跨越夏令时保持当地钟点",
+			rule:  "FREQ=DAILY",
+			start: date(newYork, 2025, 3, 8, 9, 0),
+			n:     3,
+			want:  []time.Time{date(newYork, 2025, 3, 8, 9, 0), date(newYork, 2025, 3, 9, 9, 0), date(newYork, 2025, 3, 10, 9, 0)},
+		},
+		{
+			name:  "每周重复跨越夏令时结束",
+			rule:  "FREQ=WEEKLY",
+			start: date(newYork, 2025, 10, 30, 18, 30),
+			n:     2,
+			want:  []time.Time{date(newYork, 2025, 10, 30, 18, 30), date(newYork, 2025, 11, 6, 18, 30)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expandRRule(t, tt.rule, tt.start, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("得到 %d 次重复 %v，期望 %d 次 %v", len(got), got, len(tt.want), tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("第 %d 次为 %v，期望 %v", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250101",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYDAY=MO;BYMONTHDAY=1",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;UNTIL=2025-01-01",
+		"FREQ=DAILY;WKST=SU",
+	} {
+		if _, err := ParseRRule(rule); err == nil {
+			t.Errorf("%q 应该解析失败", rule)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// 全文搜索每页默认和最多返回的结果数量
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// trigram分词器只能匹配至少三个字符的词，更短的词使用LIKE匹配
+const trigramLength = 3
+
+// 搜索结果中描述摘要的长度（字符数）
+const snippetLength = 60
+
+// 全文索引是否可用，编译时需要加上-tags sqlite_fts5
+var searchIndexEnabled bool
+
+// SearchResult 搜索结果，NameHighlight和Snippet中的匹配部分用<mark>标记，其余内容已做HTML转义
+type SearchResult struct {
+	Todo          Todo    `json:"todo"`
+	Score         float64 `json:"score"` // 相关度，数值越大越相关
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// 同步全文索引的触发器
+var searchIndexTriggers = []string{"todos_fts_before_insert", "todos_fts_after_insert", "todos_fts_after_delete", "todos_fts_after_update"}
+
+// 创建任务名称和描述的全文索引，并通过触发器与任务表保持同步
+// 使用trigram分词器，中文等不以空格分词的文字也可以按任意连续的字符搜索
+// 索引以任务表的rowid关联，VACUUM后需要重建索引
+// 数据库可能由启用FTS5的版本创建，当前版本未启用FTS5时需要删除触发器，否则写入任务时会报错
+func initSearchIndex() error {
+	var fts5 int
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return err
+	}
+	if fts5 == 0 {
+		log.Printf("SQLite未启用FTS5，搜索将使用LIKE匹配（编译时加上-tags sqlite_fts5启用全文索引）")
+		return dropSearchIndexTriggers()
+	}
+
+	// 索引表不存在或触发器被删除过时，索引可能与任务表不一致，需要重建
+	var exists, triggers int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'todos_fts'`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND tbl_name = 'todos' AND name LIKE 'todos_fts_%'`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(
+		name, description,
+		content = 'todos', content_rowid = 'rowid',
+		tokenize = 'trigram'
+	);
+	`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such tokenizer") {
+			log.Printf("SQLite版本不支持trigram分词器，搜索将使用LIKE匹配")
+			return dropSearchIndexTriggers()
+		}
+		return err
+	}
+
+	// INSERT OR REPLACE删除旧行时不会触发DELETE触发器，因此在插入前先从索引中删除同ID的旧任务
+	statements := []string{
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_before_insert BEFORE INSERT ON todos BEGIN
+			INSERT INTO todos_fts (todos_fts, rowid, name, description)
+			SELECT 'delete', rowid, name, description FROM todos WHERE id = new.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_after_insert AFTER INSERT ON todos BEGIN
+			INSERT INTO todos_fts (rowid, name, description) VALUES (new.rowid, new.name, new.description);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_after_delete AFTER DELETE ON todos BEGIN
+			INSERT INTO todos_fts (todos_fts, rowid, name, description) VALUES ('delete', old.rowid, old.name, old.description);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_after_update AFTER UPDATE OF name, description ON todos BEGIN
+			INSERT INTO todos_fts (todos_fts, rowid, name, description) VALUES ('delete', old.rowid, old.name, old.description);
+			INSERT INTO todos_fts (rowid, name, description) VALUES (new.rowid, new.name, new.description);
+		END;`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if exists == 0 || triggers < len(searchIndexTriggers) {
+		if err := RebuildSearchIndex(); err != nil {
+			return err
+		}
+	}
+
+	searchIndexEnabled = true
+	return nil
+}
+
+// 删除同步全文索引的触发器，索引表本身需要FTS5才能删除，保留到下次启用FTS5时重建
+func dropSearchIndexTriggers() error {
+	for _, trigger := range searchIndexTriggers {
+		if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildSearchIndex 根据任务表重建全文索引
+func RebuildSearchIndex() error {
+	_, err := db.Exec(`INSERT INTO todos_fts (todos_fts) VALUES ('rebuild')`)
+	return err
+}
+
+// 将搜索内容拆分为关键词，关键词之间是“并且”的关系
+// 由于trigram按任意连续字符匹配，关键词末尾的*（前缀匹配）可以省略
+func searchTerms(text string) []string {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		term = strings.Trim(term, `*"`)
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// 生成FTS5的MATCH表达式，每个关键词作为一个短语
+func matchExpression(terms []string) string {
+	var phrases []string
+	for _, term := range terms {
+		phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// SearchTodosFromDB 在用户可访问的任务名称和描述中搜索，可以与任务列表的过滤条件组合
+// 有全文索引时按相关度排序（名称中的匹配权重更高），否则按更新时间倒序
+// 搜索内容或过滤条件无效时返回的错误可以用IsInvalidQuery判断
+func SearchTodosFromDB(userID, text string, filter TodoFilter, limit, offset int) ([]SearchResult, error) {
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return nil, &invalidQueryError{fmt.Errorf("搜索内容不能为空")}
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	filter.Text = ""
+	condition, args, err := todoFilterCondition(userID, &filter)
+	if err != nil {
+		return nil, &invalidQueryError{err}
+	}
+
+	// 足够长的关键词交给全文索引，其余的使用LIKE
+	var matchTerms []string
+	for _, term := range terms {
+		if searchIndexEnabled && len([]rune(term)) >= trigramLength {
+			matchTerms = append(matchTerms, term)
+			continue
+		}
+		pattern := "%" + escapeLike(term) + "%"
+		condition += ` AND (name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern)
+	}
+
+	var query string
+	if len(matchTerms) > 0 {
+		// bm25越小越相关，取负数作为相关度
+		query = `
+		WITH matches AS (
+			SELECT rowid AS match_rowid, -bm25(todos_fts, 10.0, 1.0) AS score
+			FROM todos_fts
+			WHERE todos_fts MATCH ?
+		)
+		SELECT ` + todoColumns + `, matches.score
+		FROM todos JOIN matches ON todos.rowid = matches.match_rowid
+		WHERE ` + condition + `
+		ORDER BY matches.score DESC, ` + utcTimeExpr("updated_at") + ` DESC
+		LIMIT ? OFFSET ?
+		`
+		args = append([]interface{}{matchExpression(matchTerms)}, args...)
+	} else {
+		query = `
+		SELECT ` + todoColumns + `, 0
+		FROM todos
+		WHERE ` + condition + `
+		ORDER BY ` + utcTimeExpr("updated_at") + ` DESC
+		LIMIT ? OFFSET ?
+		`
+	}
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	var scores []float64
+	for rows.Next() {
+		var score float64
+		todo, err := scanTodo(extraScanner{rows, []interface{}{&score}})
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+		scores = append(scores, score)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	err = loadTodoTags(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadSubtaskProgress(todos)
+	if err != nil {
+		return nil, err
+	}
+	err = loadTodoDependencies(todos)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(todos))
+	for i, todo := range todos {
+		results = append(results, SearchResult{
+			Todo:          todo,
+			Score:         scores[i],
+			NameHighlight: highlightTerms(todo.Name, terms, 0),
+			Snippet:       highlightTerms(todo.Description, terms, snippetLength),
+		})
+	}
+	return results, nil
+}
+
+// extraScanner 在任务的列之后扫描额外的列
+type extraScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// 查找文本中所有关键词出现的位置（按字符，忽略大小写），返回[开始, 结束)区间
+func findTerms(text []rune, terms []string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, term := range terms {
+			if n := matchRunesAt(text, i, []rune(term)); n > matched {
+				matched = n
+			}
+		}
+		if matched > 0 {
+			spans = append(spans, [2]int{i, i + matched})
+			i += matched
+		} else {
+			i++
+		}
+	}
+	return spans
+}
+
+func matchRunesAt(text []rune, start int, term []rune) int {
+	if len(term) == 0 || start+len(term) > len(text) {
+		return 0
+	}
+	for j, r := range term {
+		if unicode.ToLower(text[start+j]) != unicode.ToLower(r) {
+			return 0
+		}
+	}
+	return len(term)
+}
+
+// 将文本中的关键词用<mark>标记，其余内容做HTML转义
+// maxLength大于0时只截取第一个匹配附近的一段文字
+func highlightTerms(text string, terms []string, maxLength int) string {
+	runes := []rune(text)
+	spans := findTerms(runes, terms)
+
+	start, end := 0, len(runes)
+	if maxLength > 0 && len(runes) > maxLength {
+		if len(spans) > 0 {
+			// 匹配之前保留约四分之一的上下文
+			start = spans[0][0] - maxLength/4
+			if start < 0 {
+				start = 0
+			}
+		}
+		end = start + maxLength
+		if end > len(runes) {
+			end = len(runes)
+			start = end - maxLength
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, span := range spans {
+		if span[1] <= start {
+			continue
+		}
+		if span[0] >= end {
+			break
+		}
+		from, to := span[0], span[1]
+		if from < pos {
+			from = pos
+		}
+		if to > end {
+			to = end
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:from])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[from:to])))
+		b.WriteString("</mark>")
+		pos = to
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
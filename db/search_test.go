@@ -0,0 +1,45 @@
+package db
+
+import "testing"
+
+func TestSearchTodosDistinguishesInvalidQuery(t *testing.T) {
+	setupTestDB(t)
+	createTestTodo(t, "user", "", "提交季度报告")
+	createTestTodo(t, "user", "", "买菜")
+	createTestTodo(t, "other", "", "其他用户的报告")
+
+	results, err := SearchTodosFromDB("user", "报告", TodoFilter{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("应该只搜索到自己的1个任务，实际为 %d", len(results))
+	}
+
+	for name, search := range map[string]func() error{
+		"空的搜索内容": func() error {
+			_, err := SearchTodosFromDB("user", "  ", TodoFilter{}, 0, 0)
+			return err
+		},
+		"无效的查询范围": func() error {
+			_, err := SearchTodosFromDB("user", "报告", TodoFilter{View: "shared"}, 0, 0)
+			return err
+		},
+		"无效的优先级": func() error {
+			_, err := SearchTodosFromDB("user", "报告", TodoFilter{Priorities: []Priority{"critical"}}, 0, 0)
+			return err
+		},
+	} {
+		if err := search(); !IsInvalidQuery(err) {
+			t.Errorf("%s应该返回查询参数错误，实际为 %v", name, err)
+		}
+	}
+
+	// 数据库错误不是查询参数错误
+	if _, err := db.Exec(`ALTER TABLE todos RENAME TO todos_old`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SearchTodosFromDB("user", "报告", TodoFilter{}, 0, 0); err == nil || IsInvalidQuery(err) {
+		t.Errorf("数据库错误不应该被当作查询参数错误，实际为 %v", err)
+	}
+}
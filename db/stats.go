@@ -0,0 +1,48 @@
+package db
+
+import (
+	"time"
+)
+
+// ServerStats 服务器统计信息
+type ServerStats struct {
+	TotalUsers     int       `json:"total_users"`
+	AdminUsers     int       `json:"admin_users"`
+	DisabledUsers  int       `json:"disabled_users"`
+	TotalDevices   int       `json:"total_devices"`
+	ActiveDevices  int       `json:"active_devices"` // 最近24小时活跃的设备
+	TotalTodos     int       `json:"total_todos"`
+	CompletedTodos int       `json:"completed_todos"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+// 统计服务器数据
+func GetServerStats() (ServerStats, error) {
+	now := time.Now()
+	stats := ServerStats{GeneratedAt: now}
+
+	for _, user := range Users {
+		stats.TotalUsers++
+		if user.Role == RoleAdmin {
+			stats.AdminUsers++
+		}
+		if user.Disabled {
+			stats.DisabledUsers++
+		}
+	}
+
+	for _, device := range Devices {
+		stats.TotalDevices++
+		if now.Sub(device.LastSeen) < 24*time.Hour {
+			stats.ActiveDevices++
+		}
+	}
+
+	var err error
+	stats.TotalTodos, stats.CompletedTodos, err = CountTodosFromDB()
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 父任务不存在错误，同步时子任务可能先于父任务到达
+var errParentNotFound = errors.New("父任务不存在")
+
+// 查询某个任务所有层级子任务的递归语句，使用UNION去重避免异常数据中的环导致死循环
+// 使用时需要传入一次父任务ID
+const descendantsQuery = `
+	WITH RECURSIVE descendants(id) AS (
+		SELECT id FROM todos WHERE parent_id = ?
+		UNION
+		SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id
+	)`
+
+// IsParentNotFound 判断错误是否为父任务不存在
+func IsParentNotFound(err error) bool {
+	return err == errParentNotFound
+}
+
+// 校验任务的父任务：父任务必须存在、与任务属于同一清单，且不能形成循环
+func ApplyTodoParent(userID string, todo *Todo) error {
+	if todo.ParentID == "" {
+		return nil
+	}
+	if todo.ParentID == todo.ID {
+		return errors.New("不能将任务设为自己的子任务")
+	}
+
+	parent, err := GetTodoFromDB(todo.ParentID)
+	if err == sql.ErrNoRows {
+		return errParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !CanViewTodo(userID, parent) {
+		return errors.New("无权访问父任务")
+	}
+	if parent.ListID != todo.ListID || (parent.ListID == "" && parent.UserID != todo.UserID) {
+		return errors.New("父任务与任务不属于同一清单")
+	}
+	if parent.DeletedAt != nil && todo.DeletedAt == nil {
+		return errors.New("父任务在回收站中")
+	}
+
+	// 沿父任务向上查找，如果遇到当前任务说明会形成循环
+	visited := map[string]bool{parent.ID: true}
+	parentID := parent.ParentID
+	for parentID != "" && !visited[parentID] {
+		if parentID == todo.ID {
+			return errors.New("不能将任务移动到自己的子任务下")
+		}
+		visited[parentID] = true
+
+		err = db.QueryRow(`SELECT parent_id FROM todos WHERE id = ?`, parentID).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 检查任务是否有子任务
+func HasSubtasks(todoID string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM todos WHERE parent_id = ?`, todoID).Scan(&count)
+	return count > 0, err
+}
+
+// 将任务的所有层级子任务设置为完成或未完成，状态按各自项目的工作流变更（不检查状态变更规则）
+func SetSubtasksCompleted(userID, todoID string, completed bool) error {
+	query := descendantsQuery + `
+	SELECT ` + todoColumns + ` FROM todos WHERE id IN (SELECT id FROM descendants) AND completed != ?`
+	rows, err := db.Query(query, todoID, boolToInt(completed))
+	if err != nil {
+		return err
+	}
+
+	var subtasks []Todo
+	for rows.Next() {
+		subtask, err := scanTodo(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		subtasks = append(subtasks, subtask)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range subtasks {
+		subtask := &subtasks[i]
+		wf, err := workflowForTodo(subtask)
+		if err != nil {
+			return err
+		}
+		previous := *subtask
+		subtask.Status = wf.completionStatus(subtask.Status, completed)
+		subtask.Completed = completed
+
+		_, err = db.Exec(`UPDATE todos SET completed = ?, status = ?, updated_at = ? WHERE id = ?`,
+			boolToInt(completed), subtask.Status, timeToString(now), subtask.ID)
+		if err != nil {
+			return err
+		}
+		if err := RecordTodoChanges(userID, &previous, subtask); err != nil {
+			return err
+		}
+		NotifyUnblockedTodos(userID, &previous, subtask)
+	}
+	return nil
+}
+
+// 删除任务（权限检查由调用方负责）
+// cascade为true时同时删除所有层级的子任务，否则子任务移动到被删除任务的父任务下
+func DeleteTodo(todo *Todo, cascade bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := []interface{}{todo.ID}
+	if cascade {
+		rows, err := tx.Query(descendantsQuery+` SELECT id FROM descendants`, todo.ID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	} else {
+		_, err = tx.Exec(`UPDATE todos SET parent_id = ?, updated_at = ? WHERE parent_id = ?`,
+			todo.ParentID, timeToString(time.Now()), todo.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	hashes, err := purgeTodoRows(tx, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	removeBlobs(hashes)
+	return nil
+}
+
+// 在事务中彻底删除一组任务及其标签、依赖、评论、附件、提醒和计时记录，并记录删除标记用于同步
+// 返回附件引用的内容哈希，提交后通过removeBlobs删除不再被引用的内容
+func purgeTodoRows(tx *sql.Tx, ids []interface{}) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	in := placeholders(len(ids))
+	_, err := tx.Exec(`DELETE FROM todo_tags WHERE todo_id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM todo_dependencies WHERE todo_id IN (`+in+`) OR blocker_id IN (`+in+`)`, append(ids, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM comments WHERE todo_id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM reminders WHERE todo_id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	// 附件的内容在提交后检查是否还有其他附件引用
+	var hashes []string
+	rows, err := tx.Query(`SELECT DISTINCT blob_hash FROM attachments WHERE todo_id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM attachments WHERE todo_id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	// 计时记录保留删除标记，使其他设备同步删除（包括正在运行的计时器）
+	_, err = tx.Exec(`UPDATE time_entries SET deleted = 1, updated_at = ? WHERE deleted = 0 AND todo_id IN (`+in+`)`,
+		append([]interface{}{timeToString(time.Now())}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordPurgedTodos(tx, in, ids); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM todos WHERE id IN (`+in+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// 删除不再被任何附件引用的内容
+func removeBlobs(hashes []string) {
+	if len(hashes) == 0 {
+		return
+	}
+	blobMu.Lock()
+	removeUnreferencedBlobs(hashes)
+	blobMu.Unlock()
+}
+
+// 批量计算任务的子任务数量和完成百分比
+func loadSubtaskProgress(todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(todos))
+	for i := range todos {
+		todos[i].SubtaskCount = 0
+		todos[i].SubtaskCompleted = 0
+		index[todos[i].ID] = i
+	}
+
+	for start := 0; start < len(todos); start += tagQueryBatchSize {
+		end := start + tagQueryBatchSize
+		if end > len(todos) {
+			end = len(todos)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, todo := range todos[start:end] {
+			args = append(args, todo.ID)
+		}
+
+		rows, err := db.Query(`
+		WITH RECURSIVE tree(root_id, id) AS (
+			SELECT parent_id, id FROM todos WHERE parent_id IN (`+placeholders(len(args))+`) AND deleted_at = ''
+			UNION
+			SELECT tree.root_id, t.id FROM todos t JOIN tree ON t.parent_id = tree.id WHERE t.deleted_at = ''
+		)
+		SELECT tree.root_id, COUNT(*), COALESCE(SUM(t.completed), 0)
+		FROM tree JOIN todos t ON t.id = tree.id
+		GROUP BY tree.root_id
+		`, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var rootID string
+			var count, completed int
+			if err := rows.Scan(&rootID, &count, &completed); err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := index[rootID]; ok {
+				todos[i].SubtaskCount = count
+				todos[i].SubtaskCompleted = completed
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for i := range todos {
+		switch {
+		case todos[i].SubtaskCount > 0:
+			todos[i].Progress = todos[i].SubtaskCompleted * 100 / todos[i].SubtaskCount
+		case todos[i].Completed:
+			todos[i].Progress = 100
+		default:
+			todos[i].Progress = 0
+		}
+	}
+
+	return nil
+}
+
+// 调整客户端提交的任务顺序，保证同一批中的父任务先于子任务处理
+func orderTodosByParent(todos []Todo) []Todo {
+	index := make(map[string]int, len(todos))
+	for i, todo := range todos {
+		index[todo.ID] = i
+	}
+
+	ordered := make([]Todo, 0, len(todos))
+	added := make([]bool, len(todos))
+	visiting := make([]bool, len(todos))
+
+	var visit func(i int)
+	visit = func(i int) {
+		if added[i] || visiting[i] {
+			return
+		}
+		visiting[i] = true
+		if p, ok := index[todos[i].ParentID]; ok {
+			visit(p)
+		}
+		visiting[i] = false
+		added[i] = true
+		ordered = append(ordered, todos[i])
+	}
+
+	for i := range todos {
+		visit(i)
+	}
+	return ordered
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// 创建指定父任务下的子任务
+func createTestSubtask(t *testing.T, parent *Todo, name string) *Todo {
+	t.Helper()
+
+	todo := createTestTodo(t, parent.UserID, parent.ListID, name)
+	todo.ParentID = parent.ID
+	if err := ApplyTodoParent(parent.UserID, todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestApplyTodoParent(t *testing.T) {
+	setupTestDB(t)
+
+	root := createTestTodo(t, "alice", "", "父任务")
+	child := createTestSubtask(t, root, "子任务")
+	grandchild := createTestSubtask(t, child, "孙任务")
+
+	root.ParentID = grandchild.ID
+	if err := ApplyTodoParent("alice", root); err == nil {
+		t.Error("不应该允许形成循环")
+	}
+	root.ParentID = root.ID
+	if err := ApplyTodoParent("alice", root); err == nil {
+		t.Error("不应该允许将任务设为自己的子任务")
+	}
+
+	other := createTestTodo(t, "bob", "", "其他用户的任务")
+	other.ParentID = root.ID
+	if err := ApplyTodoParent("bob", other); err == nil {
+		t.Error("不应该允许使用无权访问的父任务")
+	}
+
+	orphan := createTestTodo(t, "alice", "", "任务")
+	orphan.ParentID = "missing"
+	if err := ApplyTodoParent("alice", orphan); !IsParentNotFound(err) {
+		t.Errorf("父任务不存在时应该返回对应的错误，实际为 %v", err)
+	}
+}
+
+func TestSubtaskProgressAndCascade(t *testing.T) {
+	setupTestDB(t)
+
+	root := createTestTodo(t, "alice", "", "父任务")
+	child := createTestSubtask(t, root, "子任务")
+	createTestSubtask(t, child, "孙任务")
+	createTestSubtask(t, root, "另一个子任务")
+
+	if err := SetSubtasksCompleted("alice", child.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	child.Completed = true
+	if err := SaveTodoToDB(child); err != nil {
+		t.Fatal(err)
+	}
+
+	todos := []Todo{*root}
+	if err := loadSubtaskProgress(todos); err != nil {
+		t.Fatal(err)
+	}
+	if todos[0].SubtaskCount != 3 || todos[0].SubtaskCompleted != 2 || todos[0].Progress != 66 {
+		t.Errorf("父任务的进度不正确: %d/%d %d%%", todos[0].SubtaskCompleted, todos[0].SubtaskCount, todos[0].Progress)
+	}
+}
+
+func TestDeleteTodoSubtasks(t *testing.T) {
+	setupTestDB(t)
+
+	root := createTestTodo(t, "alice", "", "父任务")
+	child := createTestSubtask(t, root, "子任务")
+	grandchild := createTestSubtask(t, child, "孙任务")
+
+	// 不级联删除时子任务移动到被删除任务的父任务下
+	if err := DeleteTodo(child, false); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := GetTodoFromDB(grandchild.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.ParentID != root.ID {
+		t.Errorf("孙任务应该移动到父任务下，实际父任务为 %q", moved.ParentID)
+	}
+
+	// 级联删除所有层级的子任务
+	if err := DeleteTodo(root, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{root.ID, grandchild.ID} {
+		if _, err := GetTodoFromDB(id); err != sql.ErrNoRows {
+			t.Errorf("任务 %s 应该被删除，实际错误为 %v", id, err)
+		}
+	}
+}
+
+func TestOrderTodosByParent(t *testing.T) {
+	todos := []Todo{
+		{ID: "c", ParentID: "b"},
+		{ID: "b", ParentID: "a"},
+		{ID: "x", ParentID: "y"},
+		{ID: "a"},
+		{ID: "y", ParentID: "x"},
+	}
+	ordered := orderTodosByParent(todos)
+	if len(ordered) != len(todos) {
+		t.Fatalf("排序后任务数量不正确: %d", len(ordered))
+	}
+	position := make(map[string]int)
+	for i, todo := range ordered {
+		position[todo.ID] = i
+	}
+	if !(position["a"] < position["b"] && position["b"] < position["c"]) {
+		t.Errorf("父任务应该排在子任务之前: %v", position)
+	}
+}
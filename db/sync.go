@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"sort"
 	"time"
@@ -12,13 +13,25 @@ type SyncRequest struct {
 	DeviceID   string    `json:"device_id"`
 	LastSyncAt time.Time `json:"last_sync_at"`
 	Todos      []Todo    `json:"todos"`
+	Projects   []Project `json:"projects,omitempty"`
+	Tags       []Tag     `json:"tags,omitempty"`
+
+	SavedFilters []SavedFilter `json:"saved_filters,omitempty"`
+	TimeEntries  []TimeEntry   `json:"time_entries,omitempty"`
 }
 
 // SyncResponse 同步响应结构
 type SyncResponse struct {
-	LastSyncAt time.Time `json:"last_sync_at"`
-	Todos      []Todo    `json:"todos"`
+	LastSyncAt time.Time  `json:"last_sync_at"`
+	Todos      []Todo     `json:"todos"`
 	Conflicts  []Conflict `json:"conflicts,omitempty"`
+	Lists      []List     `json:"lists,omitempty"`       // 用户所在的共享清单
+	Projects   []Project  `json:"projects,omitempty"`    // 自上次同步以来变更的项目（包含已删除的项目）
+	Tags       []Tag      `json:"tags,omitempty"`        // 自上次同步以来变更的标签（包含已删除、已合并的标签）
+	RemovedIDs []string   `json:"removed_ids,omitempty"` // 用户已无权访问或已彻底删除、客户端应删除的任务ID
+
+	SavedFilters []SavedFilter `json:"saved_filters,omitempty"` // 自上次同步以来变更的过滤条件（包含已删除的过滤条件）
+	TimeEntries  []TimeEntry   `json:"time_entries,omitempty"`  // 自上次同步以来变更的计时记录（包含已删除的记录和正在运行的计时器）
 }
 
 // Conflict 冲突信息结构
@@ -64,15 +77,26 @@ func (s *SyncService) SyncData(req *SyncRequest) (*SyncResponse, error) {
 		return nil, fmt.Errorf("设备ID不能为空")
 	}
 
-	// 更新设备最后活跃时间
-	device, err := GetDeviceFromDB(req.DeviceID)
+	// 更新设备最后活跃时间（设备信息在内存中维护）
+	err := UpdateDeviceLastSeen(req.DeviceID)
 	if err != nil {
-		return nil, fmt.Errorf("获取设备信息失败: %v", err)
+		return nil, fmt.Errorf("更新设备信息失败: %v", err)
 	}
-	device.LastSeen = time.Now()
-	err = SaveDeviceToDB(device)
+
+	// 先处理项目和标签，保证任务引用的新项目和新标签已经存在
+	err = applyClientProjects(req.UserID, req.Projects)
 	if err != nil {
-		return nil, fmt.Errorf("更新设备信息失败: %v", err)
+		return nil, fmt.Errorf("处理客户端项目失败: %v", err)
+	}
+
+	err = applyClientTags(req.UserID, req.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("处理客户端标签失败: %v", err)
+	}
+
+	err = applyClientSavedFilters(req.UserID, req.SavedFilters)
+	if err != nil {
+		return nil, fmt.Errorf("处理客户端过滤条件失败: %v", err)
 	}
 
 	// 获取服务器端自上次同步以来的更新
@@ -87,16 +111,72 @@ func (s *SyncService) SyncData(req *SyncRequest) (*SyncResponse, error) {
 		return nil, fmt.Errorf("处理客户端更新失败: %v", err)
 	}
 
+	// 计时记录引用的任务可能是本次同步新建的，在任务之后处理
+	err = applyClientTimeEntries(req.UserID, req.DeviceID, req.TimeEntries)
+	if err != nil {
+		return nil, fmt.Errorf("处理客户端计时记录失败: %v", err)
+	}
+
 	// 获取最新的服务器端数据
 	latestTodos, err := GetTodosUpdatedAfterFromDB(req.UserID, req.LastSyncAt)
 	if err != nil {
 		return nil, fmt.Errorf("获取最新数据失败: %v", err)
 	}
 
+	// 获取变更的项目
+	projects, err := GetProjectsUpdatedAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取项目更新失败: %v", err)
+	}
+
+	// 获取变更的标签
+	tags, err := GetTagsUpdatedAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取标签更新失败: %v", err)
+	}
+
+	// 获取变更的过滤条件
+	savedFilters, err := GetSavedFiltersUpdatedAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取过滤条件更新失败: %v", err)
+	}
+
+	// 获取变更的计时记录
+	timeEntries, err := GetTimeEntriesUpdatedAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取计时记录更新失败: %v", err)
+	}
+
+	// 获取用户所在的共享清单
+	lists, err := GetUserListsFromDB(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("获取共享清单失败: %v", err)
+	}
+
+	// 获取用户已失去访问权限的任务（取消分配、被移出共享清单或清单被删除）
+	removedIDs, err := GetRevokedTodoIDsAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取已移除任务失败: %v", err)
+	}
+
+	// 获取彻底删除的任务
+	purgedIDs, err := GetPurgedTodoIDsAfterFromDB(req.UserID, req.LastSyncAt)
+	if err != nil {
+		return nil, fmt.Errorf("获取已删除任务失败: %v", err)
+	}
+	removedIDs = uniqueStrings(append(removedIDs, purgedIDs...))
+
 	// 构建响应
 	response := &SyncResponse{
 		LastSyncAt: time.Now(),
 		Todos:      latestTodos,
+		Lists:      lists,
+		Projects:   projects,
+		Tags:       tags,
+		RemovedIDs: removedIDs,
+
+		SavedFilters: savedFilters,
+		TimeEntries:  timeEntries,
 	}
 
 	// 如果有冲突，添加到响应中
@@ -117,11 +197,24 @@ func (s *SyncService) processClientUpdates(userID, deviceID string, clientTodos,
 
 	var conflicts []Conflict
 
-	// 处理每个客户端任务
-	for _, clientTodo := range clientTodos {
-		// 确保任务属于当前用户
-		clientTodo.UserID = userID
-		clientTodo.DeviceID = deviceID
+	// 处理每个客户端任务，父任务先于子任务处理
+	for _, clientTodo := range orderTodosByParent(clientTodos) {
+		// 已彻底删除的任务不再重新创建，客户端会通过removed_ids删除本地副本
+		purged, err := IsTodoPurged(clientTodo.ID)
+		if err != nil {
+			return nil, err
+		}
+		if purged {
+			continue
+		}
+
+		// 保存前的任务，用于判断重复任务是否刚刚完成
+		previous, _ := GetTodoFromDB(clientTodo.ID)
+
+		// 检查权限并确定任务归属
+		if err := prepareClientTodo(userID, deviceID, &clientTodo); err != nil {
+			return nil, err
+		}
 
 		// 检查服务器端是否有相同ID的任务
 		if serverTodo, exists := serverTodoMap[clientTodo.ID]; exists {
@@ -143,6 +236,9 @@ func (s *SyncService) processClientUpdates(userID, deviceID string, clientTodos,
 					if err != nil {
 						return nil, err
 					}
+					if err := onTodoSaved(userID, previous, &resolvedTodo); err != nil {
+						return nil, err
+					}
 				}
 			} else {
 				// 没有冲突，直接更新服务器数据
@@ -151,6 +247,9 @@ func (s *SyncService) processClientUpdates(userID, deviceID string, clientTodos,
 				if err != nil {
 					return nil, err
 				}
+				if err := onTodoSaved(userID, previous, &clientTodo); err != nil {
+					return nil, err
+				}
 			}
 		} else {
 			// 新任务，直接保存
@@ -162,16 +261,119 @@ func (s *SyncService) processClientUpdates(userID, deviceID string, clientTodos,
 			if err != nil {
 				return nil, err
 			}
+			if err := onTodoSaved(userID, previous, &clientTodo); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return conflicts, nil
 }
 
+// prepareClientTodo 检查客户端提交任务的修改权限并确定任务归属
+// 已存在的任务保留原创建者和负责人，新任务归属当前用户
+// 负责人只能通过分配接口修改，避免旧客户端同步时清空
+func prepareClientTodo(userID, deviceID string, todo *Todo) error {
+	// 修改前的任务，新任务为nil
+	var previous *Todo
+	existing, err := GetTodoFromDB(todo.ID)
+	switch {
+	case err == nil:
+		previous = existing
+		if !CanEditTodo(userID, existing) {
+			return fmt.Errorf("无权修改任务 %s", todo.ID)
+		}
+		// 移动任务需要对原任务有完全控制权限
+		if todo.ListID != existing.ListID && !CanDeleteTodo(userID, existing) {
+			return fmt.Errorf("无权移动任务 %s", todo.ID)
+		}
+		todo.UserID = existing.UserID
+		todo.AssigneeID = existing.AssigneeID
+		// 旧客户端不传标签时保留服务器上的标签
+		if todo.TagIDs == nil {
+			todo.TagIDs = existing.TagIDs
+		}
+		// 旧客户端不传自定义字段时保留服务器上的值
+		if todo.CustomFields == nil {
+			todo.CustomFields = existing.CustomFields
+		}
+		// 归档和回收站状态只能通过对应的接口修改，避免客户端同步时覆盖
+		todo.ArchivedAt = existing.ArchivedAt
+		todo.DeletedAt = existing.DeletedAt
+		// 重复序列信息由服务器维护
+		if todo.SeriesID == "" {
+			todo.SeriesID = existing.SeriesID
+			todo.OccurrenceIndex = existing.OccurrenceIndex
+		}
+	case err == sql.ErrNoRows:
+		todo.UserID = userID
+		todo.AssigneeID = ""
+		todo.ArchivedAt = nil
+		todo.DeletedAt = nil
+		existing = &Todo{UserID: userID}
+	default:
+		return err
+	}
+
+	if todo.ListID != existing.ListID {
+		// 检查目标清单的编辑权限
+		if todo.ListID != "" && !HasListRole(todo.ListID, userID, ListRoleEditor) {
+			return fmt.Errorf("无权在清单中修改任务 %s", todo.ID)
+		}
+		// 只有创建者可以把任务移出共享清单
+		if todo.ListID == "" && todo.UserID != userID {
+			return fmt.Errorf("无权将任务 %s 移出共享清单", todo.ID)
+		}
+	}
+
+	// 确定任务所属项目和标签
+	if err := ApplyTodoProject(userID, todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoTags(userID, todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+
+	// 父任务可能在之后的同步中才到达，暂时保留父任务ID
+	if err := ApplyTodoParent(userID, todo); err != nil && !IsParentNotFound(err) {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoDeadline(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoPriority(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoEstimate(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoCustomFields(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	if err := ApplyTodoRecurrence(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	// 旧客户端不传状态时按完成标记确定状态
+	if err := ApplyTodoStatus(previous, todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+	// 旧客户端不传排序位置时保留服务器上的位置，移动到其他清单、项目或父任务时排到最后
+	if todo.Position == "" && SamePositionScope(existing, todo) {
+		todo.Position = existing.Position
+	}
+	// 其他设备同时移动到相同位置时，后到达的任务排在后面
+	if err := ApplyTodoPosition(todo); err != nil {
+		return fmt.Errorf("任务 %s: %v", todo.ID, err)
+	}
+
+	todo.DeviceID = deviceID
+	return nil
+}
+
 // hasConflict 检测是否存在冲突
 func (s *SyncService) hasConflict(clientTodo, serverTodo Todo) bool {
 	// 如果两个任务的更新时间不同，并且不是同一个设备更新的，则认为存在冲突
-	return !clientTodo.UpdateAt.Equal(serverTodo.UpdateAt) && 
+	return !clientTodo.UpdateAt.Equal(serverTodo.UpdateAt) &&
 		clientTodo.DeviceID != serverTodo.DeviceID
 }
 
@@ -204,31 +406,42 @@ func GetUserTodosWithSync(userID string) ([]Todo, error) {
 
 // BatchUpdateTodos 批量更新任务
 func BatchUpdateTodos(userID, deviceID string, todos []Todo) error {
-	for _, todo := range todos {
-		// 确保任务属于当前用户
-		todo.UserID = userID
-		todo.DeviceID = deviceID
+	for _, todo := range orderTodosByParent(todos) {
+		previous, _ := GetTodoFromDB(todo.ID)
+
+		// 检查权限并确定任务归属
+		if err := prepareClientTodo(userID, deviceID, &todo); err != nil {
+			return err
+		}
 		todo.UpdateAt = time.Now()
 		err := SaveTodoToDB(&todo)
 		if err != nil {
 			return fmt.Errorf("更新任务 %s 失败: %v", todo.ID, err)
 		}
+		if err := onTodoSaved(userID, previous, &todo); err != nil {
+			return fmt.Errorf("生成任务 %s 的下一次重复失败: %v", todo.ID, err)
+		}
 	}
 	return nil
 }
 
-// ResolveConflicts 解决冲突
-func ResolveConflicts(userID string, resolvedTodos []Todo) error {
+// ResolveConflicts 解决冲突，deviceID为发起请求的已认证设备
+func ResolveConflicts(userID, deviceID string, resolvedTodos []Todo) error {
 	for _, todo := range resolvedTodos {
-		// 确保任务属于当前用户
-		if todo.UserID != userID {
-			return fmt.Errorf("无权更新任务 %s", todo.ID)
+		previous, _ := GetTodoFromDB(todo.ID)
+
+		// 检查权限并确定任务归属
+		if err := prepareClientTodo(userID, deviceID, &todo); err != nil {
+			return err
 		}
 		todo.UpdateAt = time.Now()
 		err := SaveTodoToDB(&todo)
 		if err != nil {
 			return fmt.Errorf("更新冲突任务 %s 失败: %v", todo.ID, err)
 		}
+		if err := onTodoSaved(userID, previous, &todo); err != nil {
+			return fmt.Errorf("生成任务 %s 的下一次重复失败: %v", todo.ID, err)
+		}
 	}
 	return nil
 }
@@ -297,12 +510,42 @@ func MergeChanges(localTodos, serverTodos []Todo) []Todo {
 // ValidateSyncData 验证同步数据
 func ValidateSyncData(userID string, todos []Todo) error {
 	for i, todo := range todos {
-		if todo.UserID != "" && todo.UserID != userID {
-			return fmt.Errorf("任务 %d 不属于当前用户", i)
-		}
 		if todo.Name == "" {
 			return fmt.Errorf("任务 %d 的名称不能为空", i)
 		}
+		if _, err := ParsePriority(string(todo.Priority)); err != nil {
+			return fmt.Errorf("任务 %d %v", i, err)
+		}
+
+		// 已存在的任务需要当前用户有修改权限
+		if existing, err := GetTodoFromDB(todo.ID); err == nil {
+			if !CanEditTodo(userID, existing) {
+				return fmt.Errorf("任务 %d 无修改权限", i)
+			}
+			continue
+		}
+
+		if todo.ListID != "" {
+			// 在共享清单中新建任务需要编辑权限
+			if !HasListRole(todo.ListID, userID, ListRoleEditor) {
+				return fmt.Errorf("任务 %d 所在清单无编辑权限", i)
+			}
+		} else if todo.UserID != "" && todo.UserID != userID {
+			return fmt.Errorf("任务 %d 不属于当前用户", i)
+		}
 	}
 	return nil
 }
+
+// 去除重复的字符串，保持原有顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 注册一个测试设备，同步时需要
+func addTestDevice(t *testing.T, userID, deviceID string) {
+	t.Helper()
+
+	devices := Devices
+	Devices = append(append([]Device{}, Devices...), Device{ID: deviceID, UserID: userID, DeviceID: deviceID})
+	t.Cleanup(func() { Devices = devices })
+}
+
+// 执行一次同步并返回需要删除的任务ID
+func syncRemovedIDs(t *testing.T, userID string, since time.Time) []string {
+	t.Helper()
+
+	addTestDevice(t, userID, userID+"-device")
+	resp, err := NewSyncService("").SyncData(&SyncRequest{UserID: userID, DeviceID: userID + "-device", LastSyncAt: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.RemovedIDs
+}
+
+func TestPurgedTodosSyncToUsersWithAccessAtPurgeTime(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleEditor)
+	shared := createTestTodo(t, "owner", list.ID, "共享任务")
+	personal := createTestTodo(t, "owner", "", "个人任务")
+	personal.AssigneeID = "assignee"
+	if err := SaveTodoToDB(personal); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+
+	// 彻底删除个人任务，创建者和负责人都会收到删除通知
+	if _, err := TrashTodo("owner", personal.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := PurgeTodo("owner", personal.ID); err != nil {
+		t.Fatal(err)
+	}
+	// 删除清单后成员已不在清单中，仍然需要收到清单任务的删除通知
+	if err := DeleteList(list.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		userID string
+		want   []string
+		absent []string
+	}{
+		{"owner", []string{shared.ID, personal.ID}, nil},
+		{"member", []string{shared.ID}, []string{personal.ID}},
+		{"assignee", []string{personal.ID}, []string{shared.ID}},
+		{"stranger", nil, []string{shared.ID, personal.ID}},
+	}
+	for _, tt := range tests {
+		purged, err := GetPurgedTodoIDsAfterFromDB(tt.userID, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		removed := syncRemovedIDs(t, tt.userID, before)
+		for _, id := range tt.want {
+			if !containsString(purged, id) || !containsString(removed, id) {
+				t.Errorf("用户 %s 应该收到任务 %s 的删除通知，实际为 %v %v", tt.userID, id, purged, removed)
+			}
+		}
+		for _, id := range tt.absent {
+			if containsString(purged, id) || containsString(removed, id) {
+				t.Errorf("用户 %s 不应该收到任务 %s 的删除通知", tt.userID, id)
+			}
+		}
+	}
+
+	// 已经同步过的删除不再重复通知
+	if purged, err := GetPurgedTodoIDsAfterFromDB("owner", time.Now().Add(time.Second)); err != nil || len(purged) != 0 {
+		t.Errorf("之后的同步不应该再收到删除通知，实际为 %v %v", purged, err)
+	}
+}
+
+func TestPurgedTodosFromFormerMembers(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleEditor)
+	todo := createTestTodo(t, "owner", list.ID, "共享任务")
+	before := time.Now().Add(-time.Second)
+
+	// 被移出清单的成员通过撤销记录删除本地副本，之后的彻底删除不再通知
+	if err := RemoveListMember(list.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TrashTodo("owner", todo.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := PurgeTodo("owner", todo.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := GetPurgedTodoIDsAfterFromDB("member", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(purged, todo.ID) {
+		t.Errorf("移出清单之后删除的任务不应该再通知，实际为 %v", purged)
+	}
+	if removed := syncRemovedIDs(t, "member", before); !containsString(removed, todo.ID) {
+		t.Errorf("被移出清单的成员应该通过撤销记录删除本地副本，实际为 %v", removed)
+	}
+}
+
+func TestMigratePurgedTodoUsers(t *testing.T) {
+	setupTestDB(t)
+
+	list, err := CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestListMember(t, list.ID, "member", ListRoleViewer)
+	before := time.Now().Add(-time.Second)
+
+	// 旧版本只记录了任务的归属
+	_, err = db.Exec(`INSERT INTO purged_todos (todo_id, user_id, list_id, assignee_id, purged_at) VALUES (?, ?, ?, ?, ?)`,
+		"old", "owner", list.ID, "assignee", timeToString(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MigratePurgedTodoUsers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []string{"owner", "member", "assignee"} {
+		purged, err := GetPurgedTodoIDsAfterFromDB(userID, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !containsString(purged, "old") {
+			t.Errorf("迁移后用户 %s 应该收到旧删除记录的通知，实际为 %v", userID, purged)
+		}
+	}
+}
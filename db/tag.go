@@ -0,0 +1,455 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 标签不存在错误
+var errTagNotFound = errors.New("标签不存在")
+
+// 批量查询任务标签时每批的任务数量，避免超过SQLite参数个数限制
+const tagQueryBatchSize = 500
+
+// 标签表的列，与scanTag的顺序保持一致
+const tagColumns = `id, user_id, list_id, name, color, deleted, merged_into, created_at, updated_at`
+
+// 扫描一行标签数据
+func scanTag(scanner rowScanner) (Tag, error) {
+	var tag Tag
+	var deletedInt int
+	var createdAtStr, updatedAtStr string
+
+	err := scanner.Scan(
+		&tag.ID, &tag.UserID, &tag.ListID, &tag.Name, &tag.Color,
+		&deletedInt, &tag.MergedInto, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return tag, err
+	}
+
+	tag.Deleted = intToBool(deletedInt)
+	tag.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return tag, err
+	}
+
+	tag.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return tag, err
+	}
+
+	return tag, nil
+}
+
+// 执行标签查询并扫描所有结果
+func queryTags(query string, args ...interface{}) ([]Tag, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// 保存标签到数据库
+func SaveTagToDB(tag *Tag) error {
+	query := `INSERT OR REPLACE INTO tags (` + tagColumns + `) VALUES (` + placeholders(9) + `)`
+	_, err := db.Exec(query,
+		tag.ID, tag.UserID, tag.ListID, tag.Name, tag.Color,
+		boolToInt(tag.Deleted), tag.MergedInto, timeToString(tag.CreatedAt), timeToString(tag.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID从数据库获取标签（不做权限检查）
+func GetTagFromDB(tagID string) (*Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE id = ?`
+
+	tag, err := scanTag(db.QueryRow(query, tagID))
+	if err == sql.ErrNoRows {
+		return nil, errTagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// 获取用户可访问的所有未删除标签
+func GetUserTagsFromDB(userID string) ([]Tag, error) {
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE deleted = 0 AND ` + accessibleScopedCondition + `
+	ORDER BY name ASC
+	`
+	return queryTags(query, userID, userID)
+}
+
+// 获取某个时间点之后更新的标签（包含已删除的标签，用于同步删除和合并）
+func GetTagsUpdatedAfterFromDB(userID string, timestamp time.Time) ([]Tag, error) {
+	query := `
+	SELECT ` + tagColumns + `
+	FROM tags
+	WHERE ` + accessibleScopedCondition + `
+	  AND (updated_at > ? OR list_id IN (SELECT list_id FROM list_members WHERE user_id = ? AND joined_at > ?))
+	ORDER BY updated_at ASC
+	`
+	ts := timeToString(timestamp)
+	return queryTags(query, userID, userID, ts, userID, ts)
+}
+
+// 检查用户是否可以查看标签
+func CanViewTag(userID string, tag *Tag) bool {
+	if tag.ListID == "" {
+		return tag.UserID == userID
+	}
+	return HasListRole(tag.ListID, userID, ListRoleViewer)
+}
+
+// 检查用户是否可以修改标签
+func CanEditTag(userID string, tag *Tag) bool {
+	if tag.ListID == "" {
+		return tag.UserID == userID
+	}
+	return HasListRole(tag.ListID, userID, ListRoleEditor)
+}
+
+// 检查同一范围内是否已存在同名标签（忽略大小写）
+func tagNameExists(tag *Tag) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+	SELECT COUNT(*) FROM tags
+	WHERE deleted = 0 AND id != ? AND list_id = ? AND (list_id != '' OR user_id = ?) AND LOWER(name) = LOWER(?)
+	`, tag.ID, tag.ListID, tag.UserID, tag.Name).Scan(&count)
+	return count > 0, err
+}
+
+// 创建标签
+func CreateTag(userID string, tag *Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return errors.New("标签名称不能为空")
+	}
+	if tag.ListID != "" && !HasListRole(tag.ListID, userID, ListRoleEditor) {
+		return errors.New("无权在该清单中创建标签")
+	}
+
+	now := time.Now()
+	if tag.ID == "" {
+		tag.ID = generateUUID()
+	}
+	tag.UserID = userID
+	tag.Deleted = false
+	tag.MergedInto = ""
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+
+	exists, err := tagNameExists(tag)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("标签名称已存在")
+	}
+
+	return SaveTagToDB(tag)
+}
+
+// 更新标签（重命名或修改颜色）
+func UpdateTag(userID string, tag *Tag) error {
+	existing, err := GetTagFromDB(tag.ID)
+	if err != nil || existing.Deleted || !CanEditTag(userID, existing) {
+		return errors.New("标签不存在或无权修改")
+	}
+
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return errors.New("标签名称不能为空")
+	}
+
+	tag.UserID = existing.UserID
+	tag.ListID = existing.ListID
+	tag.CreatedAt = existing.CreatedAt
+	tag.UpdatedAt = time.Now()
+
+	exists, err := tagNameExists(tag)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("标签名称已存在，请使用合并功能")
+	}
+
+	return SaveTagToDB(tag)
+}
+
+// 删除标签，同时从所有任务中移除
+func DeleteTag(userID, tagID string) error {
+	tag, err := GetTagFromDB(tagID)
+	if err != nil || tag.Deleted || !CanEditTag(userID, tag) {
+		return errors.New("标签不存在或无权删除")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := timeToString(time.Now())
+
+	// 更新相关任务的时间戳，使其他设备同步到标签的移除
+	_, err = tx.Exec(`UPDATE todos SET updated_at = ? WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ?)`, now, tagID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM todo_tags WHERE tag_id = ?`, tagID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE tags SET deleted = 1, updated_at = ? WHERE id = ?`, now, tagID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 合并标签：源标签的任务全部改用目标标签，源标签标记为已删除
+func MergeTags(userID, sourceID, targetID string) error {
+	if sourceID == targetID {
+		return errors.New("不能将标签合并到自身")
+	}
+
+	source, err := GetTagFromDB(sourceID)
+	if err != nil || source.Deleted || !CanEditTag(userID, source) {
+		return errors.New("源标签不存在或无权修改")
+	}
+	target, err := GetTagFromDB(targetID)
+	if err != nil || target.Deleted || !CanEditTag(userID, target) {
+		return errors.New("目标标签不存在或无权修改")
+	}
+	if source.ListID != target.ListID || (source.ListID == "" && source.UserID != target.UserID) {
+		return errors.New("只能合并同一清单中的标签")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := timeToString(time.Now())
+
+	_, err = tx.Exec(`UPDATE todos SET updated_at = ? WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ?)`, now, sourceID)
+	if err != nil {
+		return err
+	}
+
+	// 已有目标标签的任务直接忽略，避免主键冲突
+	_, err = tx.Exec(`INSERT OR IGNORE INTO todo_tags (todo_id, tag_id) SELECT todo_id, ? FROM todo_tags WHERE tag_id = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM todo_tags WHERE tag_id = ?`, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE tags SET deleted = 1, merged_into = ?, updated_at = ? WHERE id = ?`, targetID, now, sourceID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 批量加载任务的标签ID
+func loadTodoTags(todos []Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(todos))
+	for i := range todos {
+		todos[i].TagIDs = []string{}
+		index[todos[i].ID] = i
+	}
+
+	for start := 0; start < len(todos); start += tagQueryBatchSize {
+		end := start + tagQueryBatchSize
+		if end > len(todos) {
+			end = len(todos)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, todo := range todos[start:end] {
+			args = append(args, todo.ID)
+		}
+
+		rows, err := db.Query(`
+		SELECT tt.todo_id, tt.tag_id
+		FROM todo_tags tt
+		JOIN tags t ON t.id = tt.tag_id
+		WHERE t.deleted = 0 AND tt.todo_id IN (`+placeholders(len(args))+`)
+		ORDER BY t.name ASC
+		`, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var todoID, tagID string
+			if err := rows.Scan(&todoID, &tagID); err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := index[todoID]; ok {
+				todos[i].TagIDs = append(todos[i].TagIDs, tagID)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 替换任务的标签
+func saveTodoTags(todoID string, tagIDs []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceTodoTags(tx, todoID, tagIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 在事务中替换任务的标签
+func replaceTodoTags(tx *sql.Tx, todoID string, tagIDs []string) error {
+	_, err := tx.Exec(`DELETE FROM todo_tags WHERE todo_id = ?`, todoID)
+	if err != nil {
+		return err
+	}
+
+	for _, tagID := range tagIDs {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO todo_tags (todo_id, tag_id) VALUES (?, ?)`, todoID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 校验任务的标签：标签必须存在且与任务属于同一清单，同时去除重复的标签
+func ApplyTodoTags(userID string, todo *Todo) error {
+	if todo.TagIDs == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(todo.TagIDs))
+	tagIDs := make([]string, 0, len(todo.TagIDs))
+	for _, tagID := range todo.TagIDs {
+		if seen[tagID] {
+			continue
+		}
+		seen[tagID] = true
+
+		tag, err := GetTagFromDB(tagID)
+		if err != nil || !CanViewTag(userID, tag) {
+			return fmt.Errorf("标签 %s 不存在或无权访问", tagID)
+		}
+		// 已合并的标签自动替换为最终的目标标签，目标标签本身也可能已被合并
+		duplicate := false
+		for tag.Deleted && tag.MergedInto != "" {
+			// 合并链中的标签已经处理过：要么与前面的标签重复，要么合并关系存在循环
+			if seen[tag.MergedInto] {
+				duplicate = true
+				break
+			}
+			seen[tag.MergedInto] = true
+			tag, err = GetTagFromDB(tag.MergedInto)
+			if err != nil {
+				return err
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if tag.Deleted {
+			return fmt.Errorf("标签 %s 已被删除", tag.Name)
+		}
+		if tag.ListID != todo.ListID || (tag.ListID == "" && tag.UserID != todo.UserID) {
+			return fmt.Errorf("标签 %s 与任务不属于同一清单", tag.Name)
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	todo.TagIDs = tagIDs
+	return nil
+}
+
+// 处理客户端同步的标签，基于更新时间保留最新的版本
+func applyClientTags(userID string, tags []Tag) error {
+	for _, tag := range tags {
+		existing, err := GetTagFromDB(tag.ID)
+		if err != nil && err != errTagNotFound {
+			return err
+		}
+		if err == errTagNotFound {
+			// 新标签
+			if tag.Deleted {
+				continue
+			}
+			if err := CreateTag(userID, &tag); err != nil {
+				return fmt.Errorf("创建标签 %s 失败: %v", tag.Name, err)
+			}
+			continue
+		}
+
+		if !CanEditTag(userID, existing) {
+			return fmt.Errorf("无权修改标签 %s", tag.ID)
+		}
+		// 服务器版本更新或标签已删除时忽略客户端的修改
+		if existing.Deleted || !tag.UpdatedAt.After(existing.UpdatedAt) {
+			continue
+		}
+
+		switch {
+		case tag.Deleted && tag.MergedInto != "":
+			err = MergeTags(userID, tag.ID, tag.MergedInto)
+		case tag.Deleted:
+			err = DeleteTag(userID, tag.ID)
+		default:
+			err = UpdateTag(userID, &tag)
+		}
+		if err != nil {
+			return fmt.Errorf("同步标签 %s 失败: %v", tag.ID, err)
+		}
+	}
+	return nil
+}
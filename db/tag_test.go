@@ -0,0 +1,66 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyTodoTagsFollowsMergeChain(t *testing.T) {
+	setupTestDB(t)
+
+	var tags []*Tag
+	for _, name := range []string{"A", "B", "C"} {
+		tag := &Tag{Name: name}
+		if err := CreateTag("alice", tag); err != nil {
+			t.Fatal(err)
+		}
+		tags = append(tags, tag)
+	}
+	// A合并到B，B再合并到C
+	if err := MergeTags("alice", tags[0].ID, tags[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := MergeTags("alice", tags[1].ID, tags[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	todo := createTestTodo(t, "alice", "", "任务")
+	for _, tagIDs := range [][]string{
+		{tags[0].ID},
+		{tags[0].ID, tags[2].ID, tags[1].ID},
+		{tags[2].ID, tags[0].ID},
+	} {
+		todo.TagIDs = tagIDs
+		if err := ApplyTodoTags("alice", todo); err != nil {
+			t.Fatalf("%v: %v", tagIDs, err)
+		}
+		if !reflect.DeepEqual(todo.TagIDs, []string{tags[2].ID}) {
+			t.Errorf("已合并的标签应该替换为最终的目标标签，实际为 %v", todo.TagIDs)
+		}
+	}
+
+	// 合并关系出现循环时不应该死循环
+	if _, err := db.Exec(`UPDATE tags SET deleted = 1, merged_into = ? WHERE id = ?`, tags[0].ID, tags[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	todo.TagIDs = []string{tags[0].ID}
+	if err := ApplyTodoTags("alice", todo); err != nil {
+		t.Fatal(err)
+	}
+	if len(todo.TagIDs) != 0 {
+		t.Errorf("循环合并的标签不应该被使用，实际为 %v", todo.TagIDs)
+	}
+
+	// 删除而非合并的标签仍然报错
+	other := &Tag{Name: "D"}
+	if err := CreateTag("alice", other); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteTag("alice", other.ID); err != nil {
+		t.Fatal(err)
+	}
+	todo.TagIDs = []string{other.ID}
+	if err := ApplyTodoTags("alice", todo); err == nil {
+		t.Error("已删除的标签应该报错")
+	}
+}
@@ -0,0 +1,515 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 模板不存在错误
+var errTemplateNotFound = errors.New("模板不存在")
+
+// 模板的数量和范围限制
+const (
+	maxTemplateItems      = 200
+	maxTemplateOffsetDays = 3650
+)
+
+// 模板中截止时刻的格式
+const templateDueTimeLayout = "15:04"
+
+// 模板表的列，与scanTemplate的顺序保持一致
+const templateColumns = `id, user_id, list_id, name, description, items, created_at, updated_at`
+
+// 扫描一行模板数据
+func scanTemplate(scanner rowScanner) (Template, error) {
+	var template Template
+	var itemsStr, createdAtStr, updatedAtStr string
+
+	err := scanner.Scan(
+		&template.ID, &template.UserID, &template.ListID, &template.Name, &template.Description,
+		&itemsStr, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return template, err
+	}
+
+	if err := json.Unmarshal([]byte(itemsStr), &template.Items); err != nil {
+		return template, fmt.Errorf("模板 %s 的任务格式错误: %v", template.ID, err)
+	}
+	if template.Items == nil {
+		template.Items = []TemplateItem{}
+	}
+	template.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return template, err
+	}
+	template.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return template, err
+	}
+
+	return template, nil
+}
+
+// 保存模板到数据库
+func saveTemplate(template *Template) error {
+	items, err := json.Marshal(template.Items)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO templates (` + templateColumns + `) VALUES (` + placeholders(8) + `)`
+	_, err = db.Exec(query,
+		template.ID, template.UserID, template.ListID, template.Name, template.Description,
+		string(items), timeToString(template.CreatedAt), timeToString(template.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID从数据库获取模板（不做权限检查）
+func GetTemplateFromDB(templateID string) (*Template, error) {
+	template, err := scanTemplate(db.QueryRow(`SELECT `+templateColumns+` FROM templates WHERE id = ?`, templateID))
+	if err == sql.ErrNoRows {
+		return nil, errTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetUserTemplatesFromDB 获取用户可访问的模板：个人模板和所在共享清单中的模板
+func GetUserTemplatesFromDB(userID string) ([]Template, error) {
+	rows, err := db.Query(`SELECT `+templateColumns+` FROM templates WHERE `+accessibleScopedCondition+` ORDER BY name ASC, created_at ASC`,
+		userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// CanViewTemplate 检查用户是否可以查看和使用模板
+func CanViewTemplate(userID string, template *Template) bool {
+	if template.ListID == "" {
+		return template.UserID == userID
+	}
+	return HasListRole(template.ListID, userID, ListRoleViewer)
+}
+
+// CanEditTemplate 检查用户是否可以修改模板
+func CanEditTemplate(userID string, template *Template) bool {
+	if template.ListID == "" {
+		return template.UserID == userID
+	}
+	return HasListRole(template.ListID, userID, ListRoleEditor)
+}
+
+// 校验并规范化模板：名称不能为空，子任务只能引用排在前面的任务
+func validateTemplate(template *Template) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		return errors.New("模板名称不能为空")
+	}
+	if len(template.Items) == 0 {
+		return errors.New("模板中至少需要一个任务")
+	}
+	if len(template.Items) > maxTemplateItems {
+		return fmt.Errorf("模板最多包含%d个任务", maxTemplateItems)
+	}
+
+	refs := make(map[string]bool)
+	for i := range template.Items {
+		if ref := template.Items[i].Ref; ref != "" {
+			if refs[ref] {
+				return fmt.Errorf("重复的任务标识: %s", ref)
+			}
+			refs[ref] = true
+		}
+	}
+
+	defined := make(map[string]bool)
+	for i := range template.Items {
+		item := &template.Items[i]
+		if item.Ref == "" {
+			for n := i + 1; item.Ref == "" || refs[item.Ref]; n++ {
+				item.Ref = strconv.Itoa(n)
+			}
+			refs[item.Ref] = true
+		}
+
+		item.Name = strings.TrimSpace(item.Name)
+		if item.Name == "" {
+			return fmt.Errorf("第%d个任务的名称不能为空", i+1)
+		}
+		if item.ParentRef != "" && !defined[item.ParentRef] {
+			return fmt.Errorf("任务%s的父任务%s不存在或排在子任务之后", item.Name, item.ParentRef)
+		}
+		defined[item.Ref] = true
+
+		priority, err := ParsePriority(string(item.Priority))
+		if err != nil {
+			return fmt.Errorf("任务%s: %v", item.Name, err)
+		}
+		item.Priority = priority
+
+		if item.DueOffsetDays != nil && (*item.DueOffsetDays > maxTemplateOffsetDays || *item.DueOffsetDays < -maxTemplateOffsetDays) {
+			return fmt.Errorf("任务%s的截止日期不能超过开始日期前后%d天", item.Name, maxTemplateOffsetDays)
+		}
+		if item.DueTime != "" {
+			if item.DueOffsetDays == nil {
+				return fmt.Errorf("任务%s设置截止时刻时需要设置截止日期", item.Name)
+			}
+			if _, err := time.Parse(templateDueTimeLayout, item.DueTime); err != nil {
+				return fmt.Errorf("任务%s的截止时刻无效，格式为15:04", item.Name)
+			}
+		}
+
+		estimate := Todo{Estimate: item.Estimate, EstimateUnit: item.EstimateUnit}
+		if err := ApplyTodoEstimate(&estimate); err != nil {
+			return fmt.Errorf("任务%s: %v", item.Name, err)
+		}
+		item.Estimate, item.EstimateUnit = estimate.Estimate, estimate.EstimateUnit
+
+		var tags []string
+		seen := make(map[string]bool)
+		for _, name := range item.Tags {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			tags = append(tags, name)
+		}
+		item.Tags = tags
+	}
+	return nil
+}
+
+// CreateTemplate 创建模板，在共享清单中创建需要编辑权限
+func CreateTemplate(userID string, template *Template) error {
+	if template.ListID != "" && !HasListRole(template.ListID, userID, ListRoleEditor) {
+		return errors.New("无权在该清单中创建模板")
+	}
+	if err := validateTemplate(template); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template.ID = generateUUID()
+	template.UserID = userID
+	template.CreatedAt = now
+	template.UpdatedAt = now
+	return saveTemplate(template)
+}
+
+// UpdateTemplate 修改模板的名称、说明和任务，所属清单和创建者不能修改
+func UpdateTemplate(userID string, template *Template) error {
+	existing, err := GetTemplateFromDB(template.ID)
+	if err != nil || !CanEditTemplate(userID, existing) {
+		return errors.New("模板不存在或无权修改")
+	}
+	if err := validateTemplate(template); err != nil {
+		return err
+	}
+
+	template.UserID = existing.UserID
+	template.ListID = existing.ListID
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now()
+	return saveTemplate(template)
+}
+
+// DeleteTemplate 删除模板，已经创建的任务不受影响
+func DeleteTemplate(userID, templateID string) error {
+	template, err := GetTemplateFromDB(templateID)
+	if err != nil || !CanEditTemplate(userID, template) {
+		return errors.New("模板不存在或无权删除")
+	}
+	_, err = db.Exec(`DELETE FROM templates WHERE id = ?`, templateID)
+	return err
+}
+
+// 两个日期之间相差的天数，只比较年月日
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// CreateTemplateFromProject 根据项目中的任务创建模板，模板属于项目所在的清单
+// 截止日期保存为相对baseDate的天数，baseDate为零值时使用项目中最早的截止日期
+func CreateTemplateFromProject(userID, projectID, name string, baseDate time.Time) (*Template, error) {
+	project, err := GetProjectFromDB(projectID)
+	if err != nil || project.Deleted || !CanViewProject(userID, project) {
+		return nil, errors.New("项目不存在或无权访问")
+	}
+
+	todos, err := queryTodos(`SELECT `+todoColumns+` FROM todos WHERE project_id = ? AND deleted_at = '' ORDER BY position ASC, created_at ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, errors.New("项目中没有任务")
+	}
+	todos = orderTodosByParent(todos)
+
+	if baseDate.IsZero() {
+		for _, todo := range todos {
+			if !todo.DeadLine.Time.IsZero() && (baseDate.IsZero() || daysBetween(todo.DeadLine.Time, baseDate) > 0) {
+				baseDate = todo.DeadLine.Time
+			}
+		}
+	}
+
+	tagNames := make(map[string]string)
+	refs := make(map[string]string, len(todos))
+	template := &Template{
+		ListID: project.ListID,
+		Name:   name,
+		Items:  make([]TemplateItem, 0, len(todos)),
+	}
+	if strings.TrimSpace(template.Name) == "" {
+		template.Name = project.Name
+	}
+
+	for i, todo := range todos {
+		item := TemplateItem{
+			Ref:          strconv.Itoa(i + 1),
+			ParentRef:    refs[todo.ParentID],
+			Name:         todo.Name,
+			Description:  todo.Description,
+			Priority:     todo.Priority,
+			Estimate:     todo.Estimate,
+			EstimateUnit: todo.EstimateUnit,
+		}
+		refs[todo.ID] = item.Ref
+		if len(todo.CustomFields) > 0 {
+			item.CustomFields = todo.CustomFields
+		}
+
+		if d := todo.DeadLine; !d.Time.IsZero() {
+			offset := daysBetween(baseDate, d.Time)
+			item.DueOffsetDays = &offset
+			if !d.DateOnly {
+				item.DueTime = d.Time.Format(templateDueTimeLayout)
+			}
+		}
+
+		for _, tagID := range todo.TagIDs {
+			name, ok := tagNames[tagID]
+			if !ok {
+				if tag, err := GetTagFromDB(tagID); err == nil && !tag.Deleted {
+					name = tag.Name
+				}
+				tagNames[tagID] = name
+			}
+			if name != "" {
+				item.Tags = append(item.Tags, name)
+			}
+		}
+		template.Items = append(template.Items, item)
+	}
+
+	if err := CreateTemplate(userID, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// InstantiateOptions 实例化模板的参数
+type InstantiateOptions struct {
+	StartDate string // 开始日期（2006-01-02），为空表示今天
+	ProjectID string // 目标项目，指定后任务创建在项目所在的清单中
+	ListID    string // 没有指定项目时的目标清单，为空表示个人任务
+	TimeZone  string // 任务的时区，用于解释开始日期和截止时刻
+}
+
+// 在目标范围中按名称查找标签（忽略大小写），不存在时返回空字符串
+func findTagIDByName(userID, listID, name string) (string, error) {
+	var tagID string
+	err := db.QueryRow(`
+	SELECT id FROM tags
+	WHERE deleted = 0 AND list_id = ? AND (list_id != '' OR user_id = ?) AND LOWER(name) = LOWER(?)
+	ORDER BY created_at ASC
+	LIMIT 1
+	`, listID, userID, name).Scan(&tagID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return tagID, err
+}
+
+// InstantiateTemplate 按模板创建任务，截止日期按开始日期计算
+// 所有任务和缺少的标签在同一个事务中创建，任何一个任务校验失败时不创建任何任务
+func InstantiateTemplate(userID, deviceID, templateID string, opts InstantiateOptions) ([]Todo, error) {
+	template, err := GetTemplateFromDB(templateID)
+	if err != nil || !CanViewTemplate(userID, template) {
+		return nil, errors.New("模板不存在或无权访问")
+	}
+
+	loc, err := locationOf(opts.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now().In(loc)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	if opts.StartDate != "" {
+		start, err = time.ParseInLocation(deadlineDateLayout, opts.StartDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("无效的开始日期: %s", opts.StartDate)
+		}
+	}
+
+	listID := opts.ListID
+	if opts.ProjectID != "" {
+		project, err := GetProjectFromDB(opts.ProjectID)
+		if err != nil || project.Deleted || !CanViewProject(userID, project) {
+			return nil, errors.New("项目不存在或无权访问")
+		}
+		listID = project.ListID
+	}
+	if listID != "" && !HasListRole(listID, userID, ListRoleEditor) {
+		return nil, errors.New("无权在该清单中创建任务")
+	}
+
+	now := time.Now()
+	var newTags []Tag
+	tagIDs := make(map[string]string)
+	ids := make(map[string]string, len(template.Items))
+	positions := make(map[string]string)
+	todos := make([]Todo, 0, len(template.Items))
+
+	for _, item := range template.Items {
+		todo := Todo{
+			ID:           generateUUID(),
+			UserID:       userID,
+			DeviceID:     deviceID,
+			ListID:       listID,
+			ProjectID:    opts.ProjectID,
+			ParentID:     ids[item.ParentRef],
+			Name:         item.Name,
+			Description:  item.Description,
+			CreateAt:     now,
+			UpdateAt:     now,
+			Priority:     item.Priority,
+			TimeZone:     opts.TimeZone,
+			Estimate:     item.Estimate,
+			EstimateUnit: item.EstimateUnit,
+			CustomFields: MergeCustomFieldValues(nil, item.CustomFields),
+			TagIDs:       []string{},
+		}
+		ids[item.Ref] = todo.ID
+
+		if item.DueOffsetDays != nil {
+			due := addDays(start, *item.DueOffsetDays).Format(deadlineDateLayout)
+			if item.DueTime != "" {
+				due += "T" + item.DueTime
+			}
+			if todo.DeadLine, err = ParseDeadline(due, loc); err != nil {
+				return nil, fmt.Errorf("任务%s: %v", item.Name, err)
+			}
+		}
+
+		err = ApplyTodoProject(userID, &todo)
+		if err == nil {
+			err = ApplyTodoDeadline(&todo)
+		}
+		if err == nil {
+			err = ApplyTodoPriority(&todo)
+		}
+		if err == nil {
+			err = ApplyTodoEstimate(&todo)
+		}
+		if err == nil {
+			err = ApplyTodoCustomFields(&todo)
+		}
+		if err == nil {
+			err = ApplyTodoStatus(nil, &todo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("任务%s: %v", item.Name, err)
+		}
+
+		// 顶层任务排在目标范围中已有任务之后，子任务按模板中的顺序排列
+		last, ok := positions[todo.ParentID]
+		if !ok && todo.ParentID == "" {
+			if last, err = lastPosition(&todo); err != nil {
+				return nil, err
+			}
+		}
+		if todo.Position, err = PositionBetween(last, ""); err != nil {
+			return nil, err
+		}
+		positions[todo.ParentID] = todo.Position
+
+		for _, name := range item.Tags {
+			key := strings.ToLower(name)
+			tagID, ok := tagIDs[key]
+			if !ok {
+				if tagID, err = findTagIDByName(userID, listID, name); err != nil {
+					return nil, err
+				}
+				if tagID == "" {
+					tag := Tag{ID: generateUUID(), UserID: userID, ListID: listID, Name: name, CreatedAt: now, UpdatedAt: now}
+					newTags = append(newTags, tag)
+					tagID = tag.ID
+				}
+				tagIDs[key] = tagID
+			}
+			todo.TagIDs = append(todo.TagIDs, tagID)
+		}
+
+		todos = append(todos, todo)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, tag := range newTags {
+		_, err = tx.Exec(`INSERT INTO tags (`+tagColumns+`) VALUES (`+placeholders(9)+`)`,
+			tag.ID, tag.UserID, tag.ListID, tag.Name, tag.Color,
+			boolToInt(tag.Deleted), tag.MergedInto, timeToString(tag.CreatedAt), timeToString(tag.UpdatedAt))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range todos {
+		values := todoValues(&todos[i])
+		_, err = tx.Exec(`INSERT INTO todos (`+todoColumns+`) VALUES (`+placeholders(len(values))+`)`, values...)
+		if err != nil {
+			return nil, err
+		}
+		for _, tagID := range todos[i].TagIDs {
+			_, err = tx.Exec(`INSERT OR IGNORE INTO todo_tags (todo_id, tag_id) VALUES (?, ?)`, todos[i].ID, tagID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := loadSubtaskProgress(todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
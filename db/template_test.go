@@ -0,0 +1,110 @@
+package db
+
+import "testing"
+
+// 创建包含父任务、子任务和标签的模板
+func createTestTemplate(t *testing.T, userID string, names ...string) *Template {
+	t.Helper()
+
+	zero, three := 0, 3
+	template := &Template{Name: "发布流程", Items: []TemplateItem{
+		{Ref: "release", Name: "发布", Tags: []string{"bug", "发布"}, DueOffsetDays: &three, DueTime: "18:00"},
+		{ParentRef: "release", Name: "测试", Tags: []string{"BUG"}, DueOffsetDays: &zero, Priority: "高"},
+	}}
+	for _, name := range names {
+		template.Items = append(template.Items, TemplateItem{ParentRef: "release", Name: name})
+	}
+	if err := CreateTemplate(userID, template); err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+// 统计表中的行数
+func countTestRows(t *testing.T, table string) int {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestInstantiateTemplate(t *testing.T) {
+	setupTestDB(t)
+
+	existing := &Tag{Name: "Bug"}
+	if err := CreateTag("alice", existing); err != nil {
+		t.Fatal(err)
+	}
+	template := createTestTemplate(t, "alice")
+
+	todos, err := InstantiateTemplate("alice", "phone", template.ID, InstantiateOptions{StartDate: "2026-10-19", TimeZone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("应该创建2个任务，实际为 %d", len(todos))
+	}
+	release, test := todos[0], todos[1]
+	if test.ParentID != release.ID || release.SubtaskCount != 1 {
+		t.Errorf("子任务应该属于父任务: %q %d", test.ParentID, release.SubtaskCount)
+	}
+	if release.DeadLine.String() != "2026-10-22T18:00:00" || test.DeadLine.String() != "2026-10-19" {
+		t.Errorf("截止时间应该按开始日期计算，实际为 %s 和 %s", release.DeadLine, test.DeadLine)
+	}
+	if test.Priority != PriorityHigh {
+		t.Errorf("优先级不正确: %q", test.Priority)
+	}
+
+	// 已有的标签忽略大小写复用，缺少的标签只创建一次
+	if len(release.TagIDs) != 2 || release.TagIDs[0] != existing.ID || len(test.TagIDs) != 1 || test.TagIDs[0] != existing.ID {
+		t.Errorf("标签不正确: %v %v", release.TagIDs, test.TagIDs)
+	}
+	if countTestRows(t, "tags") != 2 {
+		t.Errorf("应该只创建一个新标签，实际共有 %d 个标签", countTestRows(t, "tags"))
+	}
+
+	if _, err := InstantiateTemplate("bob", "phone", template.ID, InstantiateOptions{}); err == nil {
+		t.Error("不应该可以使用其他用户的模板")
+	}
+}
+
+func TestInstantiateTemplateIsAtomic(t *testing.T) {
+	setupTestDB(t)
+
+	// 校验失败：目标项目的字段不接受模板中的值
+	project := &Project{Name: "项目", CustomFields: []CustomField{{Key: "points", Name: "点数", Type: FieldNumber}}}
+	if err := CreateProject("alice", project); err != nil {
+		t.Fatal(err)
+	}
+	template := createTestTemplate(t, "alice")
+	template.Items[1].CustomFields = map[string]interface{}{"points": "三"}
+	if err := UpdateTemplate("alice", template); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InstantiateTemplate("alice", "phone", template.ID, InstantiateOptions{ProjectID: project.ID}); err == nil {
+		t.Error("字段值无效时应该报错")
+	}
+
+	// 写入失败：最后一个任务插入时出错
+	_, err := db.Exec(`CREATE TRIGGER fail_todo BEFORE INSERT ON todos WHEN NEW.name = '失败' BEGIN SELECT RAISE(ABORT, '写入失败'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template = createTestTemplate(t, "alice", "失败")
+	if _, err := InstantiateTemplate("alice", "phone", template.ID, InstantiateOptions{}); err == nil {
+		t.Error("写入失败时应该报错")
+	}
+
+	if n := countTestRows(t, "todos"); n != 0 {
+		t.Errorf("失败时不应该创建任何任务，实际创建了 %d 个", n)
+	}
+	if n := countTestRows(t, "tags"); n != 0 {
+		t.Errorf("失败时不应该创建任何标签，实际创建了 %d 个", n)
+	}
+	if n := countTestRows(t, "todo_tags"); n != 0 {
+		t.Errorf("失败时不应该写入任务标签，实际写入了 %d 个", n)
+	}
+}
@@ -0,0 +1,489 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 计时记录不存在错误
+var errTimeEntryNotFound = errors.New("计时记录不存在")
+
+// 计时记录备注的最大长度（字符数）
+const maxTimeEntryNote = 500
+
+// 计时记录表的列，与scanTimeEntry的顺序保持一致
+// 开始和结束时间统一保存为UTC，便于按时间范围比较；stopped_at为空表示计时器正在运行
+const timeEntryColumns = `id, user_id, todo_id, device_id, started_at, stopped_at, duration, note, deleted, created_at, updated_at`
+
+// 可以执行SQL的对象：*sql.DB或*sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// 扫描一行计时记录，正在运行的计时器的时长计算到now
+func scanTimeEntry(scanner rowScanner, now time.Time) (TimeEntry, error) {
+	var entry TimeEntry
+	var startedAtStr, stoppedAtStr, createdAtStr, updatedAtStr string
+	var deletedInt int
+
+	err := scanner.Scan(
+		&entry.ID, &entry.UserID, &entry.TodoID, &entry.DeviceID, &startedAtStr, &stoppedAtStr,
+		&entry.Duration, &entry.Note, &deletedInt, &createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Deleted = intToBool(deletedInt)
+	entry.StartedAt, err = stringToTime(startedAtStr)
+	if err != nil {
+		return entry, err
+	}
+	if stoppedAtStr != "" {
+		stoppedAt, err := stringToTime(stoppedAtStr)
+		if err != nil {
+			return entry, err
+		}
+		entry.StoppedAt = &stoppedAt
+	} else {
+		entry.Running = true
+		entry.Duration = elapsedSeconds(entry.StartedAt, now)
+	}
+	entry.CreatedAt, err = stringToTime(createdAtStr)
+	if err != nil {
+		return entry, err
+	}
+	entry.UpdatedAt, err = stringToTime(updatedAtStr)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
+
+// 两个时间之间的秒数，不会小于0
+func elapsedSeconds(from, to time.Time) int64 {
+	seconds := int64(to.Sub(from).Seconds())
+	if seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// 执行计时记录查询并扫描所有结果
+func queryTimeEntries(query string, args ...interface{}) ([]TimeEntry, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	entries := []TimeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// 保存计时记录，时长根据开始和结束时间计算
+func saveTimeEntry(exec sqlExecer, entry *TimeEntry) error {
+	stoppedAt := ""
+	entry.Running = entry.StoppedAt == nil
+	if entry.Running {
+		entry.Duration = elapsedSeconds(entry.StartedAt, time.Now())
+	} else {
+		stoppedAt = timeToString(entry.StoppedAt.UTC())
+		entry.Duration = elapsedSeconds(entry.StartedAt, *entry.StoppedAt)
+	}
+
+	duration := entry.Duration
+	if entry.Running {
+		duration = 0
+	}
+
+	query := `INSERT OR REPLACE INTO time_entries (` + timeEntryColumns + `) VALUES (` + placeholders(11) + `)`
+	_, err := exec.Exec(query,
+		entry.ID, entry.UserID, entry.TodoID, entry.DeviceID, timeToString(entry.StartedAt.UTC()), stoppedAt,
+		duration, entry.Note, boolToInt(entry.Deleted), timeToString(entry.CreatedAt), timeToString(entry.UpdatedAt),
+	)
+	return err
+}
+
+// 根据ID获取计时记录（不做权限检查）
+func GetTimeEntryFromDB(entryID string) (*TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE id = ?`
+
+	entry, err := scanTimeEntry(db.QueryRow(query, entryID), time.Now())
+	if err == sql.ErrNoRows {
+		return nil, errTimeEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// 获取用户正在运行的计时器，没有时返回nil
+func getRunningTimeEntry(exec sqlExecer, userID, excludeID string) (*TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE user_id = ? AND stopped_at = '' AND deleted = 0 AND id != ?`
+
+	entry, err := scanTimeEntry(exec.QueryRow(query, userID, excludeID), time.Now())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetRunningTimeEntry 获取用户正在运行的计时器，没有时返回nil
+func GetRunningTimeEntry(userID string) (*TimeEntry, error) {
+	return getRunningTimeEntry(db, userID, "")
+}
+
+// 每个用户只能有一个正在运行的计时器：entry正在运行时，与已有的计时器比较开始时间，
+// 先开始的计时器在后开始的计时器开始时停止。返回被停止的其他计时器（没有时为nil）
+func resolveRunningTimer(exec sqlExecer, entry *TimeEntry) (*TimeEntry, error) {
+	if entry.StoppedAt != nil || entry.Deleted {
+		return nil, nil
+	}
+	other, err := getRunningTimeEntry(exec, entry.UserID, entry.ID)
+	if err != nil || other == nil {
+		return nil, err
+	}
+
+	if other.StartedAt.After(entry.StartedAt) {
+		stoppedAt := other.StartedAt
+		entry.StoppedAt = &stoppedAt
+		return nil, nil
+	}
+
+	stoppedAt := entry.StartedAt
+	other.StoppedAt = &stoppedAt
+	other.UpdatedAt = time.Now()
+	if err := saveTimeEntry(exec, other); err != nil {
+		return nil, err
+	}
+	return other, nil
+}
+
+// 校验计时记录：任务需要可以查看，结束时间不能早于开始时间
+func checkTimeEntry(userID string, entry *TimeEntry) error {
+	todo, err := GetTodoFromDB(entry.TodoID)
+	if err != nil || !CanViewTodo(userID, todo) {
+		return errors.New("任务不存在或无权访问")
+	}
+	if entry.StartedAt.IsZero() {
+		return errors.New("开始时间不能为空")
+	}
+	if entry.StartedAt.After(time.Now().Add(time.Minute)) {
+		return errors.New("开始时间不能晚于当前时间")
+	}
+	if entry.StoppedAt != nil && entry.StoppedAt.Before(entry.StartedAt) {
+		return errors.New("结束时间不能早于开始时间")
+	}
+	if len([]rune(entry.Note)) > maxTimeEntryNote {
+		return fmt.Errorf("备注不能超过%d个字符", maxTimeEntryNote)
+	}
+	return nil
+}
+
+// StartTimer 开始为任务计时，正在运行的其他计时器会先停止
+// 返回新的计时器和被停止的计时器（没有时为nil）
+func StartTimer(userID, deviceID, todoID, note string) (*TimeEntry, *TimeEntry, error) {
+	now := time.Now()
+	entry := &TimeEntry{
+		ID:        generateUUID(),
+		UserID:    userID,
+		TodoID:    todoID,
+		DeviceID:  deviceID,
+		StartedAt: now,
+		Note:      note,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := checkTimeEntry(userID, entry); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	stopped, err := resolveRunningTimer(tx, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveTimeEntry(tx, entry); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return entry, stopped, nil
+}
+
+// StopTimer 停止用户正在运行的计时器，note不为nil时同时修改备注
+func StopTimer(userID, deviceID string, note *string) (*TimeEntry, error) {
+	entry, err := GetRunningTimeEntry(userID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errors.New("没有正在运行的计时器")
+	}
+
+	now := time.Now()
+	entry.StoppedAt = &now
+	entry.DeviceID = deviceID
+	entry.UpdatedAt = now
+	if note != nil {
+		entry.Note = *note
+		if len([]rune(entry.Note)) > maxTimeEntryNote {
+			return nil, fmt.Errorf("备注不能超过%d个字符", maxTimeEntryNote)
+		}
+	}
+	if err := saveTimeEntry(db, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// CreateTimeEntry 手动添加计时记录，不传结束时间表示开始一个计时器
+func CreateTimeEntry(userID, deviceID string, entry *TimeEntry) (*TimeEntry, error) {
+	now := time.Now()
+	if entry.ID == "" {
+		entry.ID = generateUUID()
+	}
+	entry.UserID = userID
+	entry.DeviceID = deviceID
+	entry.Deleted = false
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if err := checkTimeEntry(userID, entry); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stopped, err := resolveRunningTimer(tx, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveTimeEntry(tx, entry); err != nil {
+		return nil, err
+	}
+	return stopped, tx.Commit()
+}
+
+// UpdateTimeEntry 修改自己的计时记录的任务、开始和结束时间以及备注
+func UpdateTimeEntry(userID, deviceID string, entry *TimeEntry) (*TimeEntry, error) {
+	existing, err := GetTimeEntryFromDB(entry.ID)
+	if err != nil || existing.Deleted || existing.UserID != userID {
+		return nil, errors.New("计时记录不存在或无权修改")
+	}
+
+	entry.UserID = existing.UserID
+	entry.DeviceID = deviceID
+	entry.Deleted = false
+	entry.CreatedAt = existing.CreatedAt
+	entry.UpdatedAt = time.Now()
+	if err := checkTimeEntry(userID, entry); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stopped, err := resolveRunningTimer(tx, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveTimeEntry(tx, entry); err != nil {
+		return nil, err
+	}
+	return stopped, tx.Commit()
+}
+
+// DeleteTimeEntry 删除自己的计时记录，保留删除标记用于同步
+func DeleteTimeEntry(userID, entryID string) error {
+	entry, err := GetTimeEntryFromDB(entryID)
+	if err != nil || entry.Deleted || entry.UserID != userID {
+		return errors.New("计时记录不存在或无权删除")
+	}
+
+	_, err = db.Exec(`UPDATE time_entries SET deleted = 1, updated_at = ? WHERE id = ?`, timeToString(time.Now()), entryID)
+	return err
+}
+
+// GetTodoTimeEntriesFromDB 获取任务的所有计时记录（包括其他成员的记录），按开始时间倒序
+func GetTodoTimeEntriesFromDB(todoID string) ([]TimeEntry, error) {
+	query := `
+	SELECT ` + timeEntryColumns + `
+	FROM time_entries
+	WHERE todo_id = ? AND deleted = 0
+	ORDER BY started_at DESC
+	`
+	return queryTimeEntries(query, todoID)
+}
+
+// GetUserTimeEntriesFromDB 获取用户在时间范围内开始的计时记录，零值表示不限制
+func GetUserTimeEntriesFromDB(userID string, from, to time.Time) ([]TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE user_id = ? AND deleted = 0`
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		query += ` AND started_at >= ?`
+		args = append(args, timeToString(from.UTC()))
+	}
+	if !to.IsZero() {
+		query += ` AND started_at < ?`
+		args = append(args, timeToString(to.UTC()))
+	}
+	query += ` ORDER BY started_at DESC`
+	return queryTimeEntries(query, args...)
+}
+
+// 获取某个时间点之后更新的计时记录（包含已删除的记录，用于同步删除）
+func GetTimeEntriesUpdatedAfterFromDB(userID string, timestamp time.Time) ([]TimeEntry, error) {
+	query := `
+	SELECT ` + timeEntryColumns + `
+	FROM time_entries
+	WHERE user_id = ? AND updated_at > ?
+	ORDER BY updated_at ASC
+	`
+	return queryTimeEntries(query, userID, timeToString(timestamp))
+}
+
+// TodoTimeTotal 任务的计时合计，单位为秒
+type TodoTimeTotal struct {
+	TodoID  string `json:"todo_id"`
+	Name    string `json:"name"`
+	Seconds int64  `json:"seconds"`
+}
+
+// TimeTotals 计时合计，正在运行的计时器计算到当前时间
+type TimeTotals struct {
+	Seconds int64           `json:"seconds"`
+	Todos   []TodoTimeTotal `json:"todos"`
+}
+
+// GetTimeTotals 按任务合计所有成员的计时，todoID不为空时只统计该任务，否则统计项目中的所有任务
+func GetTimeTotals(userID, todoID, projectID string) (*TimeTotals, error) {
+	var query string
+	var args []interface{}
+	switch {
+	case todoID != "":
+		todo, err := GetTodoFromDB(todoID)
+		if err != nil || !CanViewTodo(userID, todo) {
+			return nil, errors.New("任务不存在或无权查看")
+		}
+		query = `t.id = ?`
+		args = []interface{}{todoID}
+	case projectID != "":
+		project, err := GetProjectFromDB(projectID)
+		if err != nil || project.Deleted || !CanViewProject(userID, project) {
+			return nil, errors.New("项目不存在或无权访问")
+		}
+		query = `t.id IN (SELECT id FROM todos WHERE project_id = ? AND ` + accessibleTodoCondition + `)`
+		args = []interface{}{projectID, userID, userID, userID}
+	default:
+		return nil, errors.New("需要指定任务或项目")
+	}
+
+	rows, err := db.Query(`
+	SELECT t.id, t.name, e.started_at, e.stopped_at, e.duration
+	FROM time_entries e JOIN todos t ON t.id = e.todo_id
+	WHERE e.deleted = 0 AND `+query+`
+	ORDER BY t.position ASC, t.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	totals := &TimeTotals{Todos: []TodoTimeTotal{}}
+	index := make(map[string]int)
+	for rows.Next() {
+		var id, name, startedAtStr, stoppedAtStr string
+		var seconds int64
+		if err := rows.Scan(&id, &name, &startedAtStr, &stoppedAtStr, &seconds); err != nil {
+			return nil, err
+		}
+		if stoppedAtStr == "" {
+			startedAt, err := stringToTime(startedAtStr)
+			if err != nil {
+				return nil, err
+			}
+			seconds = elapsedSeconds(startedAt, now)
+		}
+
+		i, ok := index[id]
+		if !ok {
+			i = len(totals.Todos)
+			index[id] = i
+			totals.Todos = append(totals.Todos, TodoTimeTotal{TodoID: id, Name: name})
+		}
+		totals.Todos[i].Seconds += seconds
+		totals.Seconds += seconds
+	}
+	return totals, rows.Err()
+}
+
+// 处理客户端同步的计时记录，基于更新时间保留最新的版本
+// 不同设备离线时各自开始的计时器，先开始的在后开始的计时器开始时停止
+func applyClientTimeEntries(userID, deviceID string, entries []TimeEntry) error {
+	for _, entry := range entries {
+		existing, err := GetTimeEntryFromDB(entry.ID)
+		if err != nil && err != errTimeEntryNotFound {
+			return err
+		}
+		if err == errTimeEntryNotFound {
+			// 新计时记录
+			if entry.Deleted {
+				continue
+			}
+			if _, err := CreateTimeEntry(userID, deviceID, &entry); err != nil {
+				return fmt.Errorf("创建计时记录 %s 失败: %v", entry.ID, err)
+			}
+			continue
+		}
+
+		if existing.UserID != userID {
+			return fmt.Errorf("无权修改计时记录 %s", entry.ID)
+		}
+		// 服务器版本更新或记录已删除时忽略客户端的修改
+		if existing.Deleted || !entry.UpdatedAt.After(existing.UpdatedAt) {
+			continue
+		}
+
+		if entry.Deleted {
+			err = DeleteTimeEntry(userID, entry.ID)
+		} else {
+			_, err = UpdateTimeEntry(userID, deviceID, &entry)
+		}
+		if err != nil {
+			return fmt.Errorf("同步计时记录 %s 失败: %v", entry.ID, err)
+		}
+	}
+	return nil
+}
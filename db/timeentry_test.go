@@ -0,0 +1,109 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 获取用户所有正在运行的计时器
+func runningTimeEntries(t *testing.T, userID string) []TimeEntry {
+	t.Helper()
+
+	entries, err := queryTimeEntries(`SELECT `+timeEntryColumns+` FROM time_entries WHERE user_id = ? AND stopped_at = '' AND deleted = 0`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestStartTimerStopsRunningTimer(t *testing.T) {
+	setupTestDB(t)
+
+	first := createTestTodo(t, "alice", "", "任务一")
+	second := createTestTodo(t, "alice", "", "任务二")
+
+	entry, stopped, err := StartTimer("alice", "phone", first.ID, "")
+	if err != nil || stopped != nil {
+		t.Fatalf("开始计时失败: %v %v", stopped, err)
+	}
+	next, stopped, err := StartTimer("alice", "laptop", second.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped == nil || stopped.ID != entry.ID || !stopped.StoppedAt.Equal(next.StartedAt) {
+		t.Errorf("开始新的计时器时应该停止之前的计时器，实际为 %+v", stopped)
+	}
+
+	running := runningTimeEntries(t, "alice")
+	if len(running) != 1 || running[0].ID != next.ID {
+		t.Errorf("同时只能有一个正在运行的计时器，实际为 %d 个", len(running))
+	}
+
+	if _, _, err := StartTimer("bob", "phone", first.ID, ""); err == nil {
+		t.Error("不应该可以为无权查看的任务计时")
+	}
+	if _, err := StopTimer("alice", "laptop", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StopTimer("alice", "laptop", nil); err == nil {
+		t.Error("没有正在运行的计时器时停止应该报错")
+	}
+}
+
+func TestApplyClientTimeEntriesResolvesOfflineTimers(t *testing.T) {
+	setupTestDB(t)
+
+	todo := createTestTodo(t, "alice", "", "任务")
+	now := time.Now().Truncate(time.Second)
+
+	// 服务器上已经有一个20分钟前开始的计时器
+	server := &TimeEntry{TodoID: todo.ID, StartedAt: now.Add(-20 * time.Minute)}
+	if _, err := CreateTimeEntry("alice", "laptop", server); err != nil {
+		t.Fatal(err)
+	}
+
+	// 离线设备30分钟前开始的计时器更早，在服务器计时器开始时停止
+	earlier := TimeEntry{ID: generateUUID(), TodoID: todo.ID, StartedAt: now.Add(-30 * time.Minute), UpdatedAt: now}
+	// 另一个离线设备10分钟前开始的计时器更晚，服务器计时器在它开始时停止
+	later := TimeEntry{ID: generateUUID(), TodoID: todo.ID, StartedAt: now.Add(-10 * time.Minute), UpdatedAt: now}
+	if err := applyClientTimeEntries("alice", "phone", []TimeEntry{earlier, later}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(id string, stoppedAt *time.Time) {
+		t.Helper()
+		entry, err := GetTimeEntryFromDB(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case stoppedAt == nil && entry.StoppedAt != nil:
+			t.Errorf("计时器 %s 应该仍在运行，实际在 %v 停止", id, entry.StoppedAt)
+		case stoppedAt != nil && (entry.StoppedAt == nil || !entry.StoppedAt.Equal(*stoppedAt)):
+			t.Errorf("计时器 %s 应该在 %v 停止，实际为 %v", id, stoppedAt, entry.StoppedAt)
+		}
+	}
+	serverStop, earlierStop := later.StartedAt, server.StartedAt
+	check(earlier.ID, &earlierStop)
+	check(server.ID, &serverStop)
+	check(later.ID, nil)
+	if running := runningTimeEntries(t, "alice"); len(running) != 1 {
+		t.Errorf("同步后只能有一个正在运行的计时器，实际为 %d 个", len(running))
+	}
+
+	// 比服务器版本旧的修改被忽略
+	stale := later
+	stale.Note = "旧的修改"
+	stale.UpdatedAt = now.Add(-time.Hour)
+	if err := applyClientTimeEntries("alice", "phone", []TimeEntry{stale}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := GetTimeEntryFromDB(later.ID); err != nil || entry.Note != "" {
+		t.Errorf("旧的修改不应该覆盖服务器版本: %v %v", entry, err)
+	}
+
+	// 不能修改其他用户的计时记录
+	if err := applyClientTimeEntries("bob", "phone", []TimeEntry{later}); err == nil {
+		t.Error("不应该可以同步其他用户的计时记录")
+	}
+}
@@ -0,0 +1,413 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TrashRetentionDays 回收站中的任务保留的天数，超过后自动彻底删除，为0表示不自动删除
+var TrashRetentionDays = 30
+
+// 批量归档时天数的上限
+const maxArchiveDays = 3650
+
+var errTodoInTrash = errors.New("任务在回收站中，请先恢复")
+
+// 任务本身及其所有层级的子任务，使用时需要传入两次任务ID
+const subtreeCondition = `(id = ? OR id IN (` + descendantsQuery + ` SELECT id FROM descendants))`
+
+// 获取任务并检查权限，任务不存在或没有权限时返回同样的错误
+func getTodoWithPermission(userID, todoID string, canModify func(string, *Todo) bool, message string) (*Todo, error) {
+	todo, err := GetTodoFromDB(todoID)
+	if err != nil || !canModify(userID, todo) {
+		return nil, errors.New(message)
+	}
+	return todo, nil
+}
+
+// ArchiveTodo 归档任务，所有层级的子任务一起归档，需要任务的编辑权限
+// 归档的任务不出现在默认的任务列表中，但可以搜索和查看
+func ArchiveTodo(userID, todoID string) (*Todo, error) {
+	todo, err := getTodoWithPermission(userID, todoID, CanEditTodo, "任务不存在或无权修改")
+	if err != nil {
+		return nil, err
+	}
+	if todo.DeletedAt != nil {
+		return nil, errTodoInTrash
+	}
+	if todo.ArchivedAt != nil {
+		return todo, nil
+	}
+
+	now := timeToString(time.Now())
+	_, err = db.Exec(`UPDATE todos SET archived_at = ?, updated_at = ? WHERE archived_at = '' AND deleted_at = '' AND `+subtreeCondition,
+		now, now, todo.ID, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := AddTodoHistory(todo.ID, userID, HistoryArchived, "", ""); err != nil {
+		return nil, err
+	}
+	return GetTodoFromDB(todo.ID)
+}
+
+// UnarchiveTodo 取消归档，与任务同时归档的子任务一起恢复
+func UnarchiveTodo(userID, todoID string) (*Todo, error) {
+	todo, err := getTodoWithPermission(userID, todoID, CanEditTodo, "任务不存在或无权修改")
+	if err != nil {
+		return nil, err
+	}
+	if todo.ArchivedAt == nil {
+		return todo, nil
+	}
+	if todo.ParentID != "" {
+		parent, err := GetTodoFromDB(todo.ParentID)
+		if err == nil && parent.ArchivedAt != nil {
+			return nil, errors.New("父任务已归档，请先取消归档父任务")
+		}
+	}
+
+	archivedAt := timePtrToString(todo.ArchivedAt)
+	now := timeToString(time.Now())
+	_, err = db.Exec(`UPDATE todos SET archived_at = '', updated_at = ? WHERE archived_at = ? AND `+subtreeCondition,
+		now, archivedAt, todo.ID, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := AddTodoHistory(todo.ID, userID, HistoryUnarchived, "", ""); err != nil {
+		return nil, err
+	}
+	return GetTodoFromDB(todo.ID)
+}
+
+// ArchiveOptions 批量归档的条件
+type ArchiveOptions struct {
+	OlderThanDays int    // 完成超过多少天的任务
+	ProjectID     string // 只归档项目中的任务
+	ListID        string // 只归档清单中的任务
+}
+
+// ArchiveCompletedTodos 归档完成时间早于指定天数的任务（没有完成记录的旧任务按更新时间计算）
+// 只处理用户有编辑权限的任务，子任务一起归档，返回归档的任务数量
+func ArchiveCompletedTodos(userID string, opts ArchiveOptions) (int, error) {
+	if opts.OlderThanDays < 0 || opts.OlderThanDays > maxArchiveDays {
+		return 0, fmt.Errorf("天数需要在0到%d之间", maxArchiveDays)
+	}
+
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, -opts.OlderThanDays)
+	query := `
+	SELECT ` + todoColumns + ` FROM todos
+	WHERE ` + accessibleTodoCondition + ` AND completed = 1 AND archived_at = '' AND deleted_at = ''
+	  AND COALESCE((SELECT MAX(h.created_at) FROM todo_history h WHERE h.todo_id = todos.id AND h.action = ?), updated_at) < ?`
+	args := []interface{}{userID, userID, userID, HistoryCompleted, timeToString(cutoff)}
+	if opts.ProjectID != "" {
+		query += ` AND project_id = ?`
+		args = append(args, opts.ProjectID)
+	}
+	if opts.ListID != "" {
+		query += ` AND list_id = ?`
+		args = append(args, opts.ListID)
+	}
+	todos, err := queryTodos(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var archived []string
+	count := 0
+	nowStr := timeToString(now)
+	for i := range todos {
+		if !CanEditTodo(userID, &todos[i]) {
+			continue
+		}
+		result, err := tx.Exec(`UPDATE todos SET archived_at = ?, updated_at = ? WHERE archived_at = '' AND deleted_at = '' AND `+subtreeCondition,
+			nowStr, nowStr, todos[i].ID, todos[i].ID)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		// 作为其他任务的子任务已经归档时不重复记录
+		if affected > 0 {
+			count += int(affected)
+			archived = append(archived, todos[i].ID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, todoID := range archived {
+		if err := AddTodoHistory(todoID, userID, HistoryArchived, "", ""); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// TrashTodo 将任务移入回收站，需要删除任务的权限
+// cascade为true时所有层级的子任务一起移入回收站，否则子任务移动到上一级
+func TrashTodo(userID, todoID string, cascade bool) (*Todo, error) {
+	todo, err := getTodoWithPermission(userID, todoID, CanDeleteTodo, "任务不存在或无权删除")
+	if err != nil {
+		return nil, err
+	}
+	if todo.DeletedAt != nil {
+		return todo, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := trashTodo(tx, todo, cascade, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := AddTodoHistory(todo.ID, userID, HistoryTrashed, "", ""); err != nil {
+		return nil, err
+	}
+	return GetTodoFromDB(todo.ID)
+}
+
+// 在事务中将任务移入回收站（权限检查由调用方负责）
+func trashTodo(tx *sql.Tx, todo *Todo, cascade bool, now time.Time) error {
+	nowStr := timeToString(now)
+	if cascade {
+		_, err := tx.Exec(`UPDATE todos SET deleted_at = ?, updated_at = ? WHERE deleted_at = '' AND `+subtreeCondition,
+			nowStr, nowStr, todo.ID, todo.ID)
+		return err
+	}
+	_, err := tx.Exec(`UPDATE todos SET parent_id = ?, updated_at = ? WHERE parent_id = ?`, todo.ParentID, nowStr, todo.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE todos SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at = ''`, nowStr, nowStr, todo.ID)
+	return err
+}
+
+// RestoreTodo 从回收站恢复任务，与任务同时移入回收站的子任务一起恢复
+// 父任务已删除或仍在回收站中时恢复为顶层任务
+func RestoreTodo(userID, todoID string) (*Todo, error) {
+	todo, err := getTodoWithPermission(userID, todoID, CanDeleteTodo, "任务不存在或无权恢复")
+	if err != nil {
+		return nil, err
+	}
+	if todo.DeletedAt == nil {
+		return todo, nil
+	}
+
+	if todo.ParentID != "" {
+		parent, err := GetTodoFromDB(todo.ParentID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == sql.ErrNoRows || parent.DeletedAt != nil {
+			todo.ParentID = ""
+			todo.Position = ""
+			if err := ApplyTodoPosition(todo); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := timeToString(time.Now())
+	_, err = tx.Exec(`UPDATE todos SET deleted_at = '', updated_at = ? WHERE deleted_at = ? AND `+subtreeCondition,
+		now, timePtrToString(todo.DeletedAt), todo.ID, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE todos SET parent_id = ?, position = ? WHERE id = ?`, todo.ParentID, todo.Position, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := AddTodoHistory(todo.ID, userID, HistoryRestored, "", ""); err != nil {
+		return nil, err
+	}
+	return GetTodoFromDB(todo.ID)
+}
+
+// PurgeTodo 彻底删除回收站中的任务及其子任务
+func PurgeTodo(userID, todoID string) error {
+	todo, err := getTodoWithPermission(userID, todoID, CanDeleteTodo, "任务不存在或无权删除")
+	if err != nil {
+		return err
+	}
+	if todo.DeletedAt == nil {
+		return errors.New("只能彻底删除回收站中的任务")
+	}
+	return DeleteTodo(todo, true)
+}
+
+// GetTrashFromDB 获取用户可访问的回收站中的任务，最近删除的在前
+func GetTrashFromDB(userID string) ([]Todo, error) {
+	query := `
+	SELECT ` + todoColumns + `
+	FROM todos
+	WHERE deleted_at != '' AND ` + accessibleTodoCondition + `
+	ORDER BY deleted_at DESC, id ASC
+	`
+	todos, err := queryTodos(query, userID, userID, userID)
+	if todos == nil {
+		todos = []Todo{}
+	}
+	return todos, err
+}
+
+// EmptyTrash 彻底删除回收站中用户有删除权限的所有任务，返回删除的任务数量（不包括子任务）
+func EmptyTrash(userID string) (int, error) {
+	todos, err := GetTrashFromDB(userID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for i := range todos {
+		if CanDeleteTodo(userID, &todos[i]) {
+			ids = append(ids, todos[i].ID)
+		}
+	}
+	return purgeTodos(ids)
+}
+
+// PurgeExpiredTrash 彻底删除在回收站中超过保留天数的任务，返回删除的任务数量（不包括子任务）
+func PurgeExpiredTrash(now time.Time) (int, error) {
+	if TrashRetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := now.AddDate(0, 0, -TrashRetentionDays)
+	rows, err := db.Query(`SELECT id FROM todos WHERE deleted_at != '' AND deleted_at < ? ORDER BY deleted_at ASC`, timeToString(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
+	return purgeTodos(ids)
+}
+
+// 依次彻底删除任务，已经作为其他任务的子任务删除的跳过
+func purgeTodos(ids []string) (int, error) {
+	count := 0
+	for _, id := range ids {
+		todo, err := GetTodoFromDB(id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := DeleteTodo(todo, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 记录彻底删除的任务，同时记录删除时可以访问任务的用户（创建者、负责人和清单成员），
+// 同步时只通知这些用户，之后被移出清单或清单被删除也不影响
+func recordPurgedTodos(tx *sql.Tx, in string, ids []interface{}) error {
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO purged_todos (todo_id, user_id, list_id, assignee_id, purged_at)
+	SELECT id, user_id, list_id, assignee_id, ? FROM todos WHERE id IN (`+in+`)
+	`, append([]interface{}{timeToString(time.Now())}, ids...)...)
+	if err != nil {
+		return err
+	}
+
+	args := append(append(append([]interface{}{}, ids...), ids...), ids...)
+	_, err = tx.Exec(`
+	INSERT OR IGNORE INTO purged_todo_users (todo_id, user_id)
+	SELECT id, user_id FROM todos WHERE id IN (`+in+`)
+	UNION
+	SELECT id, assignee_id FROM todos WHERE assignee_id != '' AND id IN (`+in+`)
+	UNION
+	SELECT t.id, m.user_id FROM todos t JOIN list_members m ON m.list_id = t.list_id
+	WHERE t.list_id != '' AND t.id IN (`+in+`)
+	`, args...)
+	return err
+}
+
+// MigratePurgedTodoUsers 为旧版本没有记录通知用户的彻底删除记录补充用户，清单成员按当前成员计算
+func MigratePurgedTodoUsers() error {
+	_, err := db.Exec(`
+	INSERT OR IGNORE INTO purged_todo_users (todo_id, user_id)
+	SELECT p.todo_id, p.user_id FROM purged_todos p
+	WHERE p.todo_id NOT IN (SELECT todo_id FROM purged_todo_users)
+	UNION
+	SELECT p.todo_id, p.assignee_id FROM purged_todos p
+	WHERE p.assignee_id != '' AND p.todo_id NOT IN (SELECT todo_id FROM purged_todo_users)
+	UNION
+	SELECT p.todo_id, m.user_id FROM purged_todos p JOIN list_members m ON m.list_id = p.list_id
+	WHERE p.list_id != '' AND p.todo_id NOT IN (SELECT todo_id FROM purged_todo_users)
+	`)
+	return err
+}
+
+// IsTodoPurged 判断任务是否已被彻底删除
+func IsTodoPurged(todoID string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM purged_todos WHERE todo_id = ?`, todoID).Scan(&count)
+	return count > 0, err
+}
+
+// GetPurgedTodoIDsAfterFromDB 获取某个时间点之后彻底删除的、删除时用户可以访问的任务ID
+// 客户端同步时据此删除本地副本
+func GetPurgedTodoIDsAfterFromDB(userID string, timestamp time.Time) ([]string, error) {
+	rows, err := db.Query(`
+	SELECT p.todo_id FROM purged_todos p
+	JOIN purged_todo_users u ON u.todo_id = p.todo_id
+	WHERE u.user_id = ? AND p.purged_at > ?
+	`, userID, timeToString(timestamp))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
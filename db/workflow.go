@@ -0,0 +1,407 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 默认工作流的状态，没有配置工作流的项目和不属于项目的任务使用
+const (
+	StatusTodo = "todo"
+	StatusDone = "done"
+)
+
+// 工作流最多包含的状态数量
+const maxWorkflowStatuses = 20
+
+// 看板每列默认返回的任务数量
+const DefaultBoardColumnSize = 50
+
+// 状态的标识：小写字母开头，只包含小写字母、数字和下划线
+var statusKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// WorkflowStatus 工作流中的一个状态，Terminal为true表示处于该状态的任务已完成
+type WorkflowStatus struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Terminal bool   `json:"terminal,omitempty"`
+}
+
+// Workflow 项目的看板工作流，状态按看板列的顺序排列，第一个未完成状态为新任务的初始状态
+// Transitions为每个状态允许变更到的状态，为空表示可以在任意状态之间变更
+type Workflow struct {
+	Statuses    []WorkflowStatus    `json:"statuses"`
+	Transitions map[string][]string `json:"transitions,omitempty"`
+}
+
+// DefaultWorkflow 默认工作流：待办和已完成，可以任意变更
+func DefaultWorkflow() *Workflow {
+	return &Workflow{
+		Statuses: []WorkflowStatus{
+			{Key: StatusTodo, Name: "待办"},
+			{Key: StatusDone, Name: "已完成", Terminal: true},
+		},
+	}
+}
+
+// Status 按标识查找状态
+func (wf *Workflow) Status(key string) (WorkflowStatus, bool) {
+	for _, status := range wf.Statuses {
+		if status.Key == key {
+			return status, true
+		}
+	}
+	return WorkflowStatus{}, false
+}
+
+// IsTerminal 状态是否表示任务已完成
+func (wf *Workflow) IsTerminal(key string) bool {
+	status, _ := wf.Status(key)
+	return status.Terminal
+}
+
+// 状态的显示名称，状态不存在时返回标识
+func (wf *Workflow) statusName(key string) string {
+	if status, ok := wf.Status(key); ok {
+		return status.Name
+	}
+	return key
+}
+
+// CanTransition 是否允许从from变更到to，不在工作流中的旧状态可以变更到任意状态
+func (wf *Workflow) CanTransition(from, to string) bool {
+	if from == to || len(wf.Transitions) == 0 {
+		return true
+	}
+	if _, ok := wf.Status(from); !ok {
+		return true
+	}
+	for _, target := range wf.Transitions[from] {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 按完成状态选择状态：优先选择可以从from变更到的第一个状态，没有时选择第一个完成状态相同的状态
+func (wf *Workflow) completionStatus(from string, completed bool) string {
+	fallback := ""
+	for _, status := range wf.Statuses {
+		if status.Terminal != completed {
+			continue
+		}
+		if from == "" || wf.CanTransition(from, status.Key) {
+			return status.Key
+		}
+		if fallback == "" {
+			fallback = status.Key
+		}
+	}
+	return fallback
+}
+
+// 校验并规范化工作流：状态标识不能重复，至少包含一个未完成状态和一个完成状态
+func (wf *Workflow) validate() error {
+	if len(wf.Statuses) > maxWorkflowStatuses {
+		return fmt.Errorf("工作流最多包含%d个状态", maxWorkflowStatuses)
+	}
+
+	seen := make(map[string]bool)
+	hasOpen, hasTerminal := false, false
+	for i := range wf.Statuses {
+		status := &wf.Statuses[i]
+		status.Key = strings.TrimSpace(status.Key)
+		status.Name = strings.TrimSpace(status.Name)
+		if !statusKeyPattern.MatchString(status.Key) {
+			return fmt.Errorf("无效的状态标识: %s（只能包含小写字母、数字和下划线）", status.Key)
+		}
+		if seen[status.Key] {
+			return fmt.Errorf("状态标识重复: %s", status.Key)
+		}
+		seen[status.Key] = true
+		if status.Name == "" {
+			status.Name = status.Key
+		}
+		if status.Terminal {
+			hasTerminal = true
+		} else {
+			hasOpen = true
+		}
+	}
+	if !hasOpen || !hasTerminal {
+		return errors.New("工作流至少需要一个未完成状态和一个完成状态")
+	}
+
+	for from, targets := range wf.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("状态变更规则中的状态不存在: %s", from)
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return fmt.Errorf("状态变更规则中的状态不存在: %s", to)
+			}
+		}
+	}
+	return nil
+}
+
+// 工作流保存到数据库的内容，默认工作流保存为空字符串
+func workflowToString(wf *Workflow) (string, error) {
+	if wf == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(wf)
+	return string(data), err
+}
+
+// 从数据库读取工作流，空字符串表示使用默认工作流
+func stringToWorkflow(s string) (*Workflow, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var wf Workflow
+	if err := json.Unmarshal([]byte(s), &wf); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// EffectiveWorkflow 项目实际使用的工作流
+func (p *Project) EffectiveWorkflow() *Workflow {
+	if p.Workflow == nil {
+		return DefaultWorkflow()
+	}
+	return p.Workflow
+}
+
+// 校验项目的工作流，空工作流表示恢复默认工作流
+func applyProjectWorkflow(project *Project) error {
+	if project.Workflow == nil {
+		return nil
+	}
+	if len(project.Workflow.Statuses) == 0 {
+		project.Workflow = nil
+		return nil
+	}
+	return project.Workflow.validate()
+}
+
+// 任务所属项目的工作流
+func workflowForTodo(todo *Todo) (*Workflow, error) {
+	if todo.ProjectID == "" {
+		return DefaultWorkflow(), nil
+	}
+	project, err := GetProjectFromDB(todo.ProjectID)
+	if err == errProjectNotFound {
+		return DefaultWorkflow(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return project.EffectiveWorkflow(), nil
+}
+
+// ApplyTodoStatus 校验任务状态并根据状态确定完成状态，previous为修改前的任务（新任务为nil）
+// 不传状态的旧客户端修改完成状态时，自动变更到对应的未完成或完成状态
+// 移动到其他项目时按完成状态映射到新项目的工作流，不检查状态变更规则
+func ApplyTodoStatus(previous, todo *Todo) error {
+	wf, err := workflowForTodo(todo)
+	if err != nil {
+		return err
+	}
+
+	from := ""
+	if previous != nil && previous.ProjectID == todo.ProjectID {
+		from = previous.Status
+	}
+
+	if todo.Status == "" && previous != nil {
+		todo.Status = previous.Status
+	}
+	switch {
+	case previous != nil && todo.Status == previous.Status:
+		if _, ok := wf.Status(todo.Status); !ok || wf.IsTerminal(todo.Status) != todo.Completed {
+			todo.Status = wf.completionStatus(from, todo.Completed)
+		}
+	case todo.Status == "":
+		todo.Status = wf.completionStatus("", todo.Completed)
+	default:
+		if _, ok := wf.Status(todo.Status); !ok {
+			return fmt.Errorf("无效的任务状态: %s", todo.Status)
+		}
+	}
+
+	if from != "" && !wf.CanTransition(from, todo.Status) {
+		return fmt.Errorf("不允许将任务从%s变更为%s", wf.statusName(from), wf.statusName(todo.Status))
+	}
+	todo.Completed = wf.IsTerminal(todo.Status)
+	return nil
+}
+
+// RecordStatusChange 记录任务的状态变更，用于计算周期时间
+func RecordStatusChange(userID string, previous, todo *Todo) error {
+	if previous == nil || previous.Status == "" || previous.Status == todo.Status {
+		return nil
+	}
+	return AddTodoHistory(todo.ID, userID, HistoryStatusChanged, previous.Status, todo.Status)
+}
+
+// ChangeTodoStatus 变更任务状态（权限检查由调用方负责），完成重复任务时生成下一次任务
+func ChangeTodoStatus(userID string, todo *Todo, status string) error {
+	previous := *todo
+	todo.Status = status
+	if err := ApplyTodoStatus(&previous, todo); err != nil {
+		return err
+	}
+	if todo.Status == previous.Status {
+		return nil
+	}
+
+	todo.UpdateAt = time.Now()
+	if err := SaveTodoToDB(todo); err != nil {
+		return err
+	}
+	return onTodoSaved(userID, &previous, todo)
+}
+
+// 工作流变更后，不在新工作流中的状态按完成状态映射到初始状态或第一个完成状态，
+// 完成标记按新工作流重新计算
+func remapProjectStatuses(project *Project) error {
+	wf := project.EffectiveWorkflow()
+	var keys, terminal []interface{}
+	for _, status := range wf.Statuses {
+		keys = append(keys, status.Key)
+		if status.Terminal {
+			terminal = append(terminal, status.Key)
+		}
+	}
+	now := timeToString(project.UpdatedAt)
+
+	args := []interface{}{wf.completionStatus("", true), wf.completionStatus("", false), now, project.ID}
+	_, err := db.Exec(`
+	UPDATE todos SET status = CASE WHEN completed = 1 THEN ? ELSE ? END, updated_at = ?
+	WHERE project_id = ? AND status NOT IN (`+placeholders(len(keys))+`)`, append(args, keys...)...)
+	if err != nil {
+		return err
+	}
+
+	isTerminal := `CASE WHEN status IN (` + placeholders(len(terminal)) + `) THEN 1 ELSE 0 END`
+	args = append(append([]interface{}{}, terminal...), now, project.ID)
+	args = append(args, terminal...)
+	_, err = db.Exec(`
+	UPDATE todos SET completed = `+isTerminal+`, updated_at = ?
+	WHERE project_id = ? AND completed != `+isTerminal, args...)
+	return err
+}
+
+// BoardColumn 看板中的一列，NextCursor可以用于在任务列表接口中按该状态继续加载
+type BoardColumn struct {
+	Status     WorkflowStatus `json:"status"`
+	Todos      []Todo         `json:"todos"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// GetProjectBoard 按项目工作流的状态分组列出任务，每列默认按手动顺序排列
+func GetProjectBoard(userID, projectID string, query TodoQuery) (*Project, []BoardColumn, error) {
+	project, err := GetProjectFromDB(projectID)
+	if err != nil || project.Deleted || !CanViewProject(userID, project) {
+		return nil, nil, errors.New("项目不存在或无权访问")
+	}
+
+	query.ProjectID = project.ID
+	query.Cursor = ""
+	if query.Sort == "" {
+		query.Sort = "position"
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultBoardColumnSize
+	}
+
+	columns := []BoardColumn{}
+	for _, status := range project.EffectiveWorkflow().Statuses {
+		query.Statuses = []string{status.Key}
+		page, err := QueryTodosFromDB(userID, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		todos := page.Todos
+		if todos == nil {
+			todos = []Todo{}
+		}
+		columns = append(columns, BoardColumn{Status: status, Todos: todos, NextCursor: page.NextCursor})
+	}
+	return project, columns, nil
+}
+
+// CycleTime 任务的状态变更记录和周期时间，时间单位为秒
+// 周期时间从第一次离开初始状态开始，到最后一次进入完成状态结束；前置时间从创建开始
+// 任务未完成或没有状态变更记录（例如直接创建为完成状态的任务）时无法计算，Available为false，CycleTime和LeadTime为null
+type CycleTime struct {
+	Transitions  []TodoHistory    `json:"transitions"`
+	TimeInStatus map[string]int64 `json:"time_in_status"`
+	StartedAt    *time.Time       `json:"started_at,omitempty"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+	Available    bool             `json:"available"`
+	CycleTime    *int64           `json:"cycle_time"`
+	LeadTime     *int64           `json:"lead_time"`
+}
+
+// GetTodoCycleTime 根据状态变更记录计算任务在各状态停留的时间和周期时间
+func GetTodoCycleTime(todo *Todo, now time.Time) (*CycleTime, error) {
+	history, err := GetTodoHistoryFromDB(todo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CycleTime{Transitions: []TodoHistory{}, TimeInStatus: make(map[string]int64)}
+	for _, record := range history {
+		if record.Action == HistoryStatusChanged {
+			result.Transitions = append(result.Transitions, record)
+		}
+	}
+
+	// 初始状态为第一次变更前的状态，没有变更记录时为当前状态
+	initial := todo.Status
+	if len(result.Transitions) > 0 {
+		initial = result.Transitions[0].OldValue
+	}
+	current, since := initial, todo.CreateAt
+	for _, transition := range result.Transitions {
+		result.TimeInStatus[current] += int64(transition.CreatedAt.Sub(since).Seconds())
+		if result.StartedAt == nil && transition.OldValue == initial && transition.NewValue != initial {
+			startedAt := transition.CreatedAt
+			result.StartedAt = &startedAt
+		}
+		current, since = transition.NewValue, transition.CreatedAt
+	}
+
+	if !todo.Completed {
+		result.TimeInStatus[current] += int64(now.Sub(since).Seconds())
+		return result, nil
+	}
+
+	// 最后一次变更必须是进入当前的完成状态，否则无法确定完成时间
+	if result.StartedAt == nil || current != todo.Status {
+		return result, nil
+	}
+	completedAt := result.Transitions[len(result.Transitions)-1].CreatedAt
+	cycleTime := int64(completedAt.Sub(*result.StartedAt).Seconds())
+	leadTime := int64(completedAt.Sub(todo.CreateAt).Seconds())
+	result.CompletedAt = &completedAt
+	result.Available = true
+	result.CycleTime = &cycleTime
+	result.LeadTime = &leadTime
+	return result, nil
+}
+
+// MigrateStatuses 根据旧版本的完成标记设置任务状态
+func MigrateStatuses() error {
+	_, err := db.Exec(`UPDATE todos SET status = CASE WHEN completed = 1 THEN ? ELSE ? END WHERE status = ''`,
+		StatusDone, StatusTodo)
+	return err
+}
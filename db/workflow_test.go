@@ -0,0 +1,255 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// 创建一个使用待办、进行中、审核和完成四个状态的项目
+func createTestWorkflowProject(t *testing.T, userID string) *Project {
+	t.Helper()
+
+	project := &Project{Name: "看板", Workflow: &Workflow{Statuses: []WorkflowStatus{
+		{Key: "todo", Name: "待办"},
+		{Key: "doing", Name: "进行中"},
+		{Key: "review", Name: "审核"},
+		{Key: "done", Name: "已完成", Terminal: true},
+	}}}
+	if err := CreateProject(userID, project); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+// 直接写入一条指定时间的状态变更记录
+func addTestStatusChange(t *testing.T, todoID, from, to string, at time.Time) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO todo_history (id, todo_id, user_id, action, old_value, new_value, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		generateUUID(), todoID, "user", HistoryStatusChanged, from, to, timeToString(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestProjectTodo(t *testing.T, projectID, name, status string, createdAt time.Time) *Todo {
+	t.Helper()
+
+	todo := &Todo{ID: generateUUID(), UserID: "user", ProjectID: projectID, Name: name, Status: status, CreateAt: createdAt, UpdateAt: createdAt}
+	if err := ApplyTodoStatus(nil, todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyTodoPosition(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestGetTodoCycleTime(t *testing.T) {
+	setupTestDB(t)
+	project := createTestWorkflowProject(t, "user")
+	created := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+
+	todo := createTestProjectTodo(t, project.ID, "任务", "done", created)
+	addTestStatusChange(t, todo.ID, "todo", "doing", created.Add(time.Hour))
+	addTestStatusChange(t, todo.ID, "doing", "review", created.Add(3*time.Hour))
+	// 同一秒内的两次变更按写入顺序计算
+	addTestStatusChange(t, todo.ID, "review", "todo", created.Add(4*time.Hour))
+	addTestStatusChange(t, todo.ID, "todo", "doing", created.Add(4*time.Hour))
+	addTestStatusChange(t, todo.ID, "doing", "done", created.Add(6*time.Hour))
+
+	result, err := GetTodoCycleTime(todo, created.Add(10*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Transitions) != 5 || !result.Available {
+		t.Fatalf("应该有5次状态变更并可以计算周期时间，实际为 %+v", result)
+	}
+	if !result.StartedAt.Equal(created.Add(time.Hour)) || !result.CompletedAt.Equal(created.Add(6*time.Hour)) {
+		t.Errorf("开始时间应该是第一次离开初始状态的时间，实际为 %v 到 %v", result.StartedAt, result.CompletedAt)
+	}
+	if *result.CycleTime != 5*3600 || *result.LeadTime != 6*3600 {
+		t.Errorf("周期时间应该为5小时，前置时间为6小时，实际为 %d %d", *result.CycleTime, *result.LeadTime)
+	}
+	want := map[string]int64{"todo": 3600, "doing": 4 * 3600, "review": 3600}
+	for status, seconds := range want {
+		if result.TimeInStatus[status] != seconds {
+			t.Errorf("在%s状态停留 %d 秒，期望 %d 秒", status, result.TimeInStatus[status], seconds)
+		}
+	}
+}
+
+func TestGetTodoCycleTimeNotAvailable(t *testing.T) {
+	setupTestDB(t)
+	project := createTestWorkflowProject(t, "user")
+	created := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	now := created.Add(2 * time.Hour)
+
+	// 直接创建为完成状态的任务没有状态变更记录
+	done := createTestProjectTodo(t, project.ID, "已完成", "done", created)
+	result, err := GetTodoCycleTime(done, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available || result.CycleTime != nil || result.LeadTime != nil || result.StartedAt != nil {
+		t.Errorf("没有状态变更记录的完成任务不能计算周期时间，实际为 %+v", result)
+	}
+
+	// 未完成的任务统计到当前时间为止的停留时间
+	open := createTestProjectTodo(t, project.ID, "进行中", "todo", created)
+	addTestStatusChange(t, open.ID, "todo", "doing", created.Add(time.Hour))
+	open.Status = "doing"
+	result, err = GetTodoCycleTime(open, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available || result.StartedAt == nil || result.TimeInStatus["doing"] != 3600 {
+		t.Errorf("未完成的任务只有开始时间和停留时间，实际为 %+v", result)
+	}
+
+	// 工作流变更时直接映射的状态没有变更记录，无法确定完成时间
+	remapped := createTestProjectTodo(t, project.ID, "映射", "todo", created)
+	addTestStatusChange(t, remapped.ID, "todo", "doing", created.Add(time.Hour))
+	remapped.Status, remapped.Completed = "done", true
+	result, err = GetTodoCycleTime(remapped, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available {
+		t.Errorf("最后一次变更不是进入完成状态时不能计算周期时间，实际为 %+v", result)
+	}
+}
+
+func TestRemapProjectStatuses(t *testing.T) {
+	setupTestDB(t)
+	project := createTestWorkflowProject(t, "user")
+	now := time.Now()
+	doing := createTestProjectTodo(t, project.ID, "进行中", "doing", now)
+	review := createTestProjectTodo(t, project.ID, "审核", "review", now)
+	done := createTestProjectTodo(t, project.ID, "已完成", "done", now)
+
+	// 删除进行中状态，审核改为完成状态，已完成改名为closed
+	project.Workflow = &Workflow{Statuses: []WorkflowStatus{
+		{Key: "backlog", Name: "待规划"},
+		{Key: "todo", Name: "待办"},
+		{Key: "review", Name: "审核", Terminal: true},
+		{Key: "closed", Name: "关闭", Terminal: true},
+	}}
+	if err := UpdateProject("user", project); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		todo      *Todo
+		status    string
+		completed bool
+	}{
+		{doing, "backlog", false},
+		{review, "review", true},
+		{done, "review", true},
+	}
+	for _, tt := range tests {
+		todo, err := GetTodoFromDB(tt.todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if todo.Status != tt.status || todo.Completed != tt.completed {
+			t.Errorf("任务 %s 应该映射为 %s（完成 %v），实际为 %s（完成 %v）", todo.Name, tt.status, tt.completed, todo.Status, todo.Completed)
+		}
+	}
+}
+
+func TestApplyTodoStatus(t *testing.T) {
+	setupTestDB(t)
+	project := createTestWorkflowProject(t, "user")
+	project.Workflow.Transitions = map[string][]string{"todo": {"doing"}, "doing": {"review", "todo"}, "review": {"done", "doing"}}
+	if err := UpdateProject("user", project); err != nil {
+		t.Fatal(err)
+	}
+
+	todo := createTestProjectTodo(t, project.ID, "任务", "", time.Now())
+	if todo.Status != "todo" || todo.Completed {
+		t.Fatalf("新任务应该处于初始状态，实际为 %s", todo.Status)
+	}
+
+	previous := *todo
+	todo.Status = "done"
+	if err := ApplyTodoStatus(&previous, todo); err == nil {
+		t.Error("不应该允许跳过工作流中的状态")
+	}
+
+	// 旧客户端只修改完成标记时选择可以变更到的状态，这里没有可以直接变更到的完成状态
+	todo.Status, todo.Completed = "", true
+	if err := ApplyTodoStatus(&previous, todo); err == nil {
+		t.Error("没有可以变更到的完成状态时应该返回错误")
+	}
+
+	// 移动到没有工作流的任务时按完成状态映射到默认工作流
+	todo.Status, todo.Completed, todo.ProjectID = "doing", false, ""
+	previous.Status = "doing"
+	if err := ApplyTodoStatus(&previous, todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Status != StatusTodo || todo.Completed {
+		t.Errorf("移出项目后应该映射为默认工作流的待办状态，实际为 %s", todo.Status)
+	}
+}
+
+func TestGetProjectBoard(t *testing.T) {
+	setupTestDB(t)
+	project := createTestWorkflowProject(t, "user")
+	now := time.Now()
+	first := createTestProjectTodo(t, project.ID, "a", "doing", now)
+	createTestProjectTodo(t, project.ID, "b", "todo", now)
+	second := createTestProjectTodo(t, project.ID, "c", "doing", now)
+	createTestProjectTodo(t, project.ID, "d", "done", now)
+	createTestProjectTodo(t, "", "e", "todo", now)
+
+	if err := MoveTodo(second, "", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, columns, err := GetProjectBoard("user", project.ID, TodoQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"b"}, {"c", "a"}, {}, {"d"}}
+	if len(columns) != len(want) {
+		t.Fatalf("看板应该有%d列，实际为 %d 列", len(want), len(columns))
+	}
+	for i, column := range columns {
+		if column.Status.Key != project.Workflow.Statuses[i].Key {
+			t.Errorf("第%d列应该是 %s，实际为 %s", i+1, project.Workflow.Statuses[i].Key, column.Status.Key)
+		}
+		var names []string
+		for _, todo := range column.Todos {
+			names = append(names, todo.Name)
+		}
+		if len(names) != len(want[i]) {
+			t.Errorf("%s列的任务为 %v，期望 %v", column.Status.Key, names, want[i])
+			continue
+		}
+		for j := range names {
+			if names[j] != want[i][j] {
+				t.Errorf("%s列的任务为 %v，期望 %v", column.Status.Key, names, want[i])
+				break
+			}
+		}
+	}
+
+	// 每列的数量限制和继续加载的游标
+	_, columns, err = GetProjectBoard("user", project.ID, TodoQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns[1].Todos) != 1 || columns[1].NextCursor == "" || columns[0].NextCursor != "" {
+		t.Errorf("超过每列数量的状态应该返回游标，实际为 %+v", columns[1])
+	}
+
+	if _, _, err := GetProjectBoard("other", project.ID, TodoQuery{}); err == nil {
+		t.Error("无权访问的项目不应该返回看板")
+	}
+}
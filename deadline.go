@@ -0,0 +1,54 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 获取逾期、今天到期或本周到期的任务
+// when参数为overdue、today或week，tz参数为计算今天和本周使用的IANA时区，默认使用服务器时区
+func handleGetDueTodos(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	loc := time.Local
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的时区: " + tz})
+			return
+		}
+	}
+
+	when := r.URL.Query().Get("when")
+	if when == "" {
+		when = db.DueOverdue
+	}
+
+	todos, err := db.GetDueTodosFromDB(userID, when, loc)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if todos == nil {
+		todos = []db.Todo{}
+	}
+
+	log.Printf("获取用户 %s 的到期任务(%s)，共 %d 个", userID, when, len(todos))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todos":   todos,
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// 依赖接口的请求数据：TodoID被BlockerID阻塞
+type dependencyRequest struct {
+	TodoID    string `json:"todo_id"`
+	BlockerID string `json:"blocker_id"`
+}
+
+// 添加任务依赖
+func handleAddDependency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var depData dependencyRequest
+	err := json.NewDecoder(r.Body).Decode(&depData)
+	if err != nil || depData.TodoID == "" || depData.BlockerID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.AddTodoDependency(userID, depData.TodoID, depData.BlockerID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 添加依赖: 任务 %s 被 %s 阻塞", userID, depData.TodoID, depData.BlockerID)
+
+	todo, _ := db.GetTodoFromDB(depData.TodoID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 删除任务依赖
+func handleRemoveDependency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var depData dependencyRequest
+	err := json.NewDecoder(r.Body).Decode(&depData)
+	if err != nil || depData.TodoID == "" || depData.BlockerID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.RemoveTodoDependency(userID, depData.TodoID, depData.BlockerID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除依赖: 任务 %s 不再被 %s 阻塞", userID, depData.TodoID, depData.BlockerID)
+
+	todo, _ := db.GetTodoFromDB(depData.TodoID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 获取任务的前置任务和被它阻塞的任务
+func handleGetDependencies(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	todoID := r.URL.Query().Get("id")
+
+	todo, err := db.GetTodoFromDB(todoID)
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	blockers, dependents, err := db.GetTodoDependencies(userID, todoID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取任务依赖失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"blocked":    todo.Blocked,
+		"blockers":   blockers,
+		"dependents": dependents,
+	})
+}
+
+// 获取项目的依赖图和拓扑顺序
+func handleGetProjectDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	graph, err := db.GetProjectDependencyGraph(userID, r.URL.Query().Get("project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todos":   graph.Todos,
+		"edges":   graph.Edges,
+		"order":   graph.Order,
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 获取用户保存的过滤条件
+func handleGetSavedFilters(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	filters, err := db.GetUserSavedFiltersFromDB(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取过滤条件失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"filters": filters,
+	})
+}
+
+// 保存过滤条件
+func handleCreateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var filterData struct {
+		Name      string              `json:"name"`
+		Icon      string              `json:"icon"`
+		Query     db.SavedFilterQuery `json:"query"`
+		SortOrder int                 `json:"sort_order"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&filterData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	filter := db.SavedFilter{
+		Name:      filterData.Name,
+		Icon:      filterData.Icon,
+		Query:     filterData.Query,
+		SortOrder: filterData.SortOrder,
+	}
+
+	err = db.CreateSavedFilter(userID, &filter)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	log.Printf("用户 %s 保存过滤条件: %s", userID, filter.Name)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"filter":  filter,
+	})
+}
+
+// 更新过滤条件
+func handleUpdateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var filter db.SavedFilter
+	err := json.NewDecoder(r.Body).Decode(&filter)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.UpdateSavedFilter(userID, &filter)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	log.Printf("用户 %s 更新过滤条件: %s", userID, filter.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"filter":  filter,
+	})
+}
+
+// 删除过滤条件
+func handleDeleteSavedFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var deleteData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&deleteData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteSavedFilter(userID, deleteData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除过滤条件: %s", userID, deleteData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// 执行保存的过滤条件，返回符合条件的任务
+// tz参数可以临时代替过滤条件中保存的时区，limit和cursor用于分页
+func handleEvaluateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	params := r.URL.Query()
+
+	var loc *time.Location
+	if tz := params.Get("tz"); tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的时区: " + tz})
+			return
+		}
+	}
+
+	limit := 0
+	if value := params.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的每页数量: " + value})
+			return
+		}
+	}
+
+	page, err := db.EvaluateSavedFilter(userID, params.Get("id"), loc, params.Get("cursor"), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"todos":       page.Todos,
+		"next_cursor": page.NextCursor,
+	})
+}
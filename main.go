@@ -2,11 +2,14 @@ package main
 
 import (
 	"TodoLists/db"
+	"TodoLists/notify"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +22,24 @@ func main() {
 		log.Fatal("数据库初始化失败:", err)
 	}
 	defer db.CloseDatabase()
+	loadAdminFromEnv()
+
+	// 启动提醒调度器
+	scheduler := notify.NewScheduler(nil, 30*time.Second)
+	scheduler.Register(db.ChannelFeed, notify.FeedNotifier{})
+	scheduler.Register(db.ChannelWebhook, notify.NewWebhookNotifier())
+	if smtpNotifier := notify.NewSMTPNotifierFromEnv(); smtpNotifier != nil {
+		scheduler.Register(db.ChannelEmail, smtpNotifier)
+	}
+	if err := scheduler.Start(); err != nil {
+		log.Fatal("启动提醒调度器失败:", err)
+	}
+	defer scheduler.Stop()
+
+	// 启动回收站自动清理
+	loadTrashRetentionFromEnv()
+	stopTrashPurger := startTrashPurger(trashPurgeInterval)
+	defer stopTrashPurger()
 
 	// 添加静态文件服务，将static文件夹映射到根路径
 	fs := http.FileServer(http.Dir("./static"))
@@ -45,8 +66,131 @@ func main() {
 	// 同步相关路由
 	http.HandleFunc("/api/sync", authMiddleware(syncData))
 	http.HandleFunc("/api/todos/batch", authMiddleware(batchUpdateTodos))
+	http.HandleFunc("/api/todos/bulk", authMiddleware(handleBulkTodos))
 	http.HandleFunc("/api/conflicts/resolve", authMiddleware(resolveConflicts))
 
+	// 提醒和通知相关路由
+	http.HandleFunc("/api/reminders", authMiddleware(handleGetReminders))
+	http.HandleFunc("/api/reminders/create", authMiddleware(handleCreateReminder))
+	http.HandleFunc("/api/reminders/delete", authMiddleware(handleDeleteReminder))
+	http.HandleFunc("/api/reminders/snooze", authMiddleware(handleSnoozeReminder))
+	http.HandleFunc("/api/notifications", authMiddleware(handleGetNotifications))
+	http.HandleFunc("/api/notifications/read", authMiddleware(handleReadNotifications))
+
+	// 搜索相关路由
+	http.HandleFunc("/api/search", authMiddleware(handleSearchTodos))
+
+	// 保存的过滤条件相关路由
+	http.HandleFunc("/api/filters", authMiddleware(handleGetSavedFilters))
+	http.HandleFunc("/api/filters/create", authMiddleware(handleCreateSavedFilter))
+	http.HandleFunc("/api/filters/update", authMiddleware(handleUpdateSavedFilter))
+	http.HandleFunc("/api/filters/delete", authMiddleware(handleDeleteSavedFilter))
+	http.HandleFunc("/api/filters/evaluate", authMiddleware(handleEvaluateSavedFilter))
+
+	// 截止时间相关路由
+	http.HandleFunc("/api/todos/due", authMiddleware(handleGetDueTodos))
+
+	// 重复任务相关路由
+	http.HandleFunc("/api/todos/recurrence/skip", authMiddleware(handleSkipOccurrence))
+	http.HandleFunc("/api/todos/recurrence/update", authMiddleware(handleUpdateFutureOccurrences))
+
+	// 手动排序相关路由
+	http.HandleFunc("/api/todos/move", authMiddleware(handleMoveTodo))
+
+	// 标签相关路由
+	http.HandleFunc("/api/tags", authMiddleware(handleGetTags))
+	http.HandleFunc("/api/tags/create", authMiddleware(handleCreateTag))
+	http.HandleFunc("/api/tags/update", authMiddleware(handleUpdateTag))
+	http.HandleFunc("/api/tags/delete", authMiddleware(handleDeleteTag))
+	http.HandleFunc("/api/tags/merge", authMiddleware(handleMergeTags))
+
+	// 任务分配相关路由
+	http.HandleFunc("/api/todos/assign", authMiddleware(handleAssignTodo))
+	http.HandleFunc("/api/todos/unassign", authMiddleware(handleUnassignTodo))
+	http.HandleFunc("/api/todos/history", authMiddleware(handleGetTodoHistory))
+
+	// 附件相关路由
+	http.HandleFunc("/api/todos/attachments", authMiddleware(handleGetAttachments))
+	http.HandleFunc("/api/todos/attachments/upload", authMiddleware(handleUploadAttachment))
+	http.HandleFunc("/api/todos/attachments/download", authMiddleware(handleDownloadAttachment))
+	http.HandleFunc("/api/todos/attachments/delete", authMiddleware(handleDeleteAttachment))
+	http.HandleFunc("/api/user/storage", authMiddleware(handleGetStorageUsage))
+
+	// 评论和活动记录相关路由
+	http.HandleFunc("/api/todos/comments", authMiddleware(handleGetComments))
+	http.HandleFunc("/api/todos/comments/create", authMiddleware(handleCreateComment))
+	http.HandleFunc("/api/todos/comments/update", authMiddleware(handleUpdateComment))
+	http.HandleFunc("/api/todos/comments/delete", authMiddleware(handleDeleteComment))
+	http.HandleFunc("/api/todos/activity", authMiddleware(handleGetTodoActivity))
+
+	// 项目相关路由
+	http.HandleFunc("/api/projects", authMiddleware(handleGetProjects))
+	http.HandleFunc("/api/projects/create", authMiddleware(handleCreateProject))
+	http.HandleFunc("/api/projects/update", authMiddleware(handleUpdateProject))
+	http.HandleFunc("/api/projects/delete", authMiddleware(handleDeleteProject))
+
+	// 看板工作流相关路由
+	http.HandleFunc("/api/projects/board", authMiddleware(handleGetProjectBoard))
+	http.HandleFunc("/api/todos/status", authMiddleware(handleChangeTodoStatus))
+	http.HandleFunc("/api/todos/cycle-time", authMiddleware(handleGetTodoCycleTime))
+
+	// 任务依赖相关路由
+	http.HandleFunc("/api/todos/dependencies", authMiddleware(handleGetDependencies))
+	http.HandleFunc("/api/todos/dependencies/add", authMiddleware(handleAddDependency))
+	http.HandleFunc("/api/todos/dependencies/remove", authMiddleware(handleRemoveDependency))
+	http.HandleFunc("/api/projects/dependencies", authMiddleware(handleGetProjectDependencyGraph))
+
+	// 任务模板相关路由
+	http.HandleFunc("/api/templates", authMiddleware(handleGetTemplates))
+	http.HandleFunc("/api/templates/create", authMiddleware(handleCreateTemplate))
+	http.HandleFunc("/api/templates/update", authMiddleware(handleUpdateTemplate))
+	http.HandleFunc("/api/templates/delete", authMiddleware(handleDeleteTemplate))
+	http.HandleFunc("/api/templates/from-project", authMiddleware(handleCreateTemplateFromProject))
+	http.HandleFunc("/api/templates/instantiate", authMiddleware(handleInstantiateTemplate))
+
+	// 归档和回收站相关路由
+	http.HandleFunc("/api/todos/archive", authMiddleware(handleArchiveTodo))
+	http.HandleFunc("/api/todos/unarchive", authMiddleware(handleUnarchiveTodo))
+	http.HandleFunc("/api/todos/archive-completed", authMiddleware(handleArchiveCompletedTodos))
+	http.HandleFunc("/api/trash", authMiddleware(handleGetTrash))
+	http.HandleFunc("/api/trash/restore", authMiddleware(handleRestoreTodo))
+	http.HandleFunc("/api/trash/delete", authMiddleware(handlePurgeTodo))
+	http.HandleFunc("/api/trash/empty", authMiddleware(handleEmptyTrash))
+
+	// 计时相关路由
+	http.HandleFunc("/api/time/start", authMiddleware(handleStartTimer))
+	http.HandleFunc("/api/time/stop", authMiddleware(handleStopTimer))
+	http.HandleFunc("/api/time/running", authMiddleware(handleGetRunningTimer))
+	http.HandleFunc("/api/time/entries", authMiddleware(handleGetTimeEntries))
+	http.HandleFunc("/api/time/entries/create", authMiddleware(handleCreateTimeEntry))
+	http.HandleFunc("/api/time/entries/update", authMiddleware(handleUpdateTimeEntry))
+	http.HandleFunc("/api/time/entries/delete", authMiddleware(handleDeleteTimeEntry))
+	http.HandleFunc("/api/time/totals", authMiddleware(handleGetTimeTotals))
+
+	// 工作量报表相关路由
+	http.HandleFunc("/api/reports/effort", authMiddleware(handleGetEffortReport))
+
+	// 共享清单相关路由
+	http.HandleFunc("/api/lists", authMiddleware(handleGetLists))
+	http.HandleFunc("/api/lists/create", authMiddleware(handleCreateList))
+	http.HandleFunc("/api/lists/update", authMiddleware(handleUpdateList))
+	http.HandleFunc("/api/lists/delete", authMiddleware(handleDeleteList))
+	http.HandleFunc("/api/lists/members", authMiddleware(handleGetListMembers))
+	http.HandleFunc("/api/lists/members/update", authMiddleware(handleUpdateListMember))
+	http.HandleFunc("/api/lists/members/remove", authMiddleware(handleRemoveListMember))
+	http.HandleFunc("/api/lists/invite", authMiddleware(handleInviteToList))
+	http.HandleFunc("/api/lists/invitations", authMiddleware(handleGetInvitations))
+	http.HandleFunc("/api/lists/invitations/respond", authMiddleware(handleRespondInvitation))
+
+	// 管理员相关路由
+	http.HandleFunc("/api/admin/users", authMiddleware(requireRole(db.RoleAdmin, handleAdminListUsers)))
+	http.HandleFunc("/api/admin/user/disable", authMiddleware(requireRole(db.RoleAdmin, handleAdminDisableUser)))
+	http.HandleFunc("/api/admin/user/enable", authMiddleware(requireRole(db.RoleAdmin, handleAdminEnableUser)))
+	http.HandleFunc("/api/admin/user/role", authMiddleware(requireRole(db.RoleAdmin, handleAdminSetUserRole)))
+	http.HandleFunc("/api/admin/user/logout", authMiddleware(requireRole(db.RoleAdmin, handleAdminLogoutUser)))
+	http.HandleFunc("/api/admin/stats", authMiddleware(requireRole(db.RoleAdmin, handleAdminStats)))
+	http.HandleFunc("/api/admin/export", authMiddleware(requireRole(db.RoleAdmin, handleAdminExport)))
+
 	log.Println("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -94,6 +238,20 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// 被禁用的账号不允许继续访问
+		if !db.IsUserActive(claims.UserID) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "账号不存在或已被禁用"})
+			return
+		}
+
+		// 设备被删除或被管理员强制下线后token失效
+		if !db.IsDeviceAuthorized(claims.UserID, claims.DeviceID) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "设备未授权，请重新登录"})
+			return
+		}
+
 		// 将用户信息存储在请求上下文中
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, "user_id", claims.UserID)
@@ -104,6 +262,30 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// 角色验证中间件，需要在authMiddleware之后使用
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// 从上下文获取用户ID
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无法获取用户信息"})
+			return
+		}
+
+		// 检查用户角色
+		if !db.HasRole(userID, role) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "权限不足"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 // 用户注册处理
 func handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -456,11 +638,23 @@ func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
 
 	// 读取前端数据
 	var todoData struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		DeadLine    string `json:"deadline"`
-		Category    string `json:"category"`
-		Priority    string `json:"priority"`
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+		DeadLine    db.Deadline `json:"deadline"`
+		Category    string      `json:"category"`
+		Priority    string      `json:"priority"`
+		ListID      string      `json:"list_id"`
+		ProjectID   string      `json:"project_id"`
+		TagIDs      []string    `json:"tag_ids"`
+		ParentID    string      `json:"parent_id"`
+		Recurrence  string      `json:"recurrence"`
+		TimeZone    string      `json:"time_zone"`
+		Status      string      `json:"status"` // 不传表示按项目工作流的初始状态
+
+		Estimate     float64 `json:"estimate"`
+		EstimateUnit string  `json:"estimate_unit"` // minutes或points
+
+		CustomFields map[string]interface{} `json:"custom_fields"` // 按字段标识传入所属项目自定义字段的值
 	}
 
 	// 解析数据
@@ -478,6 +672,13 @@ func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 在共享清单中创建任务需要编辑权限
+	if todoData.ListID != "" && !db.HasListRole(todoData.ListID, userID, db.ListRoleEditor) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无权在该清单中创建任务"})
+		return
+	}
+
 	// 生成ID和创建时间
 	id := uuid.New().String()
 	now := time.Now()
@@ -485,6 +686,10 @@ func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
 		ID:          id,
 		UserID:      userID,
 		DeviceID:    deviceID,
+		ListID:      todoData.ListID,
+		ProjectID:   todoData.ProjectID,
+		TagIDs:      todoData.TagIDs,
+		ParentID:    todoData.ParentID,
 		Name:        todoData.Name,
 		Description: todoData.Description,
 		Completed:   false,
@@ -492,11 +697,58 @@ func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
 		UpdateAt:    now,
 		DeadLine:    todoData.DeadLine,
 		Category:    todoData.Category,
-		Priority:    todoData.Priority,
+		Priority:    db.Priority(todoData.Priority),
+		Recurrence:  todoData.Recurrence,
+		TimeZone:    todoData.TimeZone,
+		Status:      todoData.Status,
+
+		Estimate:     todoData.Estimate,
+		EstimateUnit: db.EstimateUnit(todoData.EstimateUnit),
+		CustomFields: todoData.CustomFields,
+	}
+
+	// 确定任务所属项目（未指定项目时按分类名称查找或创建）
+	err = db.ApplyTodoProject(userID, &newTodo)
+	if err == nil {
+		err = db.ApplyTodoTags(userID, &newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoParent(userID, &newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoDeadline(&newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoPriority(&newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoEstimate(&newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoCustomFields(&newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoRecurrence(&newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoStatus(nil, &newTodo)
+	}
+	if err == nil {
+		err = db.ApplyTodoPosition(&newTodo)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
 	}
 
 	// 存储数据
-	db.Todos = append(db.Todos, newTodo)
+	err = db.SaveTodoToDB(&newTodo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "保存任务失败: " + err.Error()})
+		return
+	}
 	log.Printf("创建任务: %s 由用户 %s 设备 %s", newTodo.Name, userID, deviceID)
 
 	// 返回创建的任务
@@ -583,8 +835,9 @@ func resolveConflicts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 
-	// 从上下文获取用户ID
+	// 从上下文获取用户ID和设备ID
 	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
 
 	var resolvedTodos []db.Todo
 	if err := json.NewDecoder(r.Body).Decode(&resolvedTodos); err != nil {
@@ -593,7 +846,7 @@ func resolveConflicts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解决冲突
-	if err := db.ResolveConflicts(userID, resolvedTodos); err != nil {
+	if err := db.ResolveConflicts(userID, deviceID, resolvedTodos); err != nil {
 		http.Error(w, fmt.Sprintf("解决冲突失败: %v", err), http.StatusInternalServerError)
 		log.Printf("解决冲突失败: %v", err)
 		return
@@ -611,18 +864,121 @@ func handleGetAllTodos(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 
-	// 过滤用户的任务
-	var userTodos []db.Todo
-	for _, todo := range db.Todos {
-		if todo.UserID == userID {
-			userTodos = append(userTodos, todo)
+	// 过滤、排序和分页参数见parseTodoQuery
+	query, err := parseTodoQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	page, err := db.QueryTodosFromDB(userID, query)
+	if err != nil {
+		if db.IsInvalidQuery(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
 		}
+		log.Printf("获取用户 %s 的任务失败: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取任务失败"})
+		return
 	}
 
-	log.Printf("获取用户 %s 的任务，共 %d 个", userID, len(userTodos))
+	log.Printf("获取用户 %s 的任务，共 %d 个", userID, len(page.Todos))
+
+	// 为了兼容旧客户端，响应仍然是任务数组，下一页的游标放在响应头中
+	if page.NextCursor != "" {
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(userTodos)
+	json.NewEncoder(w).Encode(page.Todos)
+}
+
+// 解析任务列表的查询参数：
+// view=assigned|created 只返回分配给我的/我创建的任务，默认返回所有可访问的任务
+// completed=true|false、project_id、category、list_id、priority（可以传多个）、tag（可以传多个，需要包含所有标签）、q（名称或描述包含的文字）
+// due_after/due_before、created_after/created_before、updated_after/updated_before 时间范围，
+// 格式为2006-01-02、RFC3339或相对今天的天数（例如+7d），只有日期时按tz参数指定的时区解释，before包含当天
+// archived=exclude|include|only 是否包含已归档的任务，默认不包含（query中使用is:archived时除外），回收站中的任务总是不包含
+// query 查询语言表达式，例如priority:high due:<7d -completed tag:customer "invoice"
+// sort 逗号分隔的排序字段（priority、due、created、updated、name、position、estimate、cf.字段标识），字段前加-表示倒序，默认按更新时间倒序
+// limit 每页数量，cursor 上一页返回的X-Next-Cursor，不传limit时返回所有任务
+func parseTodoQuery(r *http.Request) (db.TodoQuery, error) {
+	params := r.URL.Query()
+	query := db.TodoQuery{
+		TodoFilter: db.TodoFilter{
+			View:      params.Get("view"),
+			ProjectID: params.Get("project_id"),
+			Category:  params.Get("category"),
+			ListID:    params.Get("list_id"),
+			Statuses:  params["status"],
+			TagIDs:    params["tag"],
+			Text:      strings.TrimSpace(params.Get("q")),
+			Archived:  params.Get("archived"),
+		},
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+
+	if completed := params.Get("completed"); completed != "" {
+		value, err := strconv.ParseBool(completed)
+		if err != nil {
+			return query, fmt.Errorf("无效的完成状态: %s", completed)
+		}
+		query.Completed = &value
+	}
+
+	for _, priority := range params["priority"] {
+		query.Priorities = append(query.Priorities, db.Priority(priority))
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return query, fmt.Errorf("无效的每页数量: %s", limit)
+		}
+		query.Limit = value
+	}
+
+	loc := time.Local
+	if tz := params.Get("tz"); tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return query, fmt.Errorf("无效的时区: %s", tz)
+		}
+	}
+
+	now := time.Now()
+	for _, name := range db.TimeBoundParams {
+		if value := params.Get(name); value != "" {
+			if err := query.SetTimeBound(name, value, loc, now); err != nil {
+				return query, err
+			}
+		}
+	}
+
+	userID, _ := r.Context().Value("user_id").(string)
+	expr, err := db.ParseQueryExpr(params.Get("query"), userID, loc, now)
+	if err != nil {
+		return query, err
+	}
+	query.Expr = expr
+
+	return query, nil
+}
+
+// 查询参数错误的响应，查询语言的错误附带出错的位置
+func queryErrorBody(err error) map[string]interface{} {
+	body := map[string]interface{}{"error": err.Error()}
+	var queryErr *db.QueryError
+	if errors.As(err, &queryErr) {
+		body["position"] = queryErr.Pos
+	}
+	return body
 }
 
 func handleUpdateTodo(w http.ResponseWriter, r *http.Request) {
@@ -635,13 +991,26 @@ func handleUpdateTodo(w http.ResponseWriter, r *http.Request) {
 
 	// 读取前端数据
 	var updateData struct {
-		ID          string `json:"id"`
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Completed   bool   `json:"completed"`
-		DeadLine    string `json:"deadline"`
-		Category    string `json:"category"`
-		Priority    string `json:"priority"`
+		ID          string      `json:"id"`
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+		Completed   bool        `json:"completed"`
+		DeadLine    db.Deadline `json:"deadline"`
+		Category    string      `json:"category"`
+		Priority    string      `json:"priority"`
+		ListID      *string     `json:"list_id"`    // 不传表示不修改所属清单
+		ProjectID   *string     `json:"project_id"` // 不传表示按分类名称确定项目
+		TagIDs      []string    `json:"tag_ids"`    // 不传表示不修改标签
+		ParentID    *string     `json:"parent_id"`  // 不传表示不修改父任务，传空字符串表示移动到顶层
+		Cascade     bool        `json:"cascade"`    // 是否同时修改所有子任务的完成状态
+		Recurrence  *string     `json:"recurrence"` // 不传表示不修改重复规则，传空字符串表示取消重复
+		TimeZone    *string     `json:"time_zone"`
+		Status      *string     `json:"status"` // 不传表示按完成状态确定，传入时完成状态由工作流决定
+
+		Estimate     *float64 `json:"estimate"` // 不传表示不修改估算，传0表示清除估算
+		EstimateUnit *string  `json:"estimate_unit"`
+
+		CustomFields map[string]interface{} `json:"custom_fields"` // 只修改传入的字段，值为null表示清除
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&updateData)
@@ -651,30 +1020,166 @@ func handleUpdateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找并更新任务
-	found := false
-	for i, todo := range db.Todos {
-		if todo.ID == updateData.ID && todo.UserID == userID {
-			// 只允许更新自己的任务
-			db.Todos[i].Name = updateData.Name
-			db.Todos[i].Description = updateData.Description
-			db.Todos[i].Completed = updateData.Completed
-			db.Todos[i].DeadLine = updateData.DeadLine
-			db.Todos[i].Category = updateData.Category
-			db.Todos[i].Priority = updateData.Priority
-			db.Todos[i].UpdateAt = time.Now() // 更新时间戳
-			found = true
-			log.Printf("更新任务: %s 由用户 %s", updateData.ID, userID)
-			break
+	// 查找任务，只允许更新自己的任务或有编辑权限的共享任务
+	todo, err := db.GetTodoFromDB(updateData.ID)
+	if err != nil || !db.CanEditTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+		return
+	}
+	if todo.DeletedAt != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务在回收站中，请先恢复"})
+		return
+	}
+	original := *todo
+
+	// 移动任务到其他清单
+	if updateData.ListID != nil && *updateData.ListID != todo.ListID {
+		targetListID := *updateData.ListID
+		if !db.CanDeleteTodo(userID, todo) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无权移动该任务"})
+			return
+		}
+		if targetListID != "" && !db.HasListRole(targetListID, userID, db.ListRoleEditor) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无权将任务移动到该清单"})
+			return
+		}
+		if targetListID == "" && todo.UserID != userID {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "只有创建者可以将任务移出共享清单"})
+			return
 		}
+		if hasSubtasks, _ := db.HasSubtasks(todo.ID); hasSubtasks {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "包含子任务的任务不能移动到其他清单"})
+			return
+		}
+		todo.ListID = targetListID
+		// 标签和父任务属于原清单，移动后需要重新设置
+		todo.TagIDs = []string{}
+		todo.ParentID = ""
 	}
 
-	if !found {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+	wasCompleted := todo.Completed
+	todo.Name = updateData.Name
+	todo.Description = updateData.Description
+	todo.Completed = updateData.Completed
+	todo.DeadLine = updateData.DeadLine
+	todo.Priority = db.Priority(updateData.Priority)
+	todo.UpdateAt = time.Now() // 更新时间戳
+
+	// 确定任务所属项目，兼容只传分类名称的旧客户端
+	if updateData.ProjectID != nil {
+		todo.ProjectID = *updateData.ProjectID
+	} else {
+		todo.ProjectID = ""
+		todo.Category = updateData.Category
+	}
+	if updateData.TagIDs != nil {
+		todo.TagIDs = updateData.TagIDs
+	}
+	if updateData.ParentID != nil {
+		todo.ParentID = *updateData.ParentID
+	}
+	if updateData.Recurrence != nil {
+		todo.Recurrence = *updateData.Recurrence
+	}
+	if updateData.TimeZone != nil {
+		todo.TimeZone = *updateData.TimeZone
+	}
+	if updateData.Status != nil {
+		todo.Status = *updateData.Status
+	}
+	if updateData.Estimate != nil {
+		todo.Estimate = *updateData.Estimate
+	}
+	if updateData.EstimateUnit != nil {
+		todo.EstimateUnit = db.EstimateUnit(*updateData.EstimateUnit)
+	}
+	if updateData.CustomFields != nil {
+		todo.CustomFields = db.MergeCustomFieldValues(todo.CustomFields, updateData.CustomFields)
+	}
+	err = db.ApplyTodoProject(userID, todo)
+	if err == nil {
+		err = db.ApplyTodoTags(userID, todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoParent(userID, todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoDeadline(todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoPriority(todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoEstimate(todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoCustomFields(todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoRecurrence(todo)
+	}
+	if err == nil {
+		err = db.ApplyTodoStatus(&original, todo)
+	}
+	// 移动到其他清单、项目或父任务时排到最后
+	if err == nil && !db.SamePositionScope(&original, todo) {
+		todo.Position = ""
+		err = db.ApplyTodoPosition(todo)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = db.SaveTodoToDB(todo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "保存任务失败: " + err.Error()})
+		return
+	}
+
+	// 级联修改子任务的完成状态
+	if updateData.Cascade {
+		err = db.SetSubtasksCompleted(userID, todo.ID, todo.Completed)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "更新子任务失败: " + err.Error()})
+			return
+		}
+	}
+
+	// 记录完成状态、名称和看板状态的变更
+	err = db.RecordTodoChanges(userID, &original, todo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "记录任务变更失败: " + err.Error()})
 		return
 	}
 
+	// 通知因此解除阻塞的任务
+	db.NotifyUnblockedTodos(userID, &original, todo)
+
+	// 重复任务完成后生成下一次任务
+	if todo.Completed && !wasCompleted {
+		next, err := db.CreateNextOccurrence(todo)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "生成下一次重复任务失败: " + err.Error()})
+			return
+		}
+		if next != nil {
+			log.Printf("生成重复任务: %s 截止时间 %s", next.ID, next.DeadLine)
+		}
+	}
+	log.Printf("更新任务: %s 由用户 %s", updateData.ID, userID)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
 }
@@ -689,7 +1194,8 @@ func handleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 
 	// 读取前端数据
 	var deleteData struct {
-		ID string `json:"id"`
+		ID      string `json:"id"`
+		Cascade bool   `json:"cascade"` // 是否同时删除所有子任务，否则子任务移动到上一级
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&deleteData)
@@ -699,23 +1205,15 @@ func handleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找并删除任务
-	found := false
-	for i, todo := range db.Todos {
-		if todo.ID == deleteData.ID && todo.UserID == userID {
-			// 只允许删除自己的任务
-			db.Todos = append(db.Todos[:i], db.Todos[i+1:]...)
-			found = true
-			log.Printf("删除任务: %s 由用户 %s", deleteData.ID, userID)
-			break
-		}
-	}
-
-	if !found {
+	// 删除的任务先移入回收站，可以恢复，超过保留天数后自动彻底删除
+	// 只允许删除自己的任务或有编辑权限的共享任务
+	_, err = db.TrashTodo(userID, deleteData.ID, deleteData.Cascade)
+	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权删除"})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	log.Printf("删除任务: %s 由用户 %s（移入回收站）", deleteData.ID, userID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
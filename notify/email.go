@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTPNotifier 通过SMTP发送邮件通知
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPNotifierFromEnv 从环境变量SMTP_HOST、SMTP_PORT、SMTP_USERNAME、SMTP_PASSWORD、SMTP_FROM读取配置
+// 没有配置SMTP_HOST时返回nil
+func NewSMTPNotifierFromEnv() *SMTPNotifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+
+	n := &SMTPNotifier{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if n.Port == "" {
+		n.Port = "587"
+	}
+	if n.From == "" {
+		n.From = n.Username
+	}
+	return n
+}
+
+// Notify 发送邮件
+func (n *SMTPNotifier) Notify(msg Message) error {
+	if msg.Target == "" {
+		return errors.New("收件人邮箱为空")
+	}
+	// 防止邮件头注入
+	if strings.ContainsAny(msg.Target+msg.Title, "\r\n") {
+		return errors.New("无效的邮件地址或标题")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	return smtp.SendMail(n.Host+":"+n.Port, auth, n.From, []string{msg.Target}, n.message(msg))
+}
+
+// 生成邮件内容，邮件头只能包含ASCII字符，中文标题按RFC 2047编码
+func (n *SMTPNotifier) message(msg Message) []byte {
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.From, msg.Target, mime.QEncoding.Encode("UTF-8", msg.Title), msg.Body)
+	return []byte(content)
+}
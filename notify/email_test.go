@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"testing"
+)
+
+func TestSMTPNotifierEncodesSubject(t *testing.T) {
+	n := &SMTPNotifier{From: "todo@example.com"}
+	content := n.message(Message{Target: "user@example.com", Title: "任务提醒：提交报告", Body: "正文"})
+
+	if bytes.IndexFunc(content[:bytes.Index(content, []byte("\r\n\r\n"))], func(r rune) bool { return r > 127 }) >= 0 {
+		t.Errorf("邮件头不应该包含非ASCII字符: %q", content)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "任务提醒：提交报告" {
+		t.Errorf("解码后的标题为 %q", subject)
+	}
+
+	// ASCII标题保持原样
+	content = n.message(Message{Target: "user@example.com", Title: "Reminder", Body: "body"})
+	if !bytes.Contains(content, []byte("Subject: Reminder\r\n")) {
+		t.Errorf("ASCII标题不需要编码: %q", content)
+	}
+}
@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"TodoLists/db"
+)
+
+// FeedNotifier 将通知保存到应用内通知列表
+type FeedNotifier struct{}
+
+// Notify 保存应用内通知
+func (FeedNotifier) Notify(msg Message) error {
+	return db.SaveNotificationToDB(&db.Notification{
+		UserID:     msg.UserID,
+		TodoID:     msg.TodoID,
+		ReminderID: msg.ReminderID,
+		Title:      msg.Title,
+		Body:       msg.Body,
+		CreatedAt:  msg.SentAt,
+	})
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"time"
+)
+
+// Message 发送给用户的一条通知
+type Message struct {
+	UserID     string    `json:"user_id"`
+	TodoID     string    `json:"todo_id"`
+	ReminderID string    `json:"reminder_id"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	Target     string    `json:"-"` // webhook地址或邮箱地址
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// Notifier 通知渠道接口
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// Clock 时钟接口，测试时可以注入固定的时间
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 使用系统时间的时钟
+type SystemClock struct{}
+
+// Now 返回当前系统时间
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"TodoLists/db"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 每次检查最多处理的提醒数量
+const claimBatchSize = 100
+
+// Scheduler 后台提醒调度器，定期检查到期的提醒并通过对应的渠道发送
+// 提醒在发送前会被原子地标记为发送中，因此多次检查或服务重启都不会重复发送
+type Scheduler struct {
+	clock     Clock
+	interval  time.Duration
+	notifiers map[string]Notifier
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewScheduler 创建调度器，clock为nil时使用系统时间
+func NewScheduler(clock Clock, interval time.Duration) *Scheduler {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	return &Scheduler{
+		clock:     clock,
+		interval:  interval,
+		notifiers: make(map[string]Notifier),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Register 注册通知渠道
+func (s *Scheduler) Register(channel string, notifier Notifier) {
+	s.notifiers[channel] = notifier
+}
+
+// Start 在后台启动调度器
+func (s *Scheduler) Start() error {
+	recovered, err := db.RecoverInterruptedReminders(s.clock.Now())
+	if err != nil {
+		return err
+	}
+	if recovered > 0 {
+		log.Printf("%d 个提醒在上次发送过程中中断，已标记为失败", recovered)
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.RunOnce(); err != nil {
+				log.Printf("处理提醒失败: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop 停止调度器并等待当前的检查结束
+func (s *Scheduler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// RunOnce 发送所有到期的提醒，返回成功发送的数量
+func (s *Scheduler) RunOnce() (int, error) {
+	now := s.clock.Now()
+	reminders, err := db.ClaimDueReminders(now, claimBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// 单个提醒出错时继续处理其余已领取的提醒，否则它们会一直处于发送中状态
+	sent := 0
+	var firstErr error
+	for i := range reminders {
+		ok, err := s.deliver(&reminders[i], now)
+		if err != nil {
+			log.Printf("处理提醒 %s 失败: %v", reminders[i].ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, firstErr
+}
+
+// 发送一个已领取的提醒并记录结果
+func (s *Scheduler) deliver(reminder *db.Reminder, now time.Time) (bool, error) {
+	todo, err := db.GetTodoFromDB(reminder.TodoID)
+	if err == sql.ErrNoRows {
+		return false, db.CancelReminder(reminder, now, "任务已删除")
+	}
+	if err != nil {
+		// 暂时无法读取任务，放回待发送状态下次重试
+		if releaseErr := db.ReleaseReminder(reminder, now); releaseErr != nil {
+			log.Printf("放回提醒 %s 失败: %v", reminder.ID, releaseErr)
+		}
+		return false, err
+	}
+	if todo.Completed {
+		return false, db.CancelReminder(reminder, now, "任务已完成")
+	}
+	// 被移出共享清单或取消分配后不再发送任务内容
+	if !db.CanViewTodo(reminder.UserID, todo) {
+		return false, db.CancelReminder(reminder, now, "无权查看任务")
+	}
+
+	msg := Message{
+		UserID:     reminder.UserID,
+		TodoID:     todo.ID,
+		ReminderID: reminder.ID,
+		Title:      "任务提醒: " + todo.Name,
+		Body:       todo.Description,
+		Target:     reminder.Target,
+		SentAt:     now,
+	}
+	if !todo.DeadLine.IsZero() {
+		msg.Body = fmt.Sprintf("截止时间: %s\n%s", todo.DeadLine.String(), todo.Description)
+	}
+	if reminder.Channel == db.ChannelEmail {
+		msg.Target = ""
+		if user, err := db.GetUserByID(reminder.UserID); err == nil {
+			msg.Target = user.Email
+		}
+	}
+
+	var sendErr error
+	notifier, ok := s.notifiers[reminder.Channel]
+	if ok {
+		sendErr = notifier.Notify(msg)
+	} else {
+		sendErr = fmt.Errorf("通知渠道 %s 未配置", reminder.Channel)
+	}
+	if sendErr != nil {
+		log.Printf("发送提醒 %s 失败: %v", reminder.ID, sendErr)
+	}
+
+	return sendErr == nil, db.FinishReminder(reminder, now, sendErr)
+}
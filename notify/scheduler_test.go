@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"TodoLists/db"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// 可以手动调整的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// 记录发送的通知，failTodos中的任务发送失败
+type fakeNotifier struct {
+	messages  []Message
+	failTodos map[string]bool
+}
+
+func (n *fakeNotifier) Notify(msg Message) error {
+	if n.failTodos[msg.TodoID] {
+		return errors.New("发送失败")
+	}
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// 在临时目录中初始化数据库
+func setupSchedulerDB(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InitDatabase(); err != nil {
+		os.Chdir(wd)
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		db.CloseDatabase()
+		os.Chdir(wd)
+	})
+}
+
+func createSchedulerTodo(t *testing.T, id, userID, listID string) *db.Todo {
+	t.Helper()
+
+	now := time.Now()
+	todo := &db.Todo{ID: id, UserID: userID, ListID: listID, Name: "任务" + id, CreateAt: now, UpdateAt: now}
+	if err := db.SaveTodoToDB(todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func createSchedulerReminder(t *testing.T, userID, todoID string, remindAt time.Time) *db.Reminder {
+	t.Helper()
+
+	reminder := &db.Reminder{TodoID: todoID, Channel: db.ChannelFeed, RemindAt: remindAt}
+	if err := db.CreateReminder(userID, reminder); err != nil {
+		t.Fatal(err)
+	}
+	return reminder
+}
+
+func reminderStatus(t *testing.T, id string) *db.Reminder {
+	t.Helper()
+
+	reminder, err := db.GetReminderFromDB(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reminder
+}
+
+func newTestScheduler(clock Clock, notifier Notifier) *Scheduler {
+	s := NewScheduler(clock, time.Minute)
+	s.Register(db.ChannelFeed, notifier)
+	return s
+}
+
+func TestSchedulerSendsDueRemindersOnce(t *testing.T) {
+	setupSchedulerDB(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	notifier := &fakeNotifier{}
+	s := newTestScheduler(clock, notifier)
+
+	createSchedulerTodo(t, "a", "user", "")
+	createSchedulerTodo(t, "b", "user", "")
+	due := createSchedulerReminder(t, "user", "a", start.Add(-time.Minute))
+	later := createSchedulerReminder(t, "user", "b", start.Add(time.Hour))
+
+	sent, err := s.RunOnce()
+	if err != nil || sent != 1 {
+		t.Fatalf("第一次检查应该发送1个提醒，实际 %d 个，错误 %v", sent, err)
+	}
+	if notifier.messages[0].ReminderID != due.ID || notifier.messages[0].Title != "任务提醒: 任务a" {
+		t.Errorf("发送了错误的通知: %+v", notifier.messages[0])
+	}
+	if status := reminderStatus(t, due.ID).Status; status != db.ReminderSent {
+		t.Errorf("已发送的提醒状态应该为sent，实际为 %s", status)
+	}
+
+	// 时间未到的提醒不发送，已发送的提醒不重复发送
+	if sent, _ := s.RunOnce(); sent != 0 {
+		t.Errorf("没有新的到期提醒时不应该发送，实际发送 %d 个", sent)
+	}
+
+	clock.now = start.Add(2 * time.Hour)
+	if sent, err := s.RunOnce(); err != nil || sent != 1 {
+		t.Fatalf("时间到达后应该发送第二个提醒，实际 %d 个，错误 %v", sent, err)
+	}
+	if notifier.messages[1].ReminderID != later.ID {
+		t.Errorf("应该发送第二个提醒，实际为 %s", notifier.messages[1].ReminderID)
+	}
+}
+
+func TestSchedulerRetriesFailedReminders(t *testing.T) {
+	setupSchedulerDB(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	notifier := &fakeNotifier{failTodos: map[string]bool{"a": true}}
+	s := newTestScheduler(clock, notifier)
+
+	createSchedulerTodo(t, "a", "user", "")
+	createSchedulerTodo(t, "b", "user", "")
+	failing := createSchedulerReminder(t, "user", "a", start)
+	ok := createSchedulerReminder(t, "user", "b", start)
+
+	// 一个提醒发送失败不影响其他提醒
+	if sent, err := s.RunOnce(); err != nil || sent != 1 {
+		t.Fatalf("应该发送1个提醒，实际 %d 个，错误 %v", sent, err)
+	}
+	if status := reminderStatus(t, ok.ID).Status; status != db.ReminderSent {
+		t.Errorf("其他提醒应该发送成功，实际状态为 %s", status)
+	}
+
+	reminder := reminderStatus(t, failing.ID)
+	if reminder.Status != db.ReminderPending || reminder.Attempts != 1 || !reminder.RemindAt.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("失败的提醒应该在2分钟后重试，实际为 %+v", reminder)
+	}
+
+	// 重试时间之前不会再次发送
+	clock.now = start.Add(time.Minute)
+	if sent, _ := s.RunOnce(); sent != 0 || reminderStatus(t, failing.ID).Attempts != 1 {
+		t.Error("重试时间之前不应该再次发送")
+	}
+
+	notifier.failTodos = nil
+	clock.now = start.Add(2 * time.Minute)
+	if sent, err := s.RunOnce(); err != nil || sent != 1 {
+		t.Fatalf("重试应该发送成功，实际 %d 个，错误 %v", sent, err)
+	}
+	if status := reminderStatus(t, failing.ID).Status; status != db.ReminderSent {
+		t.Errorf("重试成功后状态应该为sent，实际为 %s", status)
+	}
+}
+
+func TestSchedulerCancelsUndeliverableReminders(t *testing.T) {
+	setupSchedulerDB(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	notifier := &fakeNotifier{}
+	s := newTestScheduler(clock, notifier)
+
+	list, err := db.CreateList("owner", "共享清单")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Users = append(db.Users, db.User{ID: "member", Username: "member", Email: "member@example.com"})
+	t.Cleanup(func() { db.Users = db.Users[:len(db.Users)-1] })
+	invitation, err := db.InviteToList(list.ID, "owner", "member", db.ListRoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RespondToInvitation(invitation.ID, "member", true); err != nil {
+		t.Fatal(err)
+	}
+
+	createSchedulerTodo(t, "shared", "owner", list.ID)
+	completed := createSchedulerTodo(t, "done", "member", "")
+	revoked := createSchedulerReminder(t, "member", "shared", start)
+	done := createSchedulerReminder(t, "member", "done", start)
+	deleted := createSchedulerReminder(t, "member", "done", start)
+
+	// 被移出清单后不再收到任务内容，已完成和已删除的任务取消提醒
+	if err := db.RemoveListMember(list.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	completed.Completed = true
+	if err := db.SaveTodoToDB(completed); err != nil {
+		t.Fatal(err)
+	}
+	// 删除任务时会同时删除提醒，这里直接让提醒指向不存在的任务
+	deletedReminder := reminderStatus(t, deleted.ID)
+	deletedReminder.TodoID = "missing"
+	if err := db.FinishReminder(deletedReminder, start.Add(-time.Hour), errors.New("重试")); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent, err := s.RunOnce(); err != nil || sent != 0 {
+		t.Fatalf("不应该发送任何提醒，实际 %d 个，错误 %v", sent, err)
+	}
+	if len(notifier.messages) != 0 {
+		t.Errorf("不应该发送任何通知，实际为 %+v", notifier.messages)
+	}
+	for id, reason := range map[string]string{revoked.ID: "无权查看任务", done.ID: "任务已完成", deleted.ID: "任务已删除"} {
+		reminder := reminderStatus(t, id)
+		if reminder.Status != db.ReminderCancelled || reminder.LastError != reason {
+			t.Errorf("提醒应该因为%s被取消，实际为 %s %s", reason, reminder.Status, reminder.LastError)
+		}
+	}
+}
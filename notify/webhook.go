@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// 共享地址空间（运营商级NAT），net.IP没有对应的判断方法
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// 内网或本机地址不能作为webhook目标
+var errPrivateWebhookAddress = errors.New("webhook地址不能指向内网或本机地址")
+
+// WebhookNotifier 通过HTTP POST将通知以JSON格式发送到指定地址
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+// NewWebhookNotifier 创建webhook通知渠道
+// 连接时检查实际连接的IP，即使域名在创建提醒之后被解析到内网地址也不会发送
+func NewWebhookNotifier() *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: denyPrivateAddress}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &WebhookNotifier{Client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+}
+
+// ValidateWebhookURL 校验webhook地址：只支持http和https，主机必须解析到公网地址
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("webhook地址必须是http或https地址")
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("无法解析webhook地址的主机: %s", u.Hostname())
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return errPrivateWebhookAddress
+		}
+	}
+	return nil
+}
+
+// 判断IP是否为可以访问的公网地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// 拨号前检查要连接的地址，拒绝内网和本机地址
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return errPrivateWebhookAddress
+	}
+	return nil
+}
+
+// Notify 发送webhook请求，非2xx响应视为失败
+func (n *WebhookNotifier) Notify(msg Message) error {
+	if msg.Target == "" {
+		return errors.New("webhook地址为空")
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(msg.Target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
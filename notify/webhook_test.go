@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://93.184.216.34:8080/hook", true},
+		{"ftp://93.184.216.34/hook", false},
+		{"file:///etc/passwd", false},
+		{"http:///hook", false},
+		{"http://127.0.0.1:8080/api", false},
+		{"http://localhost/api", false},
+		{"http://[::1]/api", false},
+		{"http://10.0.0.1/", false},
+		{"http://192.168.1.1/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://100.64.0.1/", false},
+		{"http://0.0.0.0/", false},
+	}
+	for _, tt := range tests {
+		err := ValidateWebhookURL(tt.url)
+		if tt.valid && err != nil {
+			t.Errorf("%s 应该有效，实际错误 %v", tt.url, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s 应该无效", tt.url)
+		}
+	}
+}
+
+func TestWebhookNotifierRefusesPrivateAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier().Notify(Message{Title: "测试", Target: server.URL})
+	if err == nil || called {
+		t.Fatalf("不应该向本机地址发送webhook，错误为 %v", err)
+	}
+}
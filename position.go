@@ -0,0 +1,57 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// 调整任务的手动排序，只修改被移动的任务
+func handleMoveTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var moveData struct {
+		ID       string `json:"id"`
+		AfterID  string `json:"after_id"`  // 移动到该任务之后
+		BeforeID string `json:"before_id"` // 移动到该任务之前，两者都不传表示移动到最后
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&moveData)
+	if err != nil || moveData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.GetTodoFromDB(moveData.ID)
+	if err != nil || !db.CanEditTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+		return
+	}
+
+	err = db.MoveTodo(todo, moveData.AfterID, moveData.BeforeID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 调整任务 %s 的顺序，新位置 %s", userID, todo.ID, todo.Position)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
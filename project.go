@@ -0,0 +1,189 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// 获取用户可访问的项目列表
+func handleGetProjects(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	projects, err := db.GetUserProjectsFromDB(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取项目失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"projects": projects,
+	})
+}
+
+// 创建项目
+func handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var projectData struct {
+		Name      string       `json:"name"`
+		Color     string       `json:"color"`
+		Icon      string       `json:"icon"`
+		ListID    string       `json:"list_id"`
+		ParentID  string       `json:"parent_id"`
+		SortOrder int          `json:"sort_order"`
+		Workflow  *db.Workflow `json:"workflow"` // 不传表示使用默认工作流
+
+		CustomFields []db.CustomField `json:"custom_fields"` // 任务的自定义字段定义
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&projectData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	project := db.Project{
+		Name:      projectData.Name,
+		Color:     projectData.Color,
+		Icon:      projectData.Icon,
+		ListID:    projectData.ListID,
+		ParentID:  projectData.ParentID,
+		SortOrder: projectData.SortOrder,
+		Workflow:  projectData.Workflow,
+
+		CustomFields: projectData.CustomFields,
+	}
+
+	err = db.CreateProject(userID, &project)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 创建项目: %s", userID, project.Name)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"project": project,
+	})
+}
+
+// 更新项目（名称、颜色、图标、归档状态、排序、父项目、工作流、自定义字段）
+func handleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var projectData struct {
+		ID        string       `json:"id"`
+		Name      string       `json:"name"`
+		Color     string       `json:"color"`
+		Icon      string       `json:"icon"`
+		ParentID  string       `json:"parent_id"`
+		Archived  bool         `json:"archived"`
+		SortOrder int          `json:"sort_order"`
+		Workflow  *db.Workflow `json:"workflow"` // 不传表示不修改，传入空的statuses表示恢复默认工作流
+
+		CustomFields []db.CustomField `json:"custom_fields"` // 不传表示不修改，传入空列表表示删除所有字段
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&projectData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	project := db.Project{
+		ID:        projectData.ID,
+		Name:      projectData.Name,
+		Color:     projectData.Color,
+		Icon:      projectData.Icon,
+		ParentID:  projectData.ParentID,
+		Archived:  projectData.Archived,
+		SortOrder: projectData.SortOrder,
+		Workflow:  projectData.Workflow,
+
+		CustomFields: projectData.CustomFields,
+	}
+
+	err = db.UpdateProject(userID, &project)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 更新项目: %s", userID, project.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"project": project,
+	})
+}
+
+// 删除项目，其中的任务移出项目，子项目移动到上级项目
+func handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var deleteData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&deleteData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteProject(userID, deleteData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除项目: %s", userID, deleteData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
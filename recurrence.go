@@ -0,0 +1,115 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 跳过本次重复任务
+func handleSkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var skipData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&skipData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.GetTodoFromDB(skipData.ID)
+	if err != nil || !db.CanEditTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+		return
+	}
+
+	err = db.SkipOccurrence(todo)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 跳过重复任务 %s，下一次截止时间 %s", userID, todo.ID, todo.DeadLine)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 修改本次及以后的所有重复任务
+func handleUpdateFutureOccurrences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var updateData struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Priority    string `json:"priority"`
+		Recurrence  string `json:"recurrence"` // 传空字符串表示从本次开始停止重复
+		TimeZone    string `json:"time_zone"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&updateData)
+	if err != nil || updateData.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.GetTodoFromDB(updateData.ID)
+	if err != nil || !db.CanEditTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+		return
+	}
+
+	todo.Name = updateData.Name
+	todo.Description = updateData.Description
+	todo.Priority = db.Priority(updateData.Priority)
+	todo.Recurrence = updateData.Recurrence
+	todo.TimeZone = updateData.TimeZone
+	todo.UpdateAt = time.Now()
+
+	err = db.UpdateFutureOccurrences(userID, todo)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 修改重复序列 %s 中 %s 及以后的任务", userID, todo.SeriesID, todo.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
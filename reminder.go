@@ -0,0 +1,239 @@
+package main
+
+import (
+	"TodoLists/db"
+	"TodoLists/notify"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 获取用户的提醒，可以通过todo_id参数只获取某个任务的提醒
+func handleGetReminders(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	reminders, err := db.GetUserRemindersFromDB(userID, r.URL.Query().Get("todo_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取提醒失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"reminders": reminders,
+	})
+}
+
+// 创建提醒，remind_at为绝对时间，或者设置relative和offset_minutes在截止时间之前提醒
+func handleCreateReminder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var reminderData struct {
+		TodoID        string    `json:"todo_id"`
+		Channel       string    `json:"channel"`
+		Target        string    `json:"target"`
+		RemindAt      time.Time `json:"remind_at"`
+		Relative      bool      `json:"relative"`
+		OffsetMinutes int       `json:"offset_minutes"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&reminderData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	if reminderData.Channel == "" {
+		reminderData.Channel = db.ChannelFeed
+	}
+	if reminderData.Channel == db.ChannelWebhook {
+		if err := notify.ValidateWebhookURL(reminderData.Target); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	reminder := db.Reminder{
+		TodoID:        reminderData.TodoID,
+		Channel:       reminderData.Channel,
+		Target:        reminderData.Target,
+		RemindAt:      reminderData.RemindAt,
+		Relative:      reminderData.Relative,
+		OffsetMinutes: reminderData.OffsetMinutes,
+	}
+
+	err = db.CreateReminder(userID, &reminder)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 为任务 %s 创建提醒: %s", userID, reminder.TodoID, reminder.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"reminder": reminder,
+	})
+}
+
+// 删除提醒
+func handleDeleteReminder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var deleteData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&deleteData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteReminder(userID, deleteData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// 推迟提醒，传入minutes表示从现在起推迟多少分钟，或者传入until指定新的提醒时间
+func handleSnoozeReminder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var snoozeData struct {
+		ID      string    `json:"id"`
+		Minutes int       `json:"minutes"`
+		Until   time.Time `json:"until"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&snoozeData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	until := snoozeData.Until
+	if until.IsZero() {
+		if snoozeData.Minutes <= 0 {
+			snoozeData.Minutes = 10
+		}
+		until = time.Now().Add(time.Duration(snoozeData.Minutes) * time.Minute)
+	}
+
+	reminder, err := db.SnoozeReminder(userID, snoozeData.ID, until)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 推迟提醒 %s 到 %s", userID, reminder.ID, until.Format(time.RFC3339))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"reminder": reminder,
+	})
+}
+
+// 获取应用内通知，unread=1时只返回未读通知
+func handleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	notifications, err := db.GetUserNotificationsFromDB(userID, r.URL.Query().Get("unread") == "1", 100)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取通知失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+	})
+}
+
+// 将通知标记为已读，ids为空时标记全部
+func handleReadNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var readData struct {
+		IDs []string `json:"ids"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&readData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.MarkNotificationsRead(userID, readData.IDs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "更新通知失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
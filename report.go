@@ -0,0 +1,66 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// 按项目、标签或周统计估算和实际工作量
+// from和to为2006-01-02格式的日期（包括to当天），按tz指定的时区解释
+func handleGetEffortReport(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	params := r.URL.Query()
+
+	opts := db.EffortReportOptions{
+		GroupBy:   params.Get("group_by"),
+		ProjectID: params.Get("project_id"),
+		Location:  time.Local,
+	}
+	if opts.GroupBy == "" {
+		opts.GroupBy = db.ReportByProject
+	}
+	if tz := params.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的时区: " + tz})
+			return
+		}
+		opts.Location = loc
+	}
+	for name, bound := range map[string]*time.Time{"from": &opts.From, "to": &opts.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, opts.Location)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的日期: " + value})
+			return
+		}
+		*bound = date
+	}
+	if !opts.To.IsZero() {
+		opts.To = opts.To.AddDate(0, 0, 1)
+	}
+
+	report, err := db.GetEffortReport(userID, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// 全文搜索任务名称和描述，q为搜索内容（多个关键词用空格分隔），按相关度排序
+// 可以同时使用任务列表的过滤参数（见parseTodoQuery），limit和offset用于分页
+// 与任务列表不同，不传archived时搜索结果包含已归档的任务
+func handleSearchTodos(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	query, err := parseTodoQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	if query.Archived == "" {
+		query.Archived = db.ArchivedInclude
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的偏移量: " + value})
+			return
+		}
+	}
+
+	results, err := db.SearchTodosFromDB(userID, query.Text, query.TodoFilter, query.Limit, offset)
+	if err != nil {
+		if db.IsInvalidQuery(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		log.Printf("用户 %s 搜索任务失败: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "搜索失败"})
+		return
+	}
+
+	log.Printf("用户 %s 搜索任务 %q，共 %d 个结果", userID, query.Text, len(results))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"results": results,
+	})
+}
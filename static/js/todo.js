@@ -202,7 +202,7 @@ const TodoManager = {
                     return dateA - dateB;
                 });
             case 'priority':
-                const priorityOrder = { 'high': 1, 'medium': 2, 'low': 3, '': 4 };
+                const priorityOrder = { 'urgent': 0, 'high': 1, 'medium': 2, 'low': 3, '': 4 };
                 return todos.sort((a, b) => {
                     return priorityOrder[a.priority || ''] - priorityOrder[b.priority || ''];
                 });
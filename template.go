@@ -0,0 +1,265 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 获取用户可访问的模板
+func handleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	templates, err := db.GetUserTemplatesFromDB(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取模板失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"templates": templates,
+	})
+}
+
+// 创建模板
+func handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var templateData struct {
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		ListID      string            `json:"list_id"`
+		Items       []db.TemplateItem `json:"items"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&templateData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	template := db.Template{
+		Name:        templateData.Name,
+		Description: templateData.Description,
+		ListID:      templateData.ListID,
+		Items:       templateData.Items,
+	}
+	err = db.CreateTemplate(userID, &template)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 创建模板: %s", userID, template.Name)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": template,
+	})
+}
+
+// 修改模板，任务列表整体替换
+func handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var templateData struct {
+		ID          string            `json:"id"`
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		Items       []db.TemplateItem `json:"items"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&templateData)
+	if err != nil || templateData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	template := db.Template{
+		ID:          templateData.ID,
+		Name:        templateData.Name,
+		Description: templateData.Description,
+		Items:       templateData.Items,
+	}
+	err = db.UpdateTemplate(userID, &template)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 修改模板: %s", userID, template.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": template,
+	})
+}
+
+// 删除模板
+func handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var templateData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&templateData)
+	if err != nil || templateData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteTemplate(userID, templateData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除模板 %s", userID, templateData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// 根据项目中的任务创建模板
+func handleCreateTemplateFromProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var templateData struct {
+		ProjectID string `json:"project_id"`
+		Name      string `json:"name"`      // 不传时使用项目名称
+		BaseDate  string `json:"base_date"` // 计算相对截止日期的基准日期，不传时使用最早的截止日期
+	}
+	err := json.NewDecoder(r.Body).Decode(&templateData)
+	if err != nil || templateData.ProjectID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	var baseDate time.Time
+	if templateData.BaseDate != "" {
+		baseDate, err = time.Parse("2006-01-02", templateData.BaseDate)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的基准日期: " + templateData.BaseDate})
+			return
+		}
+	}
+
+	template, err := db.CreateTemplateFromProject(userID, templateData.ProjectID, templateData.Name, baseDate)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 根据项目 %s 创建模板: %s", userID, templateData.ProjectID, template.Name)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": template,
+	})
+}
+
+// 按模板创建任务
+func handleInstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
+
+	var instantiateData struct {
+		TemplateID string `json:"template_id"`
+		StartDate  string `json:"start_date"` // 2006-01-02，不传表示今天
+		ProjectID  string `json:"project_id"`
+		ListID     string `json:"list_id"`
+		TimeZone   string `json:"time_zone"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&instantiateData)
+	if err != nil || instantiateData.TemplateID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todos, err := db.InstantiateTemplate(userID, deviceID, instantiateData.TemplateID, db.InstantiateOptions{
+		StartDate: instantiateData.StartDate,
+		ProjectID: instantiateData.ProjectID,
+		ListID:    instantiateData.ListID,
+		TimeZone:  instantiateData.TimeZone,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 按模板 %s 创建了%d个任务", userID, instantiateData.TemplateID, len(todos))
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todos":   todos,
+	})
+}
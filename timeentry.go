@@ -0,0 +1,333 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 开始为任务计时，正在运行的其他计时器会自动停止
+func handleStartTimer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
+
+	var timerData struct {
+		TodoID string `json:"todo_id"`
+		Note   string `json:"note"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&timerData)
+	if err != nil || timerData.TodoID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	entry, stopped, err := db.StartTimer(userID, deviceID, timerData.TodoID, timerData.Note)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 开始为任务 %s 计时", userID, timerData.TodoID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+		"stopped": stopped,
+	})
+}
+
+// 停止正在运行的计时器
+func handleStopTimer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
+
+	// 请求体可以为空，传入备注时同时修改备注
+	var timerData struct {
+		Note *string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&timerData); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+			return
+		}
+	}
+
+	entry, err := db.StopTimer(userID, deviceID, timerData.Note)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 停止计时，时长 %d 秒", userID, entry.Duration)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+	})
+}
+
+// 获取正在运行的计时器，没有时entry为null
+func handleGetRunningTimer(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	entry, err := db.GetRunningTimeEntry(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取计时器失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+	})
+}
+
+// 计时记录的请求数据，修改时没有传入的字段保持不变
+type timeEntryRequest struct {
+	ID        string     `json:"id"`
+	TodoID    *string    `json:"todo_id"`
+	StartedAt *time.Time `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+	Note      *string    `json:"note"`
+}
+
+func (req *timeEntryRequest) apply(entry *db.TimeEntry) {
+	if req.TodoID != nil {
+		entry.TodoID = *req.TodoID
+	}
+	if req.StartedAt != nil {
+		entry.StartedAt = *req.StartedAt
+	}
+	if req.StoppedAt != nil {
+		entry.StoppedAt = req.StoppedAt
+	}
+	if req.Note != nil {
+		entry.Note = *req.Note
+	}
+}
+
+// 手动添加计时记录，例如补录忘记计时的工作
+func handleCreateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
+
+	var entryData timeEntryRequest
+	err := json.NewDecoder(r.Body).Decode(&entryData)
+	if err != nil || entryData.TodoID == nil || entryData.StartedAt == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	var entry db.TimeEntry
+	entryData.apply(&entry)
+	stopped, err := db.CreateTimeEntry(userID, deviceID, &entry)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 为任务 %s 添加计时记录: %s", userID, entry.TodoID, entry.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+		"stopped": stopped,
+	})
+}
+
+// 修改计时记录的任务、开始和结束时间以及备注
+func handleUpdateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	deviceID, _ := r.Context().Value("device_id").(string)
+
+	var entryData timeEntryRequest
+	err := json.NewDecoder(r.Body).Decode(&entryData)
+	if err != nil || entryData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	entry, err := db.GetTimeEntryFromDB(entryData.ID)
+	if err != nil || entry.Deleted || entry.UserID != userID {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "计时记录不存在或无权修改"})
+		return
+	}
+
+	entryData.apply(entry)
+	stopped, err := db.UpdateTimeEntry(userID, deviceID, entry)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 修改计时记录: %s", userID, entry.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entry":   entry,
+		"stopped": stopped,
+	})
+}
+
+// 删除计时记录
+func handleDeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var entryData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&entryData)
+	if err != nil || entryData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.DeleteTimeEntry(userID, entryData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 删除计时记录: %s", userID, entryData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// 获取计时记录：传入todo_id时返回该任务所有成员的记录，否则返回自己在from和to之间开始的记录
+func handleGetTimeEntries(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	params := r.URL.Query()
+
+	var entries []db.TimeEntry
+	var err error
+	if todoID := params.Get("todo_id"); todoID != "" {
+		todo, getErr := db.GetTodoFromDB(todoID)
+		if getErr != nil || !db.CanViewTodo(userID, todo) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+			return
+		}
+		entries, err = db.GetTodoTimeEntriesFromDB(todoID)
+	} else {
+		var from, to time.Time
+		for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+			if value := params.Get(name); value != "" {
+				if *bound, err = time.Parse(time.RFC3339, value); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]string{"error": "无效的时间: " + value})
+					return
+				}
+			}
+		}
+		entries, err = db.GetUserTimeEntriesFromDB(userID, from, to)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取计时记录失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"entries": entries,
+	})
+}
+
+// 获取任务或项目的计时合计
+func handleGetTimeTotals(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+	params := r.URL.Query()
+
+	totals, err := db.GetTimeTotals(userID, params.Get("todo_id"), params.Get("project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"totals":  totals,
+	})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 自动清理回收站的检查间隔
+const trashPurgeInterval = time.Hour
+
+// 从环境变量TRASH_RETENTION_DAYS读取回收站的保留天数，为0表示不自动删除
+func loadTrashRetentionFromEnv() {
+	value := os.Getenv("TRASH_RETENTION_DAYS")
+	if value == "" {
+		return
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Printf("无效的回收站保留天数 %q，使用默认值 %d", value, db.TrashRetentionDays)
+		return
+	}
+	db.TrashRetentionDays = days
+}
+
+// 在后台定期彻底删除回收站中超过保留天数的任务，返回停止函数
+func startTrashPurger(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := db.PurgeExpiredTrash(time.Now())
+			if err != nil {
+				log.Printf("清理回收站失败: %v", err)
+			} else if purged > 0 {
+				log.Printf("自动彻底删除了回收站中的 %d 个任务", purged)
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// 归档任务，子任务一起归档
+func handleArchiveTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var archiveData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&archiveData)
+	if err != nil || archiveData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.ArchiveTodo(userID, archiveData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 归档任务 %s", userID, archiveData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 取消归档
+func handleUnarchiveTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var archiveData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&archiveData)
+	if err != nil || archiveData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.UnarchiveTodo(userID, archiveData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 取消归档任务 %s", userID, archiveData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 批量归档完成超过指定天数的任务
+func handleArchiveCompletedTodos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var archiveData struct {
+		OlderThanDays *int   `json:"older_than_days"`
+		ProjectID     string `json:"project_id"`
+		ListID        string `json:"list_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&archiveData)
+	if err != nil || archiveData.OlderThanDays == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据，需要指定older_than_days"})
+		return
+	}
+
+	count, err := db.ArchiveCompletedTodos(userID, db.ArchiveOptions{
+		OlderThanDays: *archiveData.OlderThanDays,
+		ProjectID:     archiveData.ProjectID,
+		ListID:        archiveData.ListID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 归档了%d个完成超过%d天的任务", userID, count, *archiveData.OlderThanDays)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"archived": count,
+	})
+}
+
+// 获取回收站中的任务
+func handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	todos, err := db.GetTrashFromDB(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取回收站失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"todos":          todos,
+		"retention_days": db.TrashRetentionDays,
+	})
+}
+
+// 从回收站恢复任务
+func handleRestoreTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var restoreData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&restoreData)
+	if err != nil || restoreData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.RestoreTodo(userID, restoreData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 从回收站恢复任务 %s", userID, restoreData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 彻底删除回收站中的任务
+func handlePurgeTodo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var purgeData struct {
+		ID string `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&purgeData)
+	if err != nil || purgeData.ID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	err = db.PurgeTodo(userID, purgeData.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 彻底删除任务 %s", userID, purgeData.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// 清空回收站中用户有删除权限的任务
+func handleEmptyTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	count, err := db.EmptyTrash(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "清空回收站失败: " + err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 清空回收站，彻底删除了%d个任务", userID, count)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"deleted": count,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"TodoLists/db"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 按项目工作流的状态分组列出任务（看板），支持任务列表的过滤参数，limit为每列的数量
+func handleGetProjectBoard(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	query, err := parseTodoQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	project, columns, err := db.GetProjectBoard(userID, r.URL.Query().Get("project_id"), query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(queryErrorBody(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"project":  project,
+		"workflow": project.EffectiveWorkflow(),
+		"columns":  columns,
+	})
+}
+
+// 变更任务的看板状态
+func handleChangeTodoStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	var statusData struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&statusData)
+	if err != nil || statusData.ID == "" || statusData.Status == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "无效的请求数据"})
+		return
+	}
+
+	todo, err := db.GetTodoFromDB(statusData.ID)
+	if err != nil || !db.CanEditTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权修改"})
+		return
+	}
+
+	err = db.ChangeTodoStatus(userID, todo, statusData.Status)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户 %s 将任务 %s 的状态变更为 %s", userID, todo.ID, todo.Status)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"todo":    todo,
+	})
+}
+
+// 获取任务的状态变更记录、在各状态停留的时间和周期时间
+func handleGetTodoCycleTime(w http.ResponseWriter, r *http.Request) {
+	// 设置CORS头
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, _ := r.Context().Value("user_id").(string)
+
+	todo, err := db.GetTodoFromDB(r.URL.Query().Get("id"))
+	if err != nil || !db.CanViewTodo(userID, todo) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "任务不存在或无权查看"})
+		return
+	}
+
+	cycleTime, err := db.GetTodoCycleTime(todo, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "获取状态变更记录失败: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"status":  todo.Status,
+		"timing":  cycleTime,
+	})
+}